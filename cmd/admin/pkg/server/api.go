@@ -28,7 +28,52 @@ func (server *AdminServer) initAPIRoute() {
 	server.e.DELETE("/api/apis/:url", server.deleteAPI())
 
 	server.e.GET("/api/routings", server.getRoutings())
+	server.e.GET("/api/routings/:id", server.getRouting())
 	server.e.POST("/api/routings", server.newRouting())
+	server.e.PUT("/api/routings", server.updateRouting())
+	server.e.DELETE("/api/routings/:id", server.deleteRouting())
+	server.e.POST("/api/routings/:id/enable", server.enableRouting())
+	server.e.POST("/api/routings/:id/disable", server.disableRouting())
+
+	server.e.GET("/api/consumers", server.getConsumers())
+	server.e.GET("/api/consumers/:id", server.getConsumer())
+	server.e.POST("/api/consumers", server.newConsumer())
+	server.e.PUT("/api/consumers", server.updateConsumer())
+	server.e.DELETE("/api/consumers/:id", server.deleteConsumer())
+	server.e.POST("/api/consumers/:id/keys", server.newConsumerKey())
+	server.e.DELETE("/api/consumers/:id/keys/:hash", server.deleteConsumerKey())
+	server.e.POST("/api/consumers/:id/secret", server.newConsumerSecret())
+
+	server.e.GET("/api/jwt/keysets", server.getJWTKeySets())
+	server.e.GET("/api/jwt/keysets/:id", server.getJWTKeySet())
+	server.e.POST("/api/jwt/keysets", server.newJWTKeySet())
+	server.e.PUT("/api/jwt/keysets", server.updateJWTKeySet())
+	server.e.DELETE("/api/jwt/keysets/:id", server.deleteJWTKeySet())
+
+	server.e.GET("/api/ipsets", server.getIPSets())
+	server.e.GET("/api/ipsets/:name", server.getIPSet())
+	server.e.POST("/api/ipsets", server.newIPSet())
+	server.e.PUT("/api/ipsets", server.updateIPSet())
+	server.e.DELETE("/api/ipsets/:name", server.deleteIPSet())
+
+	server.e.GET("/api/blocklist", server.getBlockedIPs())
+	server.e.GET("/api/blocklist/:id", server.getBlockedIP())
+	server.e.POST("/api/blocklist", server.newBlockedIP())
+	server.e.PUT("/api/blocklist", server.updateBlockedIP())
+	server.e.DELETE("/api/blocklist/:id", server.deleteBlockedIP())
+
+	server.e.GET("/api/vhosts", server.getVHosts())
+	server.e.GET("/api/vhosts/:name", server.getVHost())
+	server.e.POST("/api/vhosts", server.newVHost())
+	server.e.PUT("/api/vhosts", server.updateVHost())
+	server.e.DELETE("/api/vhosts/:name", server.deleteVHost())
+
+	server.e.GET("/api/quotas", server.getQuotas())
+	server.e.GET("/api/quotas/:consumer/:group", server.getQuota())
+	server.e.POST("/api/quotas", server.newQuota())
+	server.e.PUT("/api/quotas", server.updateQuota())
+	server.e.DELETE("/api/quotas/:consumer/:group", server.deleteQuota())
+	server.e.POST("/api/quotas/:consumer/:group/reset", server.resetQuota())
 
 	server.e.GET("/api/analysis/:proxy/:server/:secs", server.getAnalysis())
 	server.e.POST("/api/analysis", server.newAnalysis())
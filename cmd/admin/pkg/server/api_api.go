@@ -36,7 +36,7 @@ func (server *AdminServer) getAPI() echo.HandlerFunc {
 		u, _ := base64.RawURLEncoding.DecodeString(c.Param("url"))
 		method := c.QueryParam("method")
 
-		api, err := server.store.GetAPI(string(u), method)
+		api, err := server.store.GetAPI(c.QueryParam("vhost"), string(u), method)
 		if err != nil {
 			errstr = err.Error()
 			code = CodeError
@@ -56,6 +56,19 @@ func (server *AdminServer) newAPI() echo.HandlerFunc {
 		code := CodeSuccess
 
 		api, err := model.UnMarshalAPIFromReader(c.Request().Body())
+		if nil == err {
+			err = api.Check()
+			if nil == err {
+				err = server.checkVHostExists(api.VHost)
+			}
+
+			if nil != err {
+				return c.JSON(http.StatusBadRequest, &Result{
+					Code:  CodeError,
+					Error: err.Error(),
+				})
+			}
+		}
 
 		if nil != err {
 			errstr = err.Error()
@@ -81,6 +94,19 @@ func (server *AdminServer) updateAPI() echo.HandlerFunc {
 		code := CodeSuccess
 
 		api, err := model.UnMarshalAPIFromReader(c.Request().Body())
+		if nil == err {
+			err = api.Check()
+			if nil == err {
+				err = server.checkVHostExists(api.VHost)
+			}
+
+			if nil != err {
+				return c.JSON(http.StatusBadRequest, &Result{
+					Code:  CodeError,
+					Error: err.Error(),
+				})
+			}
+		}
 
 		if nil != err {
 			errstr = err.Error()
@@ -107,7 +133,7 @@ func (server *AdminServer) deleteAPI() echo.HandlerFunc {
 
 		url, _ := base64.RawURLEncoding.DecodeString(c.Param("url"))
 		method := c.QueryParam("method")
-		err := server.store.DeleteAPI(string(url), method)
+		err := server.store.DeleteAPI(c.QueryParam("vhost"), string(url), method)
 
 		if nil != err {
 			errstr = err.Error()
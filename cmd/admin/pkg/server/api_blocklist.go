@@ -0,0 +1,158 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func (server *AdminServer) getBlockedIPs() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		blockedIPs, err := server.store.GetBlockedIPs()
+		if err != nil {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		// the expired entries are removed by proxies later
+		var values []*model.BlockedIP
+		now := time.Now()
+		for _, blockedIP := range blockedIPs {
+			if !blockedIP.Expired(now) {
+				values = append(values, blockedIP)
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: values,
+		})
+	}
+}
+
+func (server *AdminServer) getBlockedIP() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		blockedIP, err := server.store.GetBlockedIP(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: blockedIP,
+		})
+	}
+}
+
+func (server *AdminServer) newBlockedIP() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		blockedIP, err := model.UnMarshalBlockedIPFromReader(c.Request().Body())
+
+		if err == nil {
+			err = setBlockedIPTTL(blockedIP, c.QueryParam("ttl"))
+		}
+
+		if err == nil {
+			err = blockedIP.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.SaveBlockedIP(blockedIP)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) updateBlockedIP() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		blockedIP, err := model.UnMarshalBlockedIPFromReader(c.Request().Body())
+
+		if err == nil {
+			err = setBlockedIPTTL(blockedIP, c.QueryParam("ttl"))
+		}
+
+		if err == nil {
+			err = blockedIP.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.UpdateBlockedIP(blockedIP)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteBlockedIP() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		err := server.store.DeleteBlockedIP(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+// setBlockedIPTTL the entry expired after ttl seconds if the ttl query param is set
+func setBlockedIPTTL(blockedIP *model.BlockedIP, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	ttl, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+
+	blockedIP.ExpireAt = time.Now().Add(time.Duration(ttl) * time.Second).Unix()
+	return nil
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func (server *AdminServer) getConsumers() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumers, err := server.store.GetConsumers()
+		if err != nil {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		for index, consumer := range consumers {
+			consumers[index] = consumer.Masked()
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: consumers,
+		})
+	}
+}
+
+func (server *AdminServer) getConsumer() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumer, err := server.store.GetConsumer(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else if nil != consumer {
+			consumer = consumer.Masked()
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: consumer,
+		})
+	}
+}
+
+func (server *AdminServer) newConsumer() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumer, err := model.UnMarshalConsumerFromReader(c.Request().Body())
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			// keys and secret only can be created by newConsumerKey and newConsumerSecret
+			consumer.Keys = nil
+			consumer.Secret = ""
+
+			err := server.store.SaveConsumer(consumer)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: consumer.ID,
+		})
+	}
+}
+
+func (server *AdminServer) updateConsumer() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumer, err := model.UnMarshalConsumerFromReader(c.Request().Body())
+
+		var old *model.Consumer
+		if nil == err {
+			old, err = server.getExistConsumer(consumer.ID)
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			// keep the keys and secret, they are managed by newConsumerKey, deleteConsumerKey and newConsumerSecret
+			consumer.Keys = old.Keys
+			consumer.Secret = old.Secret
+
+			err := server.store.UpdateConsumer(consumer)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteConsumer() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		err := server.store.DeleteConsumer(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+// newConsumerKey generate a api key, the plain key only returns once
+func (server *AdminServer) newConsumerKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		var key string
+		code := CodeSuccess
+
+		consumer, err := server.getExistConsumer(c.Param("id"))
+
+		if nil == err {
+			key, err = consumer.NewKey()
+		}
+
+		if nil == err {
+			err = server.store.UpdateConsumer(consumer)
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+			key = ""
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: key,
+		})
+	}
+}
+
+// deleteConsumerKey revoke a api key by it's hash
+func (server *AdminServer) deleteConsumerKey() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumer, err := server.getExistConsumer(c.Param("id"))
+
+		if nil == err && consumer.RemoveKey(c.Param("hash")) {
+			err = server.store.UpdateConsumer(consumer)
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+// newConsumerSecret generate a new secret to sign the requests, the old secret is invalid
+func (server *AdminServer) newConsumerSecret() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		var secret string
+		code := CodeSuccess
+
+		consumer, err := server.getExistConsumer(c.Param("id"))
+
+		if nil == err {
+			secret, err = consumer.NewSecret()
+		}
+
+		if nil == err {
+			err = server.store.UpdateConsumer(consumer)
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+			secret = ""
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: secret,
+		})
+	}
+}
+
+func (server *AdminServer) getExistConsumer(id string) (*model.Consumer, error) {
+	consumer, err := server.store.GetConsumer(id)
+	if nil == err && nil == consumer {
+		err = model.ErrConsumerNotFound
+	}
+
+	return consumer, err
+}
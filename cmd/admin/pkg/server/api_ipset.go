@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func (server *AdminServer) getIPSets() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		ipSets, err := server.store.GetIPSets()
+		if err != nil {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: ipSets,
+		})
+	}
+}
+
+func (server *AdminServer) getIPSet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		ipSet, err := server.store.GetIPSet(c.Param("name"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: ipSet,
+		})
+	}
+}
+
+func (server *AdminServer) newIPSet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		ipSet, err := model.UnMarshalIPSetFromReader(c.Request().Body())
+
+		if err == nil {
+			err = ipSet.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.SaveIPSet(ipSet)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) updateIPSet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		ipSet, err := model.UnMarshalIPSetFromReader(c.Request().Body())
+
+		if err == nil {
+			err = ipSet.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.UpdateIPSet(ipSet)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteIPSet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		err := server.store.DeleteIPSet(c.Param("name"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func (server *AdminServer) getJWTKeySets() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		keySets, err := server.store.GetJWTKeySets()
+		if err != nil {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: keySets,
+		})
+	}
+}
+
+func (server *AdminServer) getJWTKeySet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		keySet, err := server.store.GetJWTKeySet(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: keySet,
+		})
+	}
+}
+
+func (server *AdminServer) newJWTKeySet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		keySet, err := model.UnMarshalJWTKeySetFromReader(c.Request().Body())
+
+		if err == nil {
+			err = keySet.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.SaveJWTKeySet(keySet)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) updateJWTKeySet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		keySet, err := model.UnMarshalJWTKeySetFromReader(c.Request().Body())
+
+		if err == nil {
+			err = keySet.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.UpdateJWTKeySet(keySet)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteJWTKeySet() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		err := server.store.DeleteJWTKeySet(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
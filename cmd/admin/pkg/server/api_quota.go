@@ -0,0 +1,181 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func (server *AdminServer) getQuotas() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		quotas, err := server.store.GetQuotas()
+		if err != nil {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: quotas,
+		})
+	}
+}
+
+// getQuota returns the quota and the current usage of the consumer,
+// the quota of all consumers is used if the consumer has no spec quota
+func (server *AdminServer) getQuota() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumer := c.Param("consumer")
+		quota, err := server.getConsumerQuota(consumer, c.Param("group"))
+
+		var usage *model.QuotaUsage
+		if nil == err {
+			now := time.Now()
+			usage = &model.QuotaUsage{
+				Quota:   quota,
+				ResetAt: quota.ResetAt(now).Unix(),
+			}
+
+			if counter, ok := server.store.(model.Counter); ok {
+				usage.Used, err = counter.GetCounter(quota.UsageKey(consumer, now))
+			}
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: usage,
+		})
+	}
+}
+
+func (server *AdminServer) newQuota() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		quota, err := model.UnMarshalQuotaFromReader(c.Request().Body())
+
+		if err == nil {
+			err = quota.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.SaveQuota(quota)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) updateQuota() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		quota, err := model.UnMarshalQuotaFromReader(c.Request().Body())
+
+		if err == nil {
+			err = quota.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.UpdateQuota(quota)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteQuota() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		err := server.store.DeleteQuota(c.Param("consumer"), c.Param("group"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+// resetQuota clear the usage of the consumer in current period
+func (server *AdminServer) resetQuota() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		consumer := c.Param("consumer")
+		quota, err := server.getConsumerQuota(consumer, c.Param("group"))
+
+		if nil == err {
+			if counter, ok := server.store.(model.Counter); ok {
+				err = counter.DeleteCounter(quota.UsageKey(consumer, time.Now()))
+			}
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) getConsumerQuota(consumer, group string) (*model.Quota, error) {
+	quota, err := server.store.GetQuota(consumer, group)
+	if nil == err && nil == quota {
+		quota, err = server.store.GetQuota(model.QuotaAnyConsumer, group)
+	}
+
+	if nil == err && nil == quota {
+		err = model.ErrQuotaNotFound
+	}
+
+	return quota, err
+}
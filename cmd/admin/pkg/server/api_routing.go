@@ -54,3 +54,118 @@ func (server *AdminServer) newRouting() echo.HandlerFunc {
 		})
 	}
 }
+
+func (server *AdminServer) getRouting() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		routing, err := server.store.GetRouting(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: routing,
+		})
+	}
+}
+
+func (server *AdminServer) updateRouting() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		routing, err := model.UnMarshalRoutingFromReader(c.Request().Body())
+
+		var old *model.Routing
+		if err == nil {
+			old, err = server.store.GetRouting(routing.ID)
+		}
+
+		if err == nil && nil == old {
+			err = model.ErrRoutingNotFound
+		}
+
+		if err == nil {
+			// the start and deadline are relative to the create time
+			routing.CreateAt = old.CreateAt
+			err = routing.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.UpdateRouting(routing)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteRouting() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		err := server.store.DeleteRouting(c.Param("id"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) enableRouting() echo.HandlerFunc {
+	return server.setRoutingDisabled(false)
+}
+
+func (server *AdminServer) disableRouting() echo.HandlerFunc {
+	return server.setRoutingDisabled(true)
+}
+
+func (server *AdminServer) setRoutingDisabled(disabled bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		routing, err := server.store.GetRouting(c.Param("id"))
+
+		if err == nil && nil == routing {
+			err = model.ErrRoutingNotFound
+		}
+
+		if err == nil {
+			routing.Disabled = disabled
+			err = server.store.UpdateRouting(routing)
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
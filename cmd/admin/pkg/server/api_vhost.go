@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/labstack/echo"
+)
+
+func (server *AdminServer) getVHosts() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		vhosts, err := server.store.GetVHosts()
+		if err != nil {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: vhosts,
+		})
+	}
+}
+
+func (server *AdminServer) getVHost() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		vhost, err := server.store.GetVHost(c.Param("name"))
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+			Value: vhost,
+		})
+	}
+}
+
+func (server *AdminServer) newVHost() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		vhost, err := model.UnMarshalVHostFromReader(c.Request().Body())
+
+		if err == nil {
+			err = vhost.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.SaveVHost(vhost)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) updateVHost() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		vhost, err := model.UnMarshalVHostFromReader(c.Request().Body())
+
+		if err == nil {
+			err = vhost.Check()
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		} else {
+			err := server.store.UpdateVHost(vhost)
+			if nil != err {
+				errstr = err.Error()
+				code = CodeError
+			}
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+func (server *AdminServer) deleteVHost() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var errstr string
+		code := CodeSuccess
+
+		name := c.Param("name")
+		err := server.checkVHostNotReferenced(name)
+		if nil == err {
+			err = server.store.DeleteVHost(name)
+		}
+
+		if nil != err {
+			errstr = err.Error()
+			code = CodeError
+		}
+
+		return c.JSON(http.StatusOK, &Result{
+			Code:  code,
+			Error: errstr,
+		})
+	}
+}
+
+// checkVHostExists the api of a vhost not exists is never matched
+func (server *AdminServer) checkVHostExists(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	vhost, err := server.store.GetVHost(name)
+	if nil != err {
+		return err
+	}
+
+	if nil == vhost {
+		return fmt.Errorf("vhost <%s> not found", name)
+	}
+
+	return nil
+}
+
+func (server *AdminServer) checkVHostNotReferenced(name string) error {
+	apis, err := server.store.GetAPIs()
+	if nil != err {
+		return err
+	}
+
+	for _, api := range apis {
+		if api.VHost == name {
+			return fmt.Errorf("vhost <%s> is referenced by the api <%s %s>", name, api.Method, api.URL)
+		}
+	}
+
+	return nil
+}
@@ -34,17 +34,77 @@ type Conf struct {
 	// MaxResponseBodySize Maximum response body size.
 	MaxResponseBodySize int `json:"maxResponseBodySize"`
 
+	// RateLimitSyncInterval interval in milliseconds to sync the global rate limit counters
+	RateLimitSyncInterval int `json:"rateLimitSyncInterval,omitempty"`
+
+	// TrustedProxies CIDRs or ips of the trusted proxies, the forwarded headers are only trusted if they are sent by these proxies
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+	// ProxyProtocol accept the connections with the PROXY protocol header, from the trusted proxies if they are set
+	ProxyProtocol bool `json:"proxyProtocol,omitempty"`
+
+	// AutoBan ban the clients which get too many error responses, the bans are added to the global blocklist
+	AutoBan *AutoBan `json:"autoBan,omitempty"`
+
+	// RequestIDHeader the header of the request id, default is X-Request-Id
+	RequestIDHeader string `json:"requestIDHeader,omitempty"`
+	// ErrorTemplates the responses of the failed requests, the templates of the api are used first
+	ErrorTemplates []*ErrorTemplate `json:"errorTemplates,omitempty"`
+
 	// EnablePPROF enable pprof
 	EnablePPROF bool `json:"enablePPROF"`
 	// PPROFAddr pprof addr
 	PPROFAddr string `json:"pprofAddr,omitempty"`
 }
 
-// FilterSpec filter spec
+// AutoBan the client ip is banned for Duration seconds,
+// if the count of the responses with the Statuses exceeds the Threshold within Window seconds.
+type AutoBan struct {
+	// Statuses the response statuses to count, default is all the 4xx statuses
+	Statuses  []int `json:"statuses,omitempty"`
+	Threshold int   `json:"threshold"`
+	Window    int   `json:"window"`
+	Duration  int   `json:"duration"`
+}
+
+// ErrorTemplate the response of the failed requests, like no api matches, a filter rejected or the backend servers are unavailable
+type ErrorTemplate struct {
+	// Match a error type like rate_limited, a status code like 404, a status class like 5xx, or * for all
+	Match string `json:"match"`
+	// StatusCode the status code of the response, default is the status code of the error
+	StatusCode int `json:"statusCode,omitempty"`
+	// Code the error code, default is the error type
+	Code string `json:"code,omitempty"`
+	// ContentType default is application/json; charset=utf-8
+	ContentType string `json:"contentType,omitempty"`
+	// Body the template of the body with the vars {{requestId}}, {{code}}, {{type}}, {{status}} and {{message}}
+	Body string `json:"body"`
+}
+
+// FilterSpec filter spec, the global filters run in the configured order.
+// A global filter listed by a api keeps it's global position, unless the api has ordered filters.
 type FilterSpec struct {
 	Name               string `json:"name"`
 	External           bool   `json:"external,omitempty"`
 	ExternalPluginFile string `json:"externalPluginFile,omitempty"`
+	// Config the default config of the filter, it can be overridden by the apis
+	Config map[string]string `json:"config,omitempty"`
+	// Remote the filter runs in a sidecar process, see the package pkg/filter/sidecar
+	Remote *RemoteFilterSpec `json:"remote,omitempty"`
+}
+
+// RemoteFilterSpec the sidecar of a remote filter
+type RemoteFilterSpec struct {
+	// Addr host:port or unix:/path/to/socket
+	Addr string `json:"addr"`
+	// Timeout timeout of a call in milliseconds, default is 1000
+	Timeout int `json:"timeout,omitempty"`
+	// FailOpen allow the request if the sidecar is unavailable, otherwise the request is rejected with 503
+	FailOpen bool `json:"failOpen,omitempty"`
+	// SendBody send the request body and the response body to the sidecar
+	SendBody bool `json:"sendBody,omitempty"`
+	// Phases the phases calling the sidecar: pre, post, post-err, pre-routing, pre-response and log,
+	// default is pre, post and post-err
+	Phases []string `json:"phases,omitempty"`
 }
 
 // GetCfg returns the conf from external file
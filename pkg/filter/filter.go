@@ -1,11 +1,54 @@
 package filter
 
 import (
+	"time"
+
 	"github.com/valyala/fasthttp"
 )
 
-// Context filter context
+// RequestContext the context of a request, the request phases run once a request,
+// before the api is selected or after all the nodes responded
+type RequestContext interface {
+	GetOriginRequestCtx() *fasthttp.RequestCtx
+	// GetClientIP returns the real client ip, resolved through the trusted proxies
+	GetClientIP() string
+	// GetRequestID returns the id of the request, it's sent to the backends and returned to the client
+	GetRequestID() string
+	// FromTrustedProxy returns true if the request is sent by a trusted proxy
+	FromTrustedProxy() bool
+
+	// GetAPIName returns the name of the matched api, or the url if the api has no name.
+	// It returns empty before the api is selected or if no api matches.
+	GetAPIName() string
+	// GetError returns the error of the request, like no api matches, a filter rejected or the backend server failed
+	GetError() error
+
+	// SetAttr set a attribute of the request, a nil value removes the attribute.
+	// The attributes are shared by all the filters and all the nodes of the request.
+	SetAttr(key string, value interface{})
+	GetAttr(key string) (value interface{}, ok bool)
+	GetStringAttr(key string) string
+	GetIntAttr(key string) int
+	GetBoolAttr(key string) bool
+	// GetAttrs returns a copy of all the attributes
+	GetAttrs() map[string]interface{}
+
+	SetConsumer(consumer string)
+	GetConsumer() string
+
+	// GetFilterConfig returns the config value of the executing filter, the config of the api overrides the global config
+	GetFilterConfig(key string) string
+	// GetFilterConfigs returns a copy of the config of the executing filter
+	GetFilterConfigs() map[string]string
+
+	// GetCORSHeaders returns the cors headers of the matched api, returns nil if the request is not allowed
+	GetCORSHeaders() map[string]string
+}
+
+// Context filter context of a node of the request
 type Context interface {
+	RequestContext
+
 	SetStartAt(startAt int64)
 	SetEndAt(endAt int64)
 	GetStartAt() int64
@@ -16,11 +59,34 @@ type Context interface {
 	GetProxyResponse() *fasthttp.Response
 	NeedMerge() bool
 
-	GetOriginRequestCtx() *fasthttp.RequestCtx
+	// GetClusterName returns the cluster of the node, the server of the node is GetProxyServerAddr
+	GetClusterName() string
+	// GetNodeName returns the name of the node, it's the attrName of the node in the merged response
+	GetNodeName() string
 
 	GetMaxQPS() int
 
+	CheckRateLimit(ip string) (allowed bool, limit int, remaining int, retryAfter time.Duration)
+	GetRateLimitRemaining(ip string) (limit int, remaining int)
+
+	// CheckQuota take a call from the quota of the consumer of the request, it runs once a request
+	CheckQuota(ip string) error
+
+	// AuthenticateByKey returns the consumer of the api key, the consumer already set by the other filters
+	// is only checked by the consumers of the api. The api key is removed from the proxy outer request
+	AuthenticateByKey() (consumer string, err error)
+
+	VerifyJWT() (headers map[string]string, err error)
+	ExtAuth() (statusCode int, headers map[string]string, err error)
+	VerifySignature() (consumer string, err error)
+
+	// ValidateProxyOuterRequest returns true if the request is valid
 	ValidateProxyOuterRequest() bool
+	// GetValidationViolations returns the violations of the request, returns empty if the request is valid
+	GetValidationViolations() []Violation
+
+	// RunScript run the script of the api in the phase pre or post, returns a error if the script rejects the request
+	RunScript(phase string) (statusCode int, err error)
 
 	InBlacklist(ip string) bool
 	InWhitelist(ip string) bool
@@ -46,6 +112,64 @@ type Context interface {
 	GetRecentlyRequestFailureCount(sec int) int
 }
 
+// The attributes published by the builtin filters
+const (
+	// AttrConsumer string, the consumer of the request, set by SetConsumer
+	AttrConsumer = "consumer"
+	// AttrJWTClaims map[string]interface{}, the claims of the verified jwt
+	AttrJWTClaims = "jwt.claims"
+	// AttrJWTSubject string, the sub claim of the verified jwt
+	AttrJWTSubject = "jwt.sub"
+	// AttrJWTChallenge string, the WWW-Authenticate challenge of the request rejected by the jwt verification
+	AttrJWTChallenge = "jwt.challenge"
+	// AttrExtAuthStatus int, the status code responded to the client by the external auth
+	AttrExtAuthStatus = "extAuth.status"
+	// AttrRateLimitLimit int, the limit of the rate limit
+	AttrRateLimitLimit = "rateLimit.limit"
+	// AttrRateLimitRemaining int, the remaining requests of the rate limit
+	AttrRateLimitRemaining = "rateLimit.remaining"
+	// AttrRateLimitRetryAfter int, the seconds to retry after if the request is limited by the rate limit
+	AttrRateLimitRetryAfter = "rateLimit.retryAfter"
+	// AttrViolations int, the count of the violations of the request validation
+	AttrViolations = "validation.violations"
+	// AttrAPI string, the name of the matched api, the url if the api has no name
+	AttrAPI = "api"
+	// AttrClusters []string, the clusters of the nodes of the request, in the order of the nodes
+	AttrClusters = "clusters"
+	// AttrServers []string, the servers of the nodes of the request, empty if the node has no server available
+	AttrServers = "servers"
+	// AttrMocked bool, the response is the mock of the api, because the backend servers failed
+	AttrMocked = "mocked"
+)
+
+var reservedAttrs = map[string]bool{
+	AttrConsumer:            true,
+	AttrJWTClaims:           true,
+	AttrJWTSubject:          true,
+	AttrJWTChallenge:        true,
+	AttrExtAuthStatus:       true,
+	AttrRateLimitLimit:      true,
+	AttrRateLimitRemaining:  true,
+	AttrRateLimitRetryAfter: true,
+	AttrViolations:          true,
+	AttrAPI:                 true,
+	AttrClusters:            true,
+	AttrServers:             true,
+	AttrMocked:              true,
+}
+
+// IsReservedAttr returns true if the attribute is published by the builtin filters
+func IsReservedAttr(key string) bool {
+	return reservedAttrs[key]
+}
+
+// Violation a failed validation of the request
+type Violation struct {
+	// Field the source and name of the value like query.id or header.X-Token, or the json path of the body like $.items[0].name
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
 // Filter filter interface
 type Filter interface {
 	Name() string
@@ -55,6 +179,21 @@ type Filter interface {
 	PostErr(c Context)
 }
 
+// PhaseFilter a filter runs in all the phases of a request:
+// PreRouting -> Pre -> Post or PostErr -> PreResponse -> Log, the Pre, Post and PostErr run once a node.
+// The filters embed BaseFilter are PhaseFilters, the other filters only run in the node phases.
+type PhaseFilter interface {
+	Filter
+
+	// PreRouting execute before the api is selected, only the global filters run in this phase
+	PreRouting(c RequestContext) (statusCode int, err error)
+	// PreResponse execute after the responses of the nodes are merged, before the response is written to the client.
+	// It runs even if the request failed, the response can be changed.
+	PreResponse(c RequestContext) (statusCode int, err error)
+	// Log execute at last with the final response
+	Log(c RequestContext)
+}
+
 // BaseFilter base filter support default implemention
 type BaseFilter struct{}
 
@@ -72,3 +211,18 @@ func (f BaseFilter) Post(c Context) (statusCode int, err error) {
 func (f BaseFilter) PostErr(c Context) {
 
 }
+
+// PreRouting execute before the api is selected
+func (f BaseFilter) PreRouting(c RequestContext) (statusCode int, err error) {
+	return fasthttp.StatusOK, nil
+}
+
+// PreResponse execute before the response is written to the client
+func (f BaseFilter) PreResponse(c RequestContext) (statusCode int, err error) {
+	return fasthttp.StatusOK, nil
+}
+
+// Log execute at last with the final response
+func (f BaseFilter) Log(c RequestContext) {
+
+}
@@ -0,0 +1,122 @@
+package sidecar
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	unixAddrPrefix = "unix:"
+)
+
+// Plugin a filter running in the sidecar process
+type Plugin interface {
+	Pre(req *Request) *Response
+	Post(req *Request) *Response
+	PostErr(req *Request)
+
+	PreRouting(req *Request) *Response
+	PreResponse(req *Request) *Response
+	Log(req *Request)
+}
+
+// BasePlugin allows all the requests, embed it to implement the phases needed only
+type BasePlugin struct{}
+
+// Pre allows the request
+func (p BasePlugin) Pre(req *Request) *Response {
+	return Allow()
+}
+
+// Post allows the response
+func (p BasePlugin) Post(req *Request) *Response {
+	return Allow()
+}
+
+// PostErr does nothing
+func (p BasePlugin) PostErr(req *Request) {
+
+}
+
+// PreRouting allows the request
+func (p BasePlugin) PreRouting(req *Request) *Response {
+	return Allow()
+}
+
+// PreResponse allows the response
+func (p BasePlugin) PreResponse(req *Request) *Response {
+	return Allow()
+}
+
+// Log does nothing
+func (p BasePlugin) Log(req *Request) {
+
+}
+
+// Handler returns the http handler of the plugin
+func Handler(p Plugin) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(Path(PhasePre), handle(p.Pre))
+	mux.HandleFunc(Path(PhasePost), handle(p.Post))
+	mux.HandleFunc(Path(PhasePostErr), handle(func(req *Request) *Response {
+		p.PostErr(req)
+		return Allow()
+	}))
+	mux.HandleFunc(Path(PhasePreRouting), handle(p.PreRouting))
+	mux.HandleFunc(Path(PhasePreResponse), handle(p.PreResponse))
+	mux.HandleFunc(Path(PhaseLog), handle(func(req *Request) *Response {
+		p.Log(req)
+		return Allow()
+	}))
+
+	return mux
+}
+
+func handle(fn func(req *Request) *Response) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		req := &Request{}
+		err := json.NewDecoder(r.Body).Decode(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		res := fn(req)
+		if nil == res {
+			res = Allow()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// Listen listen on the addr, the addr is host:port or unix:/path/to/socket.
+// The exist socket file is removed.
+func Listen(addr string) (net.Listener, error) {
+	if strings.HasPrefix(addr, unixAddrPrefix) {
+		path := strings.TrimPrefix(addr, unixAddrPrefix)
+		os.Remove(path)
+		return net.Listen("unix", path)
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// ListenAndServe serve the plugin on the addr, the addr is the same as the addr of the filter in the gateway config
+func ListenAndServe(addr string, p Plugin) error {
+	l, err := Listen(addr)
+	if err != nil {
+		return err
+	}
+
+	return http.Serve(l, Handler(p))
+}
@@ -0,0 +1,126 @@
+// Package sidecar is the protocol and the SDK of the filters running out of the gateway process.
+//
+// The gateway calls the sidecar by HTTP/1.1 with a json body, over tcp or a unix socket.
+// Each phase of the filter is a POST request: /v1/pre, /v1/post, /v1/post-err,
+// and the phases of the request /v1/pre-routing, /v1/pre-response and /v1/log.
+// The body of the request is a Request, and the body of the response is a Response.
+// The sidecar should response 200 with a Response, all the other status codes are treated as a failed call.
+package sidecar
+
+const (
+	// Version the version of the protocol, it's the prefix of the paths
+	Version = "v1"
+
+	// PhasePre before the request sent to the backend server
+	PhasePre = "pre"
+	// PhasePost after the backend server responded
+	PhasePost = "post"
+	// PhasePostErr the backend server failed, the result is ignored
+	PhasePostErr = "post-err"
+	// PhasePreRouting before the api is selected, only for the global filters
+	PhasePreRouting = "pre-routing"
+	// PhasePreResponse before the response is written to the client, it runs even if the request failed
+	PhasePreResponse = "pre-response"
+	// PhaseLog at last with the final response, the result is ignored
+	PhaseLog = "log"
+)
+
+// Request the request of the gateway
+type Request struct {
+	// Filter the name of the filter in the gateway config
+	Filter string `json:"filter"`
+	Phase  string `json:"phase"`
+	// Config the config of the filter, the config of the api overrides the global config
+	Config map[string]string `json:"config,omitempty"`
+
+	RequestID string `json:"requestId"`
+	ClientIP  string `json:"clientIP"`
+	Consumer  string `json:"consumer,omitempty"`
+	// API the name of the matched api, empty in the pre-routing phase
+	API string `json:"api"`
+	// Cluster the cluster of the node, empty in the phases of the request
+	Cluster string `json:"cluster"`
+	// Node the attrName of the node, empty in the phases of the request
+	Node string `json:"node,omitempty"`
+	// Attrs the attributes of the request set by the filters, the values are formatted as strings
+	Attrs map[string]string `json:"attrs,omitempty"`
+
+	// OriginURI the request uri of the client
+	OriginURI string `json:"originURI"`
+
+	// Method, URI, Headers and Body of the request to the backend server, the URI may be rewritten.
+	// They are the request of the client in the phases of the request.
+	// The Headers keep all the values of the repeated headers in order.
+	// The Body is only sent if the sendBody of the filter is enabled.
+	Method  string              `json:"method"`
+	URI     string              `json:"uri"`
+	Headers map[string][]string `json:"headers,omitempty"`
+	Body    []byte              `json:"body,omitempty"`
+
+	// Response the response of the backend server in the post and post-err phase,
+	// and the response to the client in the pre-response and log phase
+	Response *HTTPResponse `json:"response,omitempty"`
+}
+
+// HTTPResponse the response of the backend server
+type HTTPResponse struct {
+	StatusCode int                 `json:"statusCode"`
+	Headers    map[string][]string `json:"headers,omitempty"`
+	Body       []byte              `json:"body,omitempty"`
+}
+
+// Response the result of the sidecar
+type Response struct {
+	// StatusCode 0 or 2xx means the request is allowed, otherwise the request is rejected with the status code,
+	// a status code not in 4xx and 5xx is replaced by 500
+	StatusCode int `json:"statusCode,omitempty"`
+	// Reason why the request is rejected, it's logged by the gateway
+	Reason string `json:"reason,omitempty"`
+	// Body the response body to the client if the request is rejected
+	Body []byte `json:"body,omitempty"`
+	// ContentType content type of the Body
+	ContentType string `json:"contentType,omitempty"`
+
+	// RequestHeaders headers to set on the request to the backend server, the values replace the old values
+	// and a empty list removes the header. Only used in the pre and pre-routing phase.
+	RequestHeaders map[string][]string `json:"requestHeaders,omitempty"`
+	// ResponseHeaders headers to set on the response to the client, the values replace the old values
+	// and a empty list removes the header. Only used in the post and pre-response phase and when the request is rejected.
+	ResponseHeaders map[string][]string `json:"responseHeaders,omitempty"`
+	// Consumer set the consumer of the request if it's not set by the other filters, it's used by the following filters
+	Consumer string `json:"consumer,omitempty"`
+	// Attrs set the attributes of the request, they are used by the following filters
+	Attrs map[string]string `json:"attrs,omitempty"`
+}
+
+// Header returns the first value of the request header, the name is case sensitive like the keys of Headers
+func (r *Request) Header(name string) string {
+	if values := r.Headers[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// Allow returns a response allows the request
+func Allow() *Response {
+	return &Response{}
+}
+
+// Reject returns a response rejects the request with the status code
+func Reject(statusCode int, reason string) *Response {
+	return &Response{
+		StatusCode: statusCode,
+		Reason:     reason,
+	}
+}
+
+// Allowed returns true if the request is allowed
+func (r *Response) Allowed() bool {
+	return r.StatusCode == 0 || (r.StatusCode >= 200 && r.StatusCode < 300)
+}
+
+// Path returns the path of the phase
+func Path(phase string) string {
+	return "/" + Version + "/" + phase
+}
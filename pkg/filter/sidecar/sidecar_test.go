@@ -0,0 +1,62 @@
+package sidecar
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type denyPlugin struct {
+	BasePlugin
+}
+
+func (p denyPlugin) Pre(req *Request) *Response {
+	if req.Header("X-Token") == "" {
+		return Reject(http.StatusUnauthorized, "missing token")
+	}
+
+	return &Response{
+		RequestHeaders: map[string][]string{"X-User": {req.Config["user"]}},
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler(denyPlugin{})
+
+	cases := []struct {
+		req     *Request
+		allowed bool
+	}{
+		{req: &Request{}, allowed: false},
+		{req: &Request{Headers: map[string][]string{"X-Token": {"t"}}, Config: map[string]string{"user": "u"}}, allowed: true},
+	}
+
+	for _, c := range cases {
+		body, _ := json.Marshal(c.req)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, Path(PhasePre), bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expect 200, but %d", w.Code)
+		}
+
+		res := &Response{}
+		json.Unmarshal(w.Body.Bytes(), res)
+		if res.Allowed() != c.allowed {
+			t.Errorf("expect allowed %v, but %+v", c.allowed, res)
+		}
+
+		if c.allowed && (len(res.RequestHeaders["X-User"]) != 1 || res.RequestHeaders["X-User"][0] != "u") {
+			t.Errorf("expect request header X-User, but %+v", res)
+		}
+	}
+
+	for _, phase := range []string{PhasePost, PhasePostErr, PhasePreRouting, PhasePreResponse, PhaseLog} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, Path(phase), bytes.NewReader([]byte("{}"))))
+		if w.Code != http.StatusOK {
+			t.Errorf("expect 200 of the base %s phase, but %d", phase, w.Code)
+		}
+	}
+}
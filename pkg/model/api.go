@@ -1,11 +1,14 @@
 package model
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"regexp"
-	"strings"
 
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/log"
 	"github.com/valyala/fasthttp"
 )
 
@@ -22,28 +25,19 @@ type Node struct {
 	Rewrite     string        `json:"rewrite, omitempty"`
 	AttrName    string        `json:"attrName, omitempty"`
 	Validations []*Validation `json:"validations, omitempty"`
-}
-
-type ipSegment struct {
-	value []string
-}
+	// BodySchema json schema to validate the request body
+	BodySchema *JSONSchema `json:"bodySchema,omitempty"`
 
-func parseFrom(value string) *ipSegment {
-	ip := &ipSegment{}
-	ip.value = strings.Split(value, ".")
-	return ip
+	rewrite string // rewrite template of the path template api
 }
 
-func (ip *ipSegment) matches(value string) bool {
-	tmp := strings.Split(value, ".")
-
-	for index, v := range ip.value {
-		if v != "*" && v != tmp[index] {
-			return false
-		}
-	}
-
-	return true
+// APIFilter a filter of the api filter chain
+type APIFilter struct {
+	Name string `json:"name"`
+	// Disabled the filter is removed from the chain of the api
+	Disabled bool `json:"disabled,omitempty"`
+	// Config overrides the config of the global filter
+	Config map[string]string `json:"config,omitempty"`
 }
 
 // AccessControl access control
@@ -51,37 +45,46 @@ type AccessControl struct {
 	Whitelist []string `json:"whitelist, omitempty"`
 	Blacklist []string `json:"blacklist, omitempty"`
 
-	parsedWhitelist []*ipSegment
-	parsedBlacklist []*ipSegment
-}
-
-// Mock mock
-type Mock struct {
-	Value         string             `json:"value"`
-	ContentType   string             `json:"contentType, omitempty"`
-	Headers       []*MockHeader      `json:"headers, omitempty"`
-	Cookies       []string           `json:"cookies, omitempty"`
-	ParsedCookies []*fasthttp.Cookie `json:"-"`
-}
-
-// MockHeader header
-type MockHeader struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	whitelist *ipList
+	blacklist *ipList
 }
 
 // API a api define
 type API struct {
-	Name          string         `json:"name, omitempty"`
-	URL           string         `json:"url"`
-	Method        string         `json:"method"`
-	Domain        string         `json:"domain, omitempty"`
-	Status        int            `json:"status, omitempty"`
-	AccessControl *AccessControl `json:"accessControl, omitempty"`
-	Mock          *Mock          `json:"mock, omitempty"`
-	Nodes         []*Node        `json:"nodes"`
-	Desc          string         `json:"desc, omitempty"`
-	Pattern       *regexp.Regexp `json:"-"`
+	Name   string `json:"name, omitempty"`
+	URL    string `json:"url"`
+	Method string `json:"method"`
+	// PathTemplate the url is a path template like /users/{id}, otherwise the url is a regexp
+	PathTemplate bool `json:"pathTemplate,omitempty"`
+	// Domain deprecated, use VHost instead. The api matches all the requests of the domain
+	Domain string `json:"domain, omitempty"`
+	// VHost name of the vhost owning the api, the api belongs to the default vhost if it's empty
+	VHost         string           `json:"vhost,omitempty"`
+	Status        int              `json:"status, omitempty"`
+	AccessControl *AccessControl   `json:"accessControl, omitempty"`
+	Mock          *Mock            `json:"mock, omitempty"`
+	RateLimits    []*RateLimit     `json:"rateLimits,omitempty"`
+	Quota         *APIQuota        `json:"quota,omitempty"`
+	Consumers     *ConsumerControl `json:"consumers,omitempty"`
+	JWT           *JWTRule         `json:"jwt,omitempty"`
+	ExtAuth       *ExtAuth         `json:"extAuth,omitempty"`
+	Signature     *SignatureRule   `json:"signature,omitempty"`
+	CORS          *CORS            `json:"cors,omitempty"`
+	BodySchema    *JSONSchema      `json:"bodySchema,omitempty"`
+	// Script the scripts run by the script filter
+	Script *APIScript `json:"script,omitempty"`
+	// ErrorTemplates the responses of the failed requests of the api, they are used before the global templates
+	ErrorTemplates []*conf.ErrorTemplate `json:"errorTemplates,omitempty"`
+	// Filters the filter chain of the api, the global filters are used if it's empty
+	Filters []*APIFilter `json:"filters,omitempty"`
+	// OrderedFilters the listed filters run in the listed order after the global filters not listed,
+	// otherwise the listed global filters keep their global position
+	OrderedFilters bool           `json:"orderedFilters,omitempty"`
+	Nodes          []*Node        `json:"nodes"`
+	Desc           string         `json:"desc, omitempty"`
+	Pattern        *regexp.Regexp `json:"-"`
+
+	segments []*pathSegment // nil if the url is a regexp
 }
 
 // UnMarshalAPI unmarshal
@@ -89,7 +92,7 @@ func UnMarshalAPI(data []byte) *API {
 	v := &API{}
 	json.Unmarshal(data, v)
 
-	if v.Mock != nil && v.Mock.Value == "" {
+	if v.Mock != nil && v.Mock.Value == "" && len(v.Mock.Cases) == 0 {
 		v.Mock = nil
 	}
 
@@ -103,7 +106,7 @@ func UnMarshalAPIFromReader(r io.Reader) (*API, error) {
 	decoder := json.NewDecoder(r)
 	err := decoder.Decode(v)
 
-	if v.Mock != nil && v.Mock.Value == "" {
+	if v.Mock != nil && v.Mock.Value == "" && len(v.Mock.Cases) == 0 {
 		v.Mock = nil
 	}
 
@@ -118,94 +121,145 @@ func NewAPI(url string, nodes []*Node) *API {
 	}
 }
 
-// Parse parse
-func (a *API) Parse() {
-	a.Pattern = regexp.MustCompile(a.URL)
-	for _, n := range a.Nodes {
-		if nil != n.Validations {
-			for _, v := range n.Validations {
-				v.ParseValidation()
-			}
+// Check check the vhost name, scripts, mock, rate limits, access control, validations and body schemas of the api
+func (a *API) Check() error {
+	err := checkVHostName(a.VHost)
+	if nil != err {
+		return err
+	}
+
+	if nil != a.Script {
+		err := a.Script.Check()
+		if nil != err {
+			return err
+		}
+	}
+
+	if nil != a.Mock {
+		err := a.Mock.Check()
+		if nil != err {
+			return err
 		}
 	}
 
-	if nil != a.Mock && nil != a.Mock.Cookies && len(a.Mock.Cookies) > 0 {
-		a.Mock.ParsedCookies = make([]*fasthttp.Cookie, len(a.Mock.Cookies))
-		for index, c := range a.Mock.Cookies {
-			ck := &fasthttp.Cookie{}
-			ck.Parse(c)
-			a.Mock.ParsedCookies[index] = ck
+	for index, l := range a.RateLimits {
+		if l.Rate <= 0 {
+			return fmt.Errorf("rate limit %d: rate must be greater than 0", index)
+		}
+
+		if l.Burst < 0 {
+			return fmt.Errorf("rate limit %d: burst must not be less than 0", index)
 		}
 	}
 
 	if nil != a.AccessControl {
-		if a.AccessControl.Blacklist != nil {
-			a.AccessControl.parsedBlacklist = make([]*ipSegment, len(a.AccessControl.Blacklist))
-			for index, ip := range a.AccessControl.Blacklist {
-				a.AccessControl.parsedBlacklist[index] = parseFrom(ip)
+		err := checkIPList(a.AccessControl.Whitelist)
+		if nil != err {
+			return fmt.Errorf("whitelist: %s", err.Error())
+		}
+
+		err = checkIPList(a.AccessControl.Blacklist)
+		if nil != err {
+			return fmt.Errorf("blacklist: %s", err.Error())
+		}
+	}
+
+	if nil != a.BodySchema {
+		err := a.BodySchema.Parse()
+		if nil != err {
+			return fmt.Errorf("body schema: %s", err.Error())
+		}
+	}
+
+	for _, n := range a.Nodes {
+		for _, v := range n.Validations {
+			err := v.Check()
+			if nil != err {
+				return err
 			}
 		}
 
-		if a.AccessControl.Whitelist != nil {
-			a.AccessControl.parsedWhitelist = make([]*ipSegment, len(a.AccessControl.Whitelist))
-			for index, ip := range a.AccessControl.Whitelist {
-				a.AccessControl.parsedWhitelist[index] = parseFrom(ip)
+		if nil != n.BodySchema {
+			err := n.BodySchema.Parse()
+			if nil != err {
+				return fmt.Errorf("body schema of <%s>: %s", n.ClusterName, err.Error())
 			}
 		}
 	}
+
+	return nil
 }
 
-// AccessCheckBlacklist check blacklist
-func (a *API) AccessCheckBlacklist(ip string) bool {
-	if a.AccessControl == nil || a.AccessControl.parsedBlacklist == nil {
-		return false
-	}
+// Parse parse
+func (a *API) Parse() {
+	a.parseURL()
+
+	for _, n := range a.Nodes {
+		n.rewrite = ""
+		if nil != a.segments {
+			n.rewrite = rewriteTemplate(n.Rewrite)
+		}
 
-	for _, i := range a.AccessControl.parsedBlacklist {
-		if i.matches(ip) {
-			return true
+		if nil != n.Validations {
+			for _, v := range n.Validations {
+				v.ParseValidation()
+			}
 		}
+
+		n.BodySchema = parseBodySchema(n.BodySchema, fmt.Sprintf("%s/%s", a.URL, n.ClusterName))
 	}
 
-	return false
-}
+	a.BodySchema = parseBodySchema(a.BodySchema, a.URL)
 
-// AccessCheckWhitelist check whitelist
-func (a *API) AccessCheckWhitelist(ip string) bool {
-	if a.AccessControl == nil || a.AccessControl.parsedWhitelist == nil {
-		return true
+	if nil != a.Mock {
+		a.Mock.parse(a.URL)
 	}
 
-	for _, i := range a.AccessControl.parsedWhitelist {
-		if i.matches(ip) {
-			return true
-		}
+	if nil != a.CORS {
+		a.CORS.parse()
 	}
 
-	return false
-}
+	if nil != a.Script {
+		a.Script.parse(a.URL)
+	}
 
-// RenderMock dender mock response
-func (a *API) RenderMock(ctx *fasthttp.RequestCtx) {
-	if a.Mock == nil {
-		return
+	for index, l := range a.RateLimits {
+		l.parse(fmt.Sprintf("ratelimit/%s/%d", a.key(), index))
 	}
 
-	ctx.Response.Header.SetContentType(a.Mock.ContentType)
+	if nil != a.AccessControl {
+		if a.AccessControl.Blacklist != nil {
+			a.AccessControl.blacklist = parseIPList(a.AccessControl.Blacklist)
+		}
 
-	if a.Mock.Headers != nil && len(a.Mock.Headers) > 0 {
-		for _, header := range a.Mock.Headers {
-			ctx.Response.Header.Add(header.Name, header.Value)
+		if a.AccessControl.Whitelist != nil {
+			a.AccessControl.whitelist = parseIPList(a.AccessControl.Whitelist)
 		}
 	}
+}
+
+// parseURL the url is a path template like /users/{id} or a regexp
+func (a *API) parseURL() {
+	a.segments = nil
 
-	if a.Mock.ParsedCookies != nil && len(a.Mock.ParsedCookies) > 0 {
-		for _, ck := range a.Mock.ParsedCookies {
-			ctx.Response.Header.SetCookie(ck)
+	if a.PathTemplate {
+		segments, pattern, err := parsePathTemplate(a.URL)
+		if err == nil {
+			a.segments = segments
+			a.Pattern = pattern
+			return
 		}
+
+		log.Warnf("meta: api url <%s> is not a valid path template and used as a regexp, errors:\n%+v",
+			a.URL,
+			err)
 	}
 
-	ctx.WriteString(a.Mock.Value)
+	a.Pattern = regexp.MustCompile(a.URL)
+}
+
+func (a *API) key() string {
+	return getAPIKey(a.VHost, a.URL, a.Method)
 }
 
 // Marshal marshal
@@ -219,23 +273,54 @@ func (a *API) getNodeURL(req *fasthttp.Request, node *Node) string {
 		return ""
 	}
 
-	return a.Pattern.ReplaceAllString(string(req.URI().RequestURI()), node.Rewrite)
-}
+	if nil == a.segments {
+		return a.Pattern.ReplaceAllString(string(req.URI().RequestURI()), node.Rewrite)
+	}
+
+	uri := req.URI().RequestURI()
+	match := a.Pattern.FindSubmatchIndex(uri)
+	if nil == match {
+		return string(uri)
+	}
 
-func (a *API) matches(req *fasthttp.Request) bool {
-	return a.isUp() && (a.isDomainMatches(req) || (a.isMethodMatches(req) && a.isURIMatches(req)))
+	// the query string of the path template api is kept
+	rewrite := a.Pattern.Expand(nil, []byte(node.rewrite), uri, match)
+	query := req.URI().QueryString()
+	if len(query) > 0 {
+		if bytes.IndexByte(rewrite, '?') >= 0 {
+			rewrite = append(rewrite, '&')
+		} else {
+			rewrite = append(rewrite, '?')
+		}
+		rewrite = append(rewrite, query...)
+	}
+
+	return string(rewrite)
 }
 
 func (a *API) isUp() bool {
 	return a.Status == APIStatusUp
 }
 
-func (a *API) isMethodMatches(req *fasthttp.Request) bool {
-	return a.Method == "*" || strings.ToUpper(string(req.Header.Method())) == a.Method
-}
+// matchURI returns the groups of the pattern matched the request uri, returns nil if not matches.
+// The groups are copied, because the uri buffer of the request may be reused.
+func (a *API) matchURI(req *fasthttp.Request) PathParams {
+	if nil == a.Pattern {
+		return nil
+	}
 
-func (a *API) isURIMatches(req *fasthttp.Request) bool {
-	return a.Pattern.Match(req.URI().RequestURI())
+	matches := a.Pattern.FindSubmatch(req.URI().RequestURI())
+	if nil == matches {
+		return nil
+	}
+
+	params := make(PathParams, len(matches))
+	for i, value := range matches {
+		if nil != value {
+			params[i] = append([]byte{}, value...)
+		}
+	}
+	return params
 }
 
 func (a *API) isDomainMatches(req *fasthttp.Request) bool {
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	headerOrigin                        = "Origin"
+	headerVary                          = "Vary"
+	headerAccessControlRequestMethod    = "Access-Control-Request-Method"
+	headerAccessControlRequestHeaders   = "Access-Control-Request-Headers"
+	headerAccessControlAllowOrigin      = "Access-Control-Allow-Origin"
+	headerAccessControlAllowMethods     = "Access-Control-Allow-Methods"
+	headerAccessControlAllowHeaders     = "Access-Control-Allow-Headers"
+	headerAccessControlAllowCredentials = "Access-Control-Allow-Credentials"
+	headerAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
+	headerAccessControlMaxAge           = "Access-Control-Max-Age"
+)
+
+// CORS the cross-origin resource sharing setting of a api
+type CORS struct {
+	// AllowOrigins allowed origins, support wildcard like https://*.example.com, * means all origins
+	AllowOrigins []string `json:"allowOrigins,omitempty"`
+	// AllowMethods allowed methods for preflight, default is the method of the api
+	AllowMethods []string `json:"allowMethods,omitempty"`
+	// AllowHeaders allowed headers for preflight, default is the request headers of preflight
+	AllowHeaders     []string `json:"allowHeaders,omitempty"`
+	ExposeHeaders    []string `json:"exposeHeaders,omitempty"`
+	AllowCredentials bool     `json:"allowCredentials,omitempty"`
+	// MaxAge seconds to cache the preflight result
+	MaxAge int `json:"maxAge,omitempty"`
+
+	anyOrigin bool
+	origins   []*regexp.Regexp
+}
+
+func (c *CORS) parse() {
+	c.anyOrigin = false
+	c.origins = nil
+
+	for _, origin := range c.AllowOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+			continue
+		}
+
+		pattern := strings.Replace(regexp.QuoteMeta(origin), `\*`, `[^/]*`, -1)
+		c.origins = append(c.origins, regexp.MustCompile("^"+pattern+"$"))
+	}
+}
+
+func (c *CORS) allowOrigin(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+
+	for _, p := range c.origins {
+		if p.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headers returns the cors headers of the actual request,
+// returns nil if the request is not a cors request or the origin not allowed
+func (c *CORS) headers(req *fasthttp.Request) map[string]string {
+	origin := string(req.Header.Peek(headerOrigin))
+	if origin == "" || !c.allowOrigin(origin) {
+		return nil
+	}
+
+	headers := make(map[string]string)
+
+	// the wildcard can't be used with credentials
+	if c.anyOrigin && !c.AllowCredentials {
+		headers[headerAccessControlAllowOrigin] = "*"
+	} else {
+		headers[headerAccessControlAllowOrigin] = origin
+		headers[headerVary] = headerOrigin
+	}
+
+	if c.AllowCredentials {
+		headers[headerAccessControlAllowCredentials] = "true"
+	}
+
+	if len(c.ExposeHeaders) > 0 {
+		headers[headerAccessControlExposeHeaders] = strings.Join(c.ExposeHeaders, ", ")
+	}
+
+	return headers
+}
+
+func (c *CORS) preflightHeaders(req *fasthttp.Request, api *API) map[string]string {
+	headers := c.headers(req)
+	if nil == headers {
+		return nil
+	}
+
+	delete(headers, headerAccessControlExposeHeaders)
+
+	if len(c.AllowMethods) > 0 {
+		headers[headerAccessControlAllowMethods] = strings.Join(c.AllowMethods, ", ")
+	} else if api.Method == "*" {
+		headers[headerAccessControlAllowMethods] = string(req.Header.Peek(headerAccessControlRequestMethod))
+	} else {
+		headers[headerAccessControlAllowMethods] = api.Method
+	}
+
+	if len(c.AllowHeaders) > 0 {
+		headers[headerAccessControlAllowHeaders] = strings.Join(c.AllowHeaders, ", ")
+	} else if value := req.Header.Peek(headerAccessControlRequestHeaders); len(value) > 0 {
+		headers[headerAccessControlAllowHeaders] = string(value)
+	}
+
+	if c.MaxAge > 0 {
+		headers[headerAccessControlMaxAge] = strconv.Itoa(c.MaxAge)
+	}
+
+	return headers
+}
+
+// IsPreflight returns true if the request is a cors preflight request
+func IsPreflight(req *fasthttp.Request) bool {
+	return string(req.Header.Method()) == "OPTIONS" &&
+		len(req.Header.Peek(headerOrigin)) > 0 &&
+		len(req.Header.Peek(headerAccessControlRequestMethod)) > 0
+}
+
+// GetCORSHeaders returns the cors headers of the actual request
+func (a *API) GetCORSHeaders(req *fasthttp.Request) map[string]string {
+	if nil == a.CORS {
+		return nil
+	}
+
+	return a.CORS.headers(req)
+}
+
+// Preflight find the api of the preflight request, returns the api and the headers to response.
+// Returns nil api if no api with cors matches the request,
+// and returns nil headers if the origin not allowed.
+func (r *RouteTable) Preflight(req *fasthttp.Request) (*API, map[string]string) {
+	method := strings.ToUpper(string(req.Header.Peek(headerAccessControlRequestMethod)))
+
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	api, _ := r.router.find(req, method)
+	if nil == api || nil == api.CORS {
+		return nil, nil
+	}
+
+	return api, api.CORS.preflightHeaders(req, api)
+}
@@ -0,0 +1,235 @@
+package model
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/log"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// HeaderOriginalMethod header of the origin request method send to the auth server
+	HeaderOriginalMethod = "X-Original-Method"
+	// HeaderOriginalURI header of the origin request uri send to the auth server
+	HeaderOriginalURI = "X-Original-URI"
+
+	maxExtAuthCacheSize = 10240
+)
+
+var (
+	// ErrExtAuthUnavailable auth server unavailable
+	ErrExtAuthUnavailable = errors.New("Auth server unavailable")
+	// ErrExtAuthDenied auth server deny the request
+	ErrExtAuthDenied = errors.New("Auth server denied")
+)
+
+// HTTPDoFunc send a http request to the addr
+type HTTPDoFunc func(req *fasthttp.Request, addr string) (*fasthttp.Response, error)
+
+// ExtAuth the external authorization setting of a api.
+// The request is allowed if the auth server returns 2xx, the client gets 401, 403 and 429 of the auth server,
+// the other status codes, like the redirects of the auth server, are replaced by 403.
+type ExtAuth struct {
+	// Cluster the auth server cluster
+	Cluster string `json:"cluster"`
+	// Path the path of the auth request, the method is GET
+	Path string `json:"path"`
+	// SendMethod send the origin request method in the X-Original-Method header
+	SendMethod bool `json:"sendMethod,omitempty"`
+	// SendPath send the origin request uri in the X-Original-URI header
+	SendPath bool `json:"sendPath,omitempty"`
+	// Headers origin request headers send to the auth server
+	Headers []string `json:"headers,omitempty"`
+	// ResponseHeaders auth response headers copy to the backend server request
+	ResponseHeaders []string `json:"responseHeaders,omitempty"`
+	// CacheTTL seconds to cache the decision of the auth server, 0 means no cache
+	CacheTTL int `json:"cacheTTL,omitempty"`
+
+	sync.RWMutex
+	cache map[string]*extAuthDecision
+}
+
+type extAuthDecision struct {
+	statusCode int
+	headers    map[string]string
+	expireAt   time.Time
+}
+
+func (e *ExtAuth) newAuthRequest(req *fasthttp.Request, addr string) *fasthttp.Request {
+	authReq := fasthttp.AcquireRequest()
+	authReq.Header.SetMethod("GET")
+	authReq.SetRequestURI(e.Path)
+	authReq.SetHost(addr)
+
+	if e.SendMethod {
+		authReq.Header.SetBytesV(HeaderOriginalMethod, req.Header.Method())
+	}
+
+	if e.SendPath {
+		authReq.Header.SetBytesV(HeaderOriginalURI, req.RequestURI())
+	}
+
+	for _, h := range e.Headers {
+		if value := req.Header.Peek(h); len(value) > 0 {
+			authReq.Header.SetBytesV(h, value)
+		}
+	}
+
+	return authReq
+}
+
+// cacheKey the decision is cached by the parts of the request send to the auth server
+func (e *ExtAuth) cacheKey(req *fasthttp.Request) string {
+	h := sha1.New()
+
+	if e.SendMethod {
+		h.Write(req.Header.Method())
+	}
+	h.Write([]byte{0})
+
+	if e.SendPath {
+		h.Write(req.RequestURI())
+	}
+
+	for _, name := range e.Headers {
+		h.Write([]byte{0})
+		h.Write(req.Header.Peek(name))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (e *ExtAuth) getCached(key string, now time.Time) *extAuthDecision {
+	e.RLock()
+	defer e.RUnlock()
+
+	decision, ok := e.cache[key]
+	if !ok || now.After(decision.expireAt) {
+		return nil
+	}
+
+	return decision
+}
+
+func (e *ExtAuth) addCached(key string, decision *extAuthDecision, now time.Time) {
+	e.Lock()
+	defer e.Unlock()
+
+	if nil == e.cache {
+		e.cache = make(map[string]*extAuthDecision)
+	}
+
+	if len(e.cache) >= maxExtAuthCacheSize {
+		for k, value := range e.cache {
+			if now.After(value.expireAt) {
+				delete(e.cache, k)
+			}
+		}
+
+		// all decisions are not expired, drop the cache
+		if len(e.cache) >= maxExtAuthCacheSize {
+			e.cache = make(map[string]*extAuthDecision)
+		}
+	}
+
+	e.cache[key] = decision
+}
+
+func (e *ExtAuth) doAuth(req *fasthttp.Request, addr string, do HTTPDoFunc) (*extAuthDecision, error) {
+	authReq := e.newAuthRequest(req, addr)
+	defer fasthttp.ReleaseRequest(authReq)
+
+	res, err := do(authReq, addr)
+	if nil != res {
+		defer fasthttp.ReleaseResponse(res)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode() >= fasthttp.StatusInternalServerError {
+		return nil, ErrExtAuthUnavailable
+	}
+
+	decision := &extAuthDecision{
+		statusCode: res.StatusCode(),
+	}
+
+	if decision.allowed() && len(e.ResponseHeaders) > 0 {
+		decision.headers = make(map[string]string, len(e.ResponseHeaders))
+		for _, h := range e.ResponseHeaders {
+			decision.headers[h] = string(res.Header.Peek(h))
+		}
+	}
+
+	return decision, nil
+}
+
+func (d *extAuthDecision) allowed() bool {
+	return d.statusCode >= fasthttp.StatusOK && d.statusCode < fasthttp.StatusMultipleChoices
+}
+
+// ExtAuth ask the auth server whether the request is allowed, returns the headers copy to the backend server.
+// The req is the request of the client, not rewritten by the nodes.
+// Returns the status code to response to client if the request is denied.
+func (r *RouteTable) ExtAuth(api *API, req *fasthttp.Request, do HTTPDoFunc) (int, map[string]string, error) {
+	e := api.ExtAuth
+	if nil == e {
+		return http.StatusOK, nil, nil
+	}
+
+	now := time.Now()
+
+	var key string
+	if e.CacheTTL > 0 {
+		key = e.cacheKey(req)
+		if decision := e.getCached(key, now); nil != decision {
+			return decision.result()
+		}
+	}
+
+	r.rwLock.RLock()
+	var svr *Server
+	if cluster, ok := r.clusters[e.Cluster]; ok {
+		svr = r.doSelectServer(req, cluster)
+	}
+	r.rwLock.RUnlock()
+
+	if nil == svr {
+		return http.StatusServiceUnavailable, nil, ErrExtAuthUnavailable
+	}
+
+	decision, err := e.doAuth(req, svr.Addr, do)
+	if err != nil {
+		log.Warnf("filter: ext auth failed, target=<%s> errors:\n%+v",
+			svr.Addr,
+			err)
+		return http.StatusServiceUnavailable, nil, ErrExtAuthUnavailable
+	}
+
+	if e.CacheTTL > 0 {
+		decision.expireAt = now.Add(time.Duration(e.CacheTTL) * time.Second)
+		e.addCached(key, decision, now)
+	}
+
+	return decision.result()
+}
+
+func (d *extAuthDecision) result() (int, map[string]string, error) {
+	if !d.allowed() {
+		switch d.statusCode {
+		case fasthttp.StatusUnauthorized, fasthttp.StatusForbidden, fasthttp.StatusTooManyRequests:
+			return d.statusCode, nil, ErrExtAuthDenied
+		}
+
+		return fasthttp.StatusForbidden, nil, ErrExtAuthDenied
+	}
+
+	return d.statusCode, d.headers, nil
+}
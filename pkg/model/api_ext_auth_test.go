@@ -0,0 +1,112 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestExtAuth(t *testing.T) {
+	cluster, _ := NewCluster("auth", "ROUNDROBIN")
+	svr := &Server{Addr: "127.0.0.1:8081"}
+	cluster.bind(svr)
+
+	r := &RouteTable{
+		rwLock:   &sync.RWMutex{},
+		clusters: map[string]*Cluster{cluster.Name: cluster},
+		svrs:     map[string]*Server{svr.Addr: svr},
+	}
+
+	api := &API{
+		ExtAuth: &ExtAuth{
+			Cluster:         "auth",
+			Path:            "/check",
+			SendMethod:      true,
+			SendPath:        true,
+			Headers:         []string{"Authorization"},
+			ResponseHeaders: []string{"X-User"},
+			CacheTTL:        60,
+		},
+	}
+
+	calls := 0
+	do := func(req *fasthttp.Request, addr string) (*fasthttp.Response, error) {
+		calls++
+		if addr != svr.Addr || string(req.RequestURI()) != "/check" {
+			t.Errorf("unexpected auth request %s %s", addr, req.RequestURI())
+		}
+
+		if string(req.Header.Peek(HeaderOriginalURI)) != "/users/1?a=b" || string(req.Header.Peek(HeaderOriginalMethod)) != "POST" {
+			t.Errorf("unexpected origin request %s %s", req.Header.Peek(HeaderOriginalMethod), req.Header.Peek(HeaderOriginalURI))
+		}
+
+		res := fasthttp.AcquireResponse()
+		if string(req.Header.Peek("Authorization")) == "ok" {
+			res.Header.Set("X-User", "u1")
+		} else {
+			res.SetStatusCode(fasthttp.StatusForbidden)
+		}
+
+		return res, nil
+	}
+
+	req := &fasthttp.Request{}
+	req.Header.SetMethod("POST")
+	req.SetRequestURI("/users/1?a=b")
+	req.Header.Set("Authorization", "ok")
+
+	for i := 0; i < 2; i++ {
+		statusCode, headers, err := r.ExtAuth(api, req, do)
+		if err != nil || statusCode != fasthttp.StatusOK || headers["X-User"] != "u1" {
+			t.Fatalf("expect allowed, but %d %+v %+v", statusCode, headers, err)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("expect the decision cached, but %d calls", calls)
+	}
+
+	req.Header.Set("Authorization", "bad")
+	if statusCode, _, err := r.ExtAuth(api, req, do); err != ErrExtAuthDenied || statusCode != fasthttp.StatusForbidden {
+		t.Errorf("expect denied, but %d %+v", statusCode, err)
+	}
+
+	failed := func(req *fasthttp.Request, addr string) (*fasthttp.Response, error) {
+		return nil, errors.New("unreachable")
+	}
+	api.ExtAuth.CacheTTL = 0
+	if statusCode, _, err := r.ExtAuth(api, req, failed); err != ErrExtAuthUnavailable || statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("expect unavailable, but %d %+v", statusCode, err)
+	}
+
+	// only 401, 403 and 429 are forwarded to the client
+	for _, c := range []struct {
+		auth   int
+		expect int
+	}{
+		{fasthttp.StatusUnauthorized, fasthttp.StatusUnauthorized},
+		{fasthttp.StatusTooManyRequests, fasthttp.StatusTooManyRequests},
+		{fasthttp.StatusFound, fasthttp.StatusForbidden},
+		{fasthttp.StatusNotModified, fasthttp.StatusForbidden},
+		{fasthttp.StatusContinue, fasthttp.StatusForbidden},
+		{fasthttp.StatusNotFound, fasthttp.StatusForbidden},
+	} {
+		status := func(req *fasthttp.Request, addr string) (*fasthttp.Response, error) {
+			res := fasthttp.AcquireResponse()
+			res.SetStatusCode(c.auth)
+			res.Header.Set("Location", "http://evil.example.com")
+			return res, nil
+		}
+
+		if statusCode, _, err := r.ExtAuth(api, req, status); err != ErrExtAuthDenied || statusCode != c.expect {
+			t.Errorf("auth server %d: expect denied with %d, but %d %+v", c.auth, c.expect, statusCode, err)
+		}
+	}
+
+	api.ExtAuth.Cluster = "none"
+	if _, _, err := r.ExtAuth(api, req, do); err != ErrExtAuthUnavailable {
+		t.Errorf("expect unavailable without cluster, but %+v", err)
+	}
+}
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/fagongzi/log"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasttemplate"
+)
+
+const (
+	mockTemplateStartTag = "{{"
+	mockTemplateEndTag   = "}}"
+
+	// maxMockDelay the max delay of the mock response, every delayed response holds a worker
+	maxMockDelay = 10 * time.Second
+)
+
+// headerValueReplacer removes the CR and LF of the rendered header values, prevents the response splitting
+var headerValueReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// Mock mock
+type Mock struct {
+	Value         string             `json:"value"`
+	ContentType   string             `json:"contentType, omitempty"`
+	Headers       []*MockHeader      `json:"headers, omitempty"`
+	Cookies       []string           `json:"cookies, omitempty"`
+	ParsedCookies []*fasthttp.Cookie `json:"-"`
+	// StatusCode status code of the mock response, default is 200
+	StatusCode int `json:"statusCode,omitempty"`
+	// Delay milliseconds to delay the mock response, at most 10 seconds
+	Delay int `json:"delay,omitempty"`
+	// Template render the value and headers with the request variables,
+	// like {{query.id}}, {{header.X-Token}}, {{cookie.session}}, {{path.1}}, {{method}} and {{uri}}.
+	// The values in the body are escaped by the content type, json and html(xml) are escaped.
+	Template bool `json:"template,omitempty"`
+	// Cases the mock of the first case whose conditions all matches the request is used,
+	// the mock itself is used if no case matches
+	Cases []*MockCase `json:"cases,omitempty"`
+
+	valueTemplate   *fasttemplate.Template
+	headerTemplates []*fasttemplate.Template
+}
+
+// MockHeader header
+type MockHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// MockCase a conditional mock
+type MockCase struct {
+	// Conditions routing expressions like $query_type == error, all of them must be matched
+	Conditions []string `json:"conditions"`
+	Mock       *Mock    `json:"mock"`
+
+	exprs routingAnd
+}
+
+func (m *Mock) parse(owner string) {
+	m.ParsedCookies = nil
+	if len(m.Cookies) > 0 {
+		m.ParsedCookies = make([]*fasthttp.Cookie, len(m.Cookies))
+		for index, c := range m.Cookies {
+			ck := &fasthttp.Cookie{}
+			ck.Parse(c)
+			m.ParsedCookies[index] = ck
+		}
+	}
+
+	m.valueTemplate = nil
+	m.headerTemplates = nil
+	if m.Template {
+		err := m.parseTemplates()
+		if err != nil {
+			m.valueTemplate = nil
+			m.headerTemplates = nil
+			log.Warnf("meta: mock template of <%s> is invalid and not rendered, errors:\n%+v",
+				owner,
+				err)
+		}
+	}
+
+	for _, c := range m.Cases {
+		err := c.parse()
+		if err != nil {
+			log.Warnf("meta: mock case of <%s> is invalid and ignored, conditions=<%v> errors:\n%+v",
+				owner,
+				c.Conditions,
+				err)
+			continue
+		}
+
+		c.Mock.parse(owner)
+	}
+}
+
+// Check check the status code, the templates and the cases of the mock
+func (m *Mock) Check() error {
+	if m.StatusCode != 0 && (m.StatusCode < 100 || m.StatusCode > 599) {
+		return fmt.Errorf("invalid mock status code: %d", m.StatusCode)
+	}
+
+	if m.Template {
+		err := m.parseTemplates()
+		if err != nil {
+			return fmt.Errorf("invalid mock template: %s", err.Error())
+		}
+	}
+
+	for _, c := range m.Cases {
+		err := c.parse()
+		if err != nil {
+			return fmt.Errorf("invalid mock case %v: %s", c.Conditions, err.Error())
+		}
+
+		err = c.Mock.Check()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Mock) parseTemplates() error {
+	m.headerTemplates = nil
+
+	t, err := fasttemplate.NewTemplate(m.Value, mockTemplateStartTag, mockTemplateEndTag)
+	if err != nil {
+		return err
+	}
+	m.valueTemplate = t
+
+	for _, header := range m.Headers {
+		t, err := fasttemplate.NewTemplate(header.Value, mockTemplateStartTag, mockTemplateEndTag)
+		if err != nil {
+			return err
+		}
+		m.headerTemplates = append(m.headerTemplates, t)
+	}
+
+	return nil
+}
+
+func (c *MockCase) parse() error {
+	c.exprs = nil
+
+	if nil == c.Mock {
+		return fmt.Errorf("missing mock")
+	}
+
+	var exprs routingAnd
+	for _, condition := range c.Conditions {
+		expr, err := parseRoutingExpr(condition)
+		if err != nil {
+			return err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	c.exprs = exprs
+	return nil
+}
+
+// matches returns true if all the conditions matches, the invalid case never matches
+func (c *MockCase) matches(ctx *requestContext) bool {
+	return len(c.exprs) > 0 && c.exprs.eval(ctx)
+}
+
+func (m *Mock) selectMock(ctx *requestContext) *Mock {
+	for _, c := range m.Cases {
+		if c.matches(ctx) {
+			return c.Mock
+		}
+	}
+
+	return m
+}
+
+func (m *Mock) render(ctx *fasthttp.RequestCtx, vars *requestContext) {
+	if m.Delay > 0 {
+		delay := time.Duration(m.Delay) * time.Millisecond
+		if delay > maxMockDelay {
+			delay = maxMockDelay
+		}
+		time.Sleep(delay)
+	}
+
+	if m.ContentType != "" {
+		ctx.Response.Header.SetContentType(m.ContentType)
+	}
+
+	for index, header := range m.Headers {
+		value := header.Value
+		if nil != m.headerTemplates {
+			value = m.headerTemplates[index].ExecuteFuncString(vars.writeMockVar)
+		}
+
+		ctx.Response.Header.Add(header.Name, headerValueReplacer.Replace(value))
+	}
+
+	for _, ck := range m.ParsedCookies {
+		ctx.Response.Header.SetCookie(ck)
+	}
+
+	if m.StatusCode > 0 {
+		ctx.SetStatusCode(m.StatusCode)
+	}
+
+	if nil != m.valueTemplate {
+		escape := getMockEscaper(m.ContentType)
+		ctx.SetBodyString(m.valueTemplate.ExecuteFuncString(func(w io.Writer, tag string) (int, error) {
+			return io.WriteString(w, escape(string(vars.getMockVar(tag))))
+		}))
+	} else {
+		ctx.SetBodyString(m.Value)
+	}
+}
+
+// getMockEscaper returns the escaper of the body values by the content type
+func getMockEscaper(contentType string) func(string) string {
+	contentType = strings.ToLower(contentType)
+
+	switch {
+	case strings.Contains(contentType, "json"):
+		return escapeMockJSON
+	case strings.Contains(contentType, "html"), strings.Contains(contentType, "xml"):
+		return html.EscapeString
+	}
+
+	return func(value string) string {
+		return value
+	}
+}
+
+func escapeMockJSON(value string) string {
+	data, _ := json.Marshal(value)
+	return string(data[1 : len(data)-1])
+}
+
+// writeMockVar write the value of the template var, the unknown vars are rendered as empty
+func (ctx *requestContext) writeMockVar(w io.Writer, tag string) (int, error) {
+	return w.Write(ctx.getMockVar(tag))
+}
+
+func (ctx *requestContext) getMockVar(tag string) []byte {
+	tag = strings.TrimSpace(tag)
+
+	switch tag {
+	case "method":
+		return ctx.req.Header.Method()
+	case "uri":
+		return ctx.requestURI
+	}
+
+	values := strings.SplitN(tag, ".", 2)
+	if len(values) != 2 {
+		return nil
+	}
+
+	switch values[0] {
+	case "query":
+		return ctx.req.URI().QueryArgs().Peek(values[1])
+	case "header":
+		return ctx.req.Header.Peek(values[1])
+	case "cookie":
+		return ctx.req.Header.Cookie(values[1])
+	case "path":
+		return ctx.getPathValue(values[1])
+	}
+
+	return nil
+}
+
+// RenderMock dender mock response, the params are the path params of the route result
+func (a *API) RenderMock(ctx *fasthttp.RequestCtx, clientIP string, params PathParams) {
+	if a.Mock == nil {
+		return
+	}
+
+	vars := &requestContext{
+		req:        &ctx.Request,
+		pattern:    a.Pattern,
+		params:     params,
+		requestURI: ctx.RequestURI(),
+		clientIP:   clientIP,
+	}
+
+	a.Mock.selectMock(vars).render(ctx, vars)
+}
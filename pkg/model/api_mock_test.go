@@ -0,0 +1,108 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestMockTemplateAndCases(t *testing.T) {
+	api := &API{
+		Pattern: regexp.MustCompile(`^/users/(\d+)`),
+		Mock: &Mock{
+			Value:    `{"id":"{{path.1}}","name":"{{query.name}}"}`,
+			Template: true,
+			Headers:  []*MockHeader{{Name: "X-Method", Value: "{{method}}"}},
+			Cases: []*MockCase{
+				{
+					Conditions: []string{"$query_type == error"},
+					Mock:       &Mock{Value: "error", StatusCode: fasthttp.StatusInternalServerError},
+				},
+			},
+		},
+	}
+	api.Mock.parse(api.URL)
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users/10?name=abc")
+	api.RenderMock(ctx, "127.0.0.1", api.matchURI(&ctx.Request))
+
+	if string(ctx.Response.Body()) != `{"id":"10","name":"abc"}` {
+		t.Errorf("unexpected mock body: %s", ctx.Response.Body())
+	}
+
+	if string(ctx.Response.Header.Peek("X-Method")) != "GET" {
+		t.Errorf("unexpected mock header: %s", ctx.Response.Header.Peek("X-Method"))
+	}
+
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users/10?type=error")
+	api.RenderMock(ctx, "127.0.0.1", api.matchURI(&ctx.Request))
+
+	if ctx.Response.StatusCode() != fasthttp.StatusInternalServerError || string(ctx.Response.Body()) != "error" {
+		t.Errorf("unexpected mock case response: %d %s", ctx.Response.StatusCode(), ctx.Response.Body())
+	}
+}
+
+func TestMockTemplateEscape(t *testing.T) {
+	api := &API{
+		Pattern: regexp.MustCompile(`^/a`),
+		Mock: &Mock{
+			Value:       `{"x":"{{query.x}}"}`,
+			ContentType: "application/json; charset=utf-8",
+			Template:    true,
+			Headers:     []*MockHeader{{Name: "X-Value", Value: "{{query.x}}"}},
+		},
+	}
+	api.Mock.parse(api.URL)
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/a?x=a%0d%0aSet-Cookie:%20evil=1%22")
+	api.RenderMock(ctx, "127.0.0.1", api.matchURI(&ctx.Request))
+
+	if string(ctx.Response.Header.Peek("X-Value")) != `aSet-Cookie: evil=1"` {
+		t.Errorf("unexpected mock header: %q", ctx.Response.Header.Peek("X-Value"))
+	}
+
+	if strings.Contains(ctx.Response.Header.String(), "\r\nSet-Cookie: evil") {
+		t.Errorf("unexpected mock response header: %s", ctx.Response.Header.String())
+	}
+
+	if string(ctx.Response.Body()) != `{"x":"a\r\nSet-Cookie: evil=1\""}` {
+		t.Errorf("unexpected mock body: %s", ctx.Response.Body())
+	}
+
+	api.Mock.ContentType = "text/html"
+	ctx = &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/a?x=%3Cscript%3E")
+	api.RenderMock(ctx, "127.0.0.1", api.matchURI(&ctx.Request))
+
+	if string(ctx.Response.Body()) != `{"x":"&lt;script&gt;"}` {
+		t.Errorf("unexpected mock body: %s", ctx.Response.Body())
+	}
+}
+
+func TestAPICheckMock(t *testing.T) {
+	cases := []struct {
+		mock *Mock
+		ok   bool
+	}{
+		{&Mock{Value: "{{query.id}}", Template: true, StatusCode: 404}, true},
+		{&Mock{StatusCode: 99}, false},
+		{&Mock{StatusCode: 600}, false},
+		{&Mock{Value: "{{query.id", Template: true}, false},
+		{&Mock{Cases: []*MockCase{{Conditions: []string{"$query_type == error"}, Mock: &Mock{StatusCode: 500}}}}, true},
+		{&Mock{Cases: []*MockCase{{Conditions: []string{"$query_type error"}, Mock: &Mock{}}}}, false},
+		{&Mock{Cases: []*MockCase{{Conditions: []string{"$query_type == error"}}}}, false},
+		{&Mock{Cases: []*MockCase{{Conditions: []string{"$query_type == error"}, Mock: &Mock{StatusCode: 1000}}}}, false},
+	}
+
+	for i, c := range cases {
+		api := &API{Mock: c.mock}
+		if err := api.Check(); (err == nil) != c.ok {
+			t.Errorf("case %d: expect ok %v, but %+v", i, c.ok, err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package model
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/util"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// KeyFromIP use client ip as key
+	KeyFromIP = iota
+	// KeyFromHeader use a request header as key, e.g. api key
+	KeyFromHeader
+	// KeyFromCookie use a request cookie as key
+	KeyFromCookie
+	// KeyFromJWTClaim use a claim of the jwt verified by the JWT filter as key
+	KeyFromJWTClaim
+)
+
+const (
+	// bucketsGCInterval interval to remove idle buckets
+	bucketsGCInterval = time.Minute
+)
+
+// RateLimit rate limit policy using token bucket, every client key has it's own bucket.
+// The requests without the key(missing header, cookie or verified claim) are not limited by the policy.
+type RateLimit struct {
+	KeyFrom int    `json:"keyFrom"`
+	Attr    string `json:"attr,omitempty"`
+	// Rate tokens refilled per second
+	Rate int `json:"rate"`
+	// Burst max tokens of the bucket, default is same as rate
+	Burst int `json:"burst,omitempty"`
+	// Global use the cluster-wide counters shared by all proxies,
+	// fallback to the local bucket if the counter backend is unreachable.
+	Global bool `json:"global,omitempty"`
+
+	id      string
+	buckets *keyedBuckets
+	global  *globalLimiter
+}
+
+type keyedBuckets struct {
+	sync.Mutex
+
+	rate   int
+	burst  int
+	lastGC time.Time
+	values map[string]*util.TokenBucket
+}
+
+func newKeyedBuckets(rate, burst int) *keyedBuckets {
+	return &keyedBuckets{
+		rate:   rate,
+		burst:  burst,
+		lastGC: time.Now(),
+		values: make(map[string]*util.TokenBucket),
+	}
+}
+
+func (k *keyedBuckets) get(key string, now time.Time) *util.TokenBucket {
+	k.Lock()
+	defer k.Unlock()
+
+	if now.Sub(k.lastGC) > bucketsGCInterval {
+		for key, bucket := range k.values {
+			if bucket.IsFull(now) {
+				delete(k.values, key)
+			}
+		}
+		k.lastGC = now
+	}
+
+	bucket, ok := k.values[key]
+	if !ok {
+		bucket = util.NewTokenBucket(k.rate, k.burst, now)
+		k.values[key] = bucket
+	}
+
+	return bucket
+}
+
+func (l *RateLimit) parse(id string) {
+	l.id = id
+	l.buckets = newKeyedBuckets(l.Rate, l.Burst)
+}
+
+func (l *RateLimit) take(key string, now time.Time) (bool, int, time.Duration) {
+	if l.isGlobal() {
+		globalKey, resetAt := l.globalWindow(key, now)
+		ok, remaining, wait := l.global.take(globalKey, int64(l.limit()), resetAt, now)
+		if l.global.isAvailable() {
+			return ok, remaining, wait
+		}
+	}
+
+	return l.buckets.get(key, now).Take(now)
+}
+
+// refund return the token taken by take
+func (l *RateLimit) refund(key string, now time.Time) {
+	if l.isGlobal() && l.global.isAvailable() {
+		globalKey, resetAt := l.globalWindow(key, now)
+		l.global.refund(globalKey, resetAt, now)
+		return
+	}
+
+	l.buckets.get(key, now).Refund(now)
+}
+
+func (l *RateLimit) check(key string, now time.Time) (bool, time.Duration) {
+	if l.isGlobal() {
+		globalKey, resetAt := l.globalWindow(key, now)
+		ok, wait := l.global.check(globalKey, int64(l.limit()), resetAt, now)
+		if l.global.isAvailable() {
+			return ok, wait
+		}
+	}
+
+	return l.buckets.get(key, now).Check(now)
+}
+
+func (l *RateLimit) remaining(key string, now time.Time) int {
+	if l.isGlobal() && l.global.isAvailable() {
+		globalKey, resetAt := l.globalWindow(key, now)
+		return l.global.remaining(globalKey, int64(l.limit()), resetAt, now)
+	}
+
+	return l.buckets.get(key, now).Remaining(now)
+}
+
+func (l *RateLimit) isGlobal() bool {
+	return l.Global && l.global != nil && l.global.enabled()
+}
+
+// globalWindow returns the counter key shared by all proxies and the end of the current window.
+// The windows are aligned to the window duration, so all proxies count the same window.
+func (l *RateLimit) globalWindow(key string, now time.Time) (string, time.Time) {
+	window := l.window()
+	start := now.Truncate(window)
+	return fmt.Sprintf("%s/%s/%d", l.id, base64.RawURLEncoding.EncodeToString([]byte(key)), start.Unix()), start.Add(window)
+}
+
+// window the global counter window, the limit tokens can be used in a window
+func (l *RateLimit) window() time.Duration {
+	if l.Rate <= 0 {
+		return time.Second
+	}
+
+	secs := (l.limit() + l.Rate - 1) / l.Rate
+	if secs < 1 {
+		secs = 1
+	}
+
+	return time.Duration(secs) * time.Second
+}
+
+func (l *RateLimit) limit() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Rate
+}
+
+func (a *API) initGlobalRateLimits(g *globalLimiter) {
+	for _, l := range a.RateLimits {
+		l.global = g
+	}
+}
+
+// RateLimitCheck take a token from every rate limit policy of the api,
+// the tokens are only taken if all the policies allow the request.
+// The claims are the claims of the verified jwt, nil if the request has no verified jwt.
+// Returns the limit and remaining of the most restrictive policy,
+// and if rejected, returns the duration the client should wait.
+func (a *API) RateLimitCheck(req *fasthttp.Request, clientIP string, claims map[string]interface{}) (allowed bool, limit int, remaining int, retryAfter time.Duration) {
+	now := time.Now()
+	keys := make([]string, len(a.RateLimits))
+	for index, l := range a.RateLimits {
+		key, ok := getKeyValue(l.KeyFrom, l.Attr, req, clientIP, claims)
+		if !ok {
+			continue
+		}
+		keys[index] = key
+
+		if ok, wait := l.check(key, now); !ok {
+			return false, l.limit(), 0, wait
+		}
+	}
+
+	remaining = -1
+	for index, l := range a.RateLimits {
+		if keys[index] == "" {
+			continue
+		}
+
+		ok, left, wait := l.take(keys[index], now)
+		if !ok {
+			// taken by the concurrent requests after checked, refund the tokens taken by the previous policies
+			for i := 0; i < index; i++ {
+				if keys[i] != "" {
+					a.RateLimits[i].refund(keys[i], now)
+				}
+			}
+
+			return false, l.limit(), 0, wait
+		}
+
+		if remaining == -1 || left < remaining {
+			limit = l.limit()
+			remaining = left
+		}
+	}
+
+	if remaining == -1 {
+		remaining = 0
+	}
+
+	return true, limit, remaining, 0
+}
+
+// RateLimitRemaining returns the limit and remaining of the most restrictive policy, not take
+func (a *API) RateLimitRemaining(req *fasthttp.Request, clientIP string, claims map[string]interface{}) (limit int, remaining int) {
+	remaining = -1
+
+	now := time.Now()
+	for _, l := range a.RateLimits {
+		key, ok := getKeyValue(l.KeyFrom, l.Attr, req, clientIP, claims)
+		if !ok {
+			continue
+		}
+
+		left := l.remaining(key, now)
+		if remaining == -1 || left < remaining {
+			limit = l.limit()
+			remaining = left
+		}
+	}
+
+	if remaining == -1 {
+		remaining = 0
+	}
+
+	return limit, remaining
+}
+
+// getKeyValue returns the key of the request, returns false if the request has no key.
+// The jwt claims are only read from the verified claims, the unverified tokens are ignored.
+func getKeyValue(from int, attr string, req *fasthttp.Request, clientIP string, claims map[string]interface{}) (string, bool) {
+	var value string
+
+	switch from {
+	case KeyFromIP:
+		value = clientIP
+	case KeyFromHeader:
+		value = string(req.Header.Peek(attr))
+	case KeyFromCookie:
+		value = string(req.Header.Cookie(attr))
+	case KeyFromJWTClaim:
+		if v, ok := claims[attr]; ok && v != nil {
+			value = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return value, value != ""
+}
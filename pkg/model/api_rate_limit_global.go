@@ -0,0 +1,341 @@
+package model
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/log"
+	"github.com/fagongzi/util/task"
+)
+
+const (
+	// DefaultRateLimitSyncInterval default interval to sync global rate limit counters
+	DefaultRateLimitSyncInterval = time.Millisecond * 200
+
+	// maxSyncWorkers the max counters synced concurrently
+	maxSyncWorkers = 16
+)
+
+// Counter counters shared by all proxies, used by the cluster-wide rate limit and quota.
+// Both etcd and consul store implement it.
+type Counter interface {
+	// Incr add delta to the counter, returns the value after added.
+	// The counter is removed after ttl since it created.
+	Incr(key string, delta int64, ttl time.Duration) (int64, error)
+	// GetCounter returns the value of the counter, returns 0 if not exists
+	GetCounter(key string) (int64, error)
+	// DeleteCounter delete the counter
+	DeleteCounter(key string) error
+}
+
+// globalLimiter count requests locally, and sync the local counts to the counter backend periodically.
+// A request is allowed if the global count plus the local count not synced less than the limit.
+// Every sync pushes the local counts and pulls the global counts of all the active counters,
+// so the limit may be exceeded by the requests of the other proxies in a sync interval.
+// A counter is reset at the resetAt given by the caller, the callers use the same resetAt on all the proxies.
+type globalLimiter struct {
+	sync.Mutex
+
+	counter   Counter
+	available int32
+	counters  map[string]*globalCounter
+}
+
+type globalCounter struct {
+	sync.Mutex
+
+	resetAt time.Time
+	synced  int64
+	local   int64
+	loaded  bool // the global count is got from the counter backend
+}
+
+func newGlobalLimiter(store Store, cnf *conf.Conf, taskRunner *task.Runner) *globalLimiter {
+	g := &globalLimiter{
+		counters: make(map[string]*globalCounter),
+	}
+
+	counter, ok := store.(Counter)
+	if !ok {
+		log.Warnf("meta: store not support counter, global rate limit fallback to local")
+		return g
+	}
+
+	g.counter = counter
+	g.available = 1
+
+	interval := DefaultRateLimitSyncInterval
+	if nil != cnf && cnf.RateLimitSyncInterval > 0 {
+		interval = time.Duration(cnf.RateLimitSyncInterval) * time.Millisecond
+	}
+
+	timer := time.NewTicker(interval)
+	taskRunner.RunCancelableTask(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				g.sync()
+			}
+		}
+	})
+
+	return g
+}
+
+func (g *globalLimiter) enabled() bool {
+	return g.counter != nil
+}
+
+func (g *globalLimiter) isAvailable() bool {
+	return atomic.LoadInt32(&g.available) == 1
+}
+
+func (g *globalLimiter) setAvailable(available bool) {
+	var value int32
+	if available {
+		value = 1
+	}
+
+	if atomic.SwapInt32(&g.available, value) != value {
+		if available {
+			log.Infof("meta: global rate limit counter backend recovered")
+		} else {
+			log.Warnf("meta: global rate limit counter backend unreachable, fallback to local")
+		}
+	}
+}
+
+func (g *globalLimiter) get(key string, resetAt time.Time) *globalCounter {
+	g.Lock()
+	defer g.Unlock()
+
+	c, ok := g.counters[key]
+	if !ok {
+		c = &globalCounter{
+			resetAt: resetAt,
+		}
+		g.counters[key] = c
+	}
+
+	return c
+}
+
+// load get the global count from the counter backend if the counter not loaded or synced,
+// so a new proxy not allows the requests up to the limit before the first sync. The requests
+// of the key wait for the load. It's not retried if failed, the sync will get the global count.
+func (g *globalLimiter) load(key string, resetAt time.Time, now time.Time) {
+	if !g.enabled() || !g.isAvailable() {
+		return
+	}
+
+	c := g.get(key, resetAt)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.resetIfExpired(now, resetAt)
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+
+	value, err := g.counter.GetCounter(key)
+	if err != nil {
+		log.Debugf("meta: load global counter <%s> failed, errors:\n%+v",
+			key,
+			err)
+		return
+	}
+
+	if value > c.synced {
+		c.synced = value
+	}
+}
+
+// take count a request, returns false if the global count reach the limit
+func (g *globalLimiter) take(key string, limit int64, resetAt time.Time, now time.Time) (bool, int, time.Duration) {
+	c := g.get(key, resetAt)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.resetIfExpired(now, resetAt)
+
+	used := c.synced + c.local
+	if used >= limit {
+		return false, 0, c.resetAt.Sub(now)
+	}
+
+	c.local++
+	return true, int(limit - used - 1), 0
+}
+
+// refund uncount a request taken, the count of the expired window is not changed
+func (g *globalLimiter) refund(key string, resetAt time.Time, now time.Time) {
+	c := g.get(key, resetAt)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if now.Before(c.resetAt) {
+		c.local--
+	}
+}
+
+// check returns false if the global count reach the limit, not count the request
+func (g *globalLimiter) check(key string, limit int64, resetAt time.Time, now time.Time) (bool, time.Duration) {
+	c := g.get(key, resetAt)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.resetIfExpired(now, resetAt)
+
+	if c.synced+c.local >= limit {
+		return false, c.resetAt.Sub(now)
+	}
+
+	return true, 0
+}
+
+func (g *globalLimiter) remaining(key string, limit int64, resetAt time.Time, now time.Time) int {
+	c := g.get(key, resetAt)
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.resetIfExpired(now, resetAt)
+
+	used := c.synced + c.local
+	if used > limit {
+		return 0
+	}
+
+	return int(limit - used)
+}
+
+// sync the counters by the workers, the failed counters are synced at the next time.
+// The backend is unavailable only if all the counters failed.
+func (g *globalLimiter) sync() {
+	g.Lock()
+	counters := make(map[string]*globalCounter, len(g.counters))
+	for key, c := range g.counters {
+		counters[key] = c
+	}
+	g.Unlock()
+
+	if len(counters) == 0 {
+		return
+	}
+
+	workers := maxSyncWorkers
+	if len(counters) < workers {
+		workers = len(counters)
+	}
+
+	now := time.Now()
+	var succeeded, failed int32
+	keys := make(chan string, len(counters))
+	for key := range counters {
+		keys <- key
+	}
+	close(keys)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for key := range keys {
+				synced, err := g.syncCounter(key, counters[key], now)
+				if err != nil {
+					atomic.AddInt32(&failed, 1)
+				} else if synced {
+					atomic.AddInt32(&succeeded, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded > 0 {
+		g.setAvailable(true)
+	} else if failed > 0 {
+		g.setAvailable(false)
+	}
+}
+
+// syncCounter push the local count and pull the global count, returns false if the counter is idle and removed
+func (g *globalLimiter) syncCounter(key string, c *globalCounter, now time.Time) (bool, error) {
+	c.Lock()
+	if !now.Before(c.resetAt) {
+		c.Unlock()
+		g.removeIfIdle(key, c, now)
+		return false, nil
+	}
+
+	delta := c.local
+	ttl := c.resetAt.Sub(now)
+	c.local = 0
+	c.Unlock()
+
+	if ttl < time.Second {
+		ttl = time.Second
+	}
+
+	var value int64
+	var err error
+	if delta == 0 {
+		// pull the counts of the other proxies
+		value, err = g.counter.GetCounter(key)
+	} else {
+		value, err = g.counter.Incr(key, delta, ttl)
+	}
+
+	c.Lock()
+	if err != nil {
+		c.local += delta
+	} else {
+		c.synced = value
+		c.loaded = true
+	}
+	c.Unlock()
+
+	if err != nil {
+		log.Debugf("meta: sync global rate limit counter <%s> failed, errors:\n%+v",
+			key,
+			err)
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (g *globalLimiter) removeIfIdle(key string, c *globalCounter, now time.Time) {
+	g.Lock()
+	defer g.Unlock()
+
+	c.Lock()
+	defer c.Unlock()
+
+	// the counter of a expired window is never used again, the counts not synced are dropped
+	if !now.Before(c.resetAt) && g.counters[key] == c {
+		delete(g.counters, key)
+	}
+}
+
+func (c *globalCounter) resetIfExpired(now time.Time, resetAt time.Time) {
+	if !now.Before(c.resetAt) {
+		c.synced = 0
+		c.local = 0
+		c.loaded = false
+		c.resetAt = resetAt
+	}
+}
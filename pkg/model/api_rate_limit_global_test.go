@@ -0,0 +1,195 @@
+package model
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memoryCounter struct {
+	sync.Mutex
+
+	failed     bool
+	failedKeys map[string]bool
+	values     map[string]int64
+}
+
+func (m *memoryCounter) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.failed || m.failedKeys[key] {
+		return 0, errors.New("unreachable")
+	}
+
+	m.values[key] += delta
+	return m.values[key], nil
+}
+
+func (m *memoryCounter) GetCounter(key string) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.failed {
+		return 0, errors.New("unreachable")
+	}
+
+	return m.values[key], nil
+}
+
+func (m *memoryCounter) DeleteCounter(key string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.values, key)
+	return nil
+}
+
+func newTestGlobalLimiter(counter Counter) *globalLimiter {
+	return &globalLimiter{
+		counter:   counter,
+		available: 1,
+		counters:  make(map[string]*globalCounter),
+	}
+}
+
+func TestGlobalLimiterShareCounts(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64)}
+	g1 := newTestGlobalLimiter(counter)
+	g2 := newTestGlobalLimiter(counter)
+
+	now := time.Now()
+	for i := 0; i < 6; i++ {
+		if ok, _, _ := g1.take("k", 10, now.Add(time.Minute), now); !ok {
+			t.Fatalf("expect take %d ok", i)
+		}
+	}
+
+	// g2 has a counter not changed locally, it pulls the counts of g1 at the sync
+	g2.check("k", 10, now.Add(time.Minute), now)
+	g1.sync()
+	g2.sync()
+
+	for i := 0; i < 4; i++ {
+		if ok, _, _ := g2.take("k", 10, now.Add(time.Minute), now); !ok {
+			t.Fatalf("expect take %d ok", i)
+		}
+	}
+
+	if ok, _, wait := g2.take("k", 10, now.Add(time.Minute), now); ok || wait <= 0 {
+		t.Errorf("expect rejected by the global counts, but %v %s", ok, wait)
+	}
+
+	g2.sync()
+	g1.sync()
+	if ok, _ := g1.check("k", 10, now.Add(time.Minute), now); ok {
+		t.Error("expect g1 rejected after synced the counts of g2")
+	}
+
+	if counter.values["k"] != 10 {
+		t.Errorf("expect global count 10, but %d", counter.values["k"])
+	}
+}
+
+func TestGlobalLimiterRefund(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64)}
+	g := newTestGlobalLimiter(counter)
+
+	now := time.Now()
+	g.take("k", 10, now.Add(time.Minute), now)
+	g.take("k", 10, now.Add(time.Minute), now)
+	g.sync()
+
+	// the refund after synced is pushed at the next sync
+	g.refund("k", now.Add(time.Minute), now)
+	if remaining := g.remaining("k", 10, now.Add(time.Minute), now); remaining != 9 {
+		t.Errorf("expect remaining 9 after refunded, but %d", remaining)
+	}
+
+	g.sync()
+	if counter.values["k"] != 1 {
+		t.Errorf("expect global count 1, but %d", counter.values["k"])
+	}
+}
+
+func TestGlobalLimiterUnavailable(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64), failed: true}
+	g := newTestGlobalLimiter(counter)
+
+	now := time.Now()
+	g.take("k", 10, now.Add(time.Minute), now)
+	g.sync()
+
+	if g.isAvailable() {
+		t.Error("expect unavailable after sync failed")
+	}
+
+	if remaining := g.remaining("k", 10, now.Add(time.Minute), now); remaining != 9 {
+		t.Errorf("expect the local count kept, but remaining %d", remaining)
+	}
+
+	counter.failed = false
+	g.sync()
+	if !g.isAvailable() || counter.values["k"] != 1 {
+		t.Errorf("expect recovered and pushed, but %v %d", g.isAvailable(), counter.values["k"])
+	}
+}
+
+func TestGlobalLimiterSyncContinueAfterFailed(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64), failedKeys: map[string]bool{"a": true}}
+	g := newTestGlobalLimiter(counter)
+
+	now := time.Now()
+	for _, key := range []string{"a", "b", "c"} {
+		g.take(key, 10, now.Add(time.Minute), now)
+	}
+	g.sync()
+
+	if !g.isAvailable() {
+		t.Error("expect available if some counters synced")
+	}
+
+	if counter.values["b"] != 1 || counter.values["c"] != 1 {
+		t.Errorf("expect the other counters synced, but %+v", counter.values)
+	}
+
+	if remaining := g.remaining("a", 10, now.Add(time.Minute), now); remaining != 9 {
+		t.Errorf("expect the local count of the failed counter kept, but remaining %d", remaining)
+	}
+
+	delete(counter.failedKeys, "a")
+	g.sync()
+	if counter.values["a"] != 1 {
+		t.Errorf("expect the failed counter synced at the next time, but %d", counter.values["a"])
+	}
+}
+
+func TestRateLimitGlobalWindow(t *testing.T) {
+	l := &RateLimit{Rate: 10, Burst: 100, id: "a"}
+
+	start := time.Unix(1500000000, 0)
+	key1, resetAt1 := l.globalWindow("k", start.Add(time.Second))
+	key2, resetAt2 := l.globalWindow("k", start.Add(9*time.Second))
+	if key1 != key2 || !resetAt1.Equal(resetAt2) || !resetAt1.Equal(start.Add(10*time.Second)) {
+		t.Errorf("expect the same aligned window, but %s %s %s %s", key1, resetAt1, key2, resetAt2)
+	}
+
+	key3, resetAt3 := l.globalWindow("k", start.Add(10*time.Second))
+	if key3 == key1 || !resetAt3.Equal(start.Add(20*time.Second)) {
+		t.Errorf("expect the next window, but %s %s", key3, resetAt3)
+	}
+}
+
+func TestGlobalLimiterRemoveExpired(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64)}
+	g := newTestGlobalLimiter(counter)
+
+	now := time.Now()
+	g.take("k", 10, now.Add(-time.Second), now.Add(-2*time.Second))
+	g.sync()
+
+	if len(g.counters) != 0 || len(counter.values) != 0 {
+		t.Errorf("expect the counter of the expired window removed, but %d %+v", len(g.counters), counter.values)
+	}
+}
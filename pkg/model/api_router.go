@@ -0,0 +1,250 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	anyMethod = "*"
+)
+
+var (
+	paramNamePattern = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+	rewriteParam     = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+)
+
+const (
+	segmentStatic = iota
+	segmentParam
+	segmentCatchAll
+)
+
+// pathSegment a segment of the path template, like users, {id} or {path*}
+type pathSegment struct {
+	kind  int
+	value string // the static value or the param name
+}
+
+// apiRouter select the api of the request.
+// The apis are matched in this order: the apis bound to the request domain,
+// the path templates in the prefix tree and the regexp apis.
+type apiRouter struct {
+	domains []*API
+	root    *routerNode
+	regexps []*API
+}
+
+// routerNode a node of the prefix tree, the children are matched in this order:
+// static > param > catch all, it backtracks if the subtree has no matched api.
+type routerNode struct {
+	static   map[string]*routerNode
+	param    *routerNode
+	catchAll *routerNode
+	apis     map[string]*API // method -> api
+}
+
+func newRouterNode() *routerNode {
+	return &routerNode{
+		static: make(map[string]*routerNode),
+		apis:   make(map[string]*API),
+	}
+}
+
+// newAPIRouter build a router of the parsed apis
+func newAPIRouter(apis map[string]*API) *apiRouter {
+	router := &apiRouter{
+		root: newRouterNode(),
+	}
+
+	// sort the apis, so the conflict apis are resolved in the same way on all the proxies
+	sorted := make([]*API, 0, len(apis))
+	for _, api := range apis {
+		sorted = append(sorted, api)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].URL != sorted[j].URL {
+			return sorted[i].URL < sorted[j].URL
+		}
+
+		return sorted[i].Method < sorted[j].Method
+	})
+
+	for _, api := range sorted {
+		if api.Domain != "" {
+			router.domains = append(router.domains, api)
+		}
+
+		if nil != api.segments {
+			router.root.add(api.segments, api)
+		} else {
+			router.regexps = append(router.regexps, api)
+		}
+	}
+
+	return router
+}
+
+func (n *routerNode) add(segments []*pathSegment, api *API) {
+	node := n
+	for _, segment := range segments {
+		switch segment.kind {
+		case segmentStatic:
+			child, ok := node.static[segment.value]
+			if !ok {
+				child = newRouterNode()
+				node.static[segment.value] = child
+			}
+			node = child
+		case segmentParam:
+			if nil == node.param {
+				node.param = newRouterNode()
+			}
+			node = node.param
+		case segmentCatchAll:
+			if nil == node.catchAll {
+				node.catchAll = newRouterNode()
+			}
+			node = node.catchAll
+		}
+	}
+
+	node.apis[api.Method] = api
+}
+
+// lookup returns the matched api and the values of the params in the order of the template
+func (n *routerNode) lookup(segments []string, method string, values []string) (*API, []string) {
+	if len(segments) == 0 {
+		return n.selectAPI(method), values
+	}
+
+	if child, ok := n.static[segments[0]]; ok {
+		if api, matched := child.lookup(segments[1:], method, values); nil != api {
+			return api, matched
+		}
+	}
+
+	if nil != n.param && segments[0] != "" {
+		if api, matched := n.param.lookup(segments[1:], method, append(values, segments[0])); nil != api {
+			return api, matched
+		}
+	}
+
+	if nil != n.catchAll {
+		return n.catchAll.selectAPI(method), append(values, strings.Join(segments, "/"))
+	}
+
+	return nil, nil
+}
+
+func (n *routerNode) selectAPI(method string) *API {
+	if api, ok := n.apis[method]; ok && api.isUp() {
+		return api
+	}
+
+	if api, ok := n.apis[anyMethod]; ok && api.isUp() {
+		return api
+	}
+
+	return nil
+}
+
+// find returns the api matches the request and the method and the path params of the api,
+// returns nil if no api matches
+func (r *apiRouter) find(req *fasthttp.Request, method string) (*API, PathParams) {
+	for _, api := range r.domains {
+		if api.isUp() && api.isDomainMatches(req) {
+			return api, api.matchURI(req)
+		}
+	}
+
+	path := string(req.URI().Path())
+	if strings.HasPrefix(path, "/") {
+		if api, values := r.root.lookup(strings.Split(path[1:], "/"), method, nil); nil != api {
+			params := make(PathParams, len(values)+1)
+			params[0] = []byte(path)
+			for i, value := range values {
+				params[i+1] = []byte(value)
+			}
+			return api, params
+		}
+	}
+
+	for _, api := range r.regexps {
+		if api.isUp() && (api.Method == anyMethod || api.Method == method) {
+			if params := api.matchURI(req); nil != params {
+				return api, params
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// parsePathTemplate returns the segments and the regexp of the template,
+// the params are named groups of the regexp, so they are used in the same way as the regexp apis.
+func parsePathTemplate(url string) ([]*pathSegment, *regexp.Regexp, error) {
+	if !strings.HasPrefix(url, "/") {
+		return nil, nil, fmt.Errorf("path template must start with /: %s", url)
+	}
+
+	var segments []*pathSegment
+	expr := "^"
+
+	values := strings.Split(url[1:], "/")
+	for index, value := range values {
+		segment := &pathSegment{
+			kind:  segmentStatic,
+			value: value,
+		}
+
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			segment.kind = segmentParam
+			segment.value = value[1 : len(value)-1]
+
+			if strings.HasSuffix(segment.value, "*") {
+				if index != len(values)-1 {
+					return nil, nil, fmt.Errorf("catch all param must be the last segment: %s", url)
+				}
+
+				segment.kind = segmentCatchAll
+				segment.value = strings.TrimSuffix(segment.value, "*")
+			}
+
+			if !paramNamePattern.MatchString(segment.value) {
+				return nil, nil, fmt.Errorf("invalid param name %s: %s", segment.value, url)
+			}
+		} else if strings.ContainsAny(value, "{}") {
+			return nil, nil, fmt.Errorf("param must be a whole segment: %s", url)
+		}
+
+		switch segment.kind {
+		case segmentStatic:
+			expr += "/" + regexp.QuoteMeta(segment.value)
+		case segmentParam:
+			expr += fmt.Sprintf("/(?P<%s>[^/?]+)", segment.value)
+		case segmentCatchAll:
+			expr += fmt.Sprintf("/(?P<%s>[^?]*)", segment.value)
+		}
+
+		segments = append(segments, segment)
+	}
+
+	// the pattern matches the request uri with the query string
+	pattern, err := regexp.Compile(expr + `(?:\?.*)?$`)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return segments, pattern, nil
+}
+
+// rewriteTemplate returns the rewrite template of the path template api,
+// the params like {id} are replaced by the captured values.
+func rewriteTemplate(rewrite string) string {
+	return rewriteParam.ReplaceAllString(strings.Replace(rewrite, "$", "$$", -1), "$${$1}")
+}
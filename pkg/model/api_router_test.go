@@ -0,0 +1,167 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newRouterTestAPI(url, method string) *API {
+	api := &API{
+		URL:          url,
+		Method:       method,
+		Status:       APIStatusUp,
+		PathTemplate: true,
+	}
+	api.Parse()
+
+	return api
+}
+
+func newRegexpTestAPI(url, method string) *API {
+	api := &API{
+		URL:    url,
+		Method: method,
+		Status: APIStatusUp,
+	}
+	api.Parse()
+
+	return api
+}
+
+func TestMatchesAPIRouter(t *testing.T) {
+	apis := make(map[string]*API)
+	for _, api := range []*API{
+		newRouterTestAPI("/users/me", "GET"),
+		newRouterTestAPI("/users/{id}", "GET"),
+		newRouterTestAPI("/users/{id}", "*"),
+		newRouterTestAPI("/users/{id}/orders/{orderID}", "GET"),
+		newRouterTestAPI("/users/me/orders/latest", "GET"),
+		newRouterTestAPI("/files/{path*}", "GET"),
+		newRouterTestAPI("/v1.0/items", "GET"),
+		newRegexpTestAPI("^/legacy/(\\d+)$", "GET"),
+		newRegexpTestAPI("/api/users", "GET"),
+		newRegexpTestAPI("/shop/v1.0", "GET"),
+	} {
+		apis[api.key()] = api
+	}
+
+	router := newAPIRouter(apis)
+
+	cases := []struct {
+		method string
+		uri    string
+		url    string
+		api    string
+	}{
+		{"GET", "/users/me", "/users/me", "GET"},
+		{"GET", "/users/1?a=b", "/users/{id}", "GET"},
+		{"POST", "/users/1", "/users/{id}", "*"},
+		{"GET", "/users/me/orders/1", "/users/{id}/orders/{orderID}", "GET"},
+		{"GET", "/users/me/orders/latest", "/users/me/orders/latest", "GET"},
+		{"GET", "/files/a/b/c.txt", "/files/{path*}", "GET"},
+		{"GET", "/v1.0/items", "/v1.0/items", "GET"},
+		{"GET", "/v1x0/items", "", ""},
+		{"GET", "/legacy/12", "^/legacy/(\\d+)$", "GET"},
+		{"GET", "/api/users", "/api/users", "GET"},
+		{"GET", "/api/users/1", "/api/users", "GET"},
+		{"GET", "/shop/v1x0/items", "/shop/v1.0", "GET"},
+		{"GET", "/v2/api/users?a=b", "/api/users", "GET"},
+		{"GET", "/users", "", ""},
+		{"GET", "/users//orders/1", "", ""},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+
+		api, _ := router.find(req, c.method)
+		if c.url == "" {
+			if nil != api {
+				t.Errorf("<%s %s> expect no api, but <%s %s>", c.method, c.uri, api.Method, api.URL)
+			}
+			continue
+		}
+
+		if nil == api || api.URL != c.url || api.Method != c.api {
+			t.Errorf("<%s %s> expect <%s %s>, but <%+v>", c.method, c.uri, c.api, c.url, api)
+		}
+	}
+
+	// the params are captured by the router
+	for _, c := range []struct {
+		uri    string
+		params []string
+	}{
+		{"/users/1/orders/2", []string{"1", "2"}},
+		{"/users/me/orders/3", []string{"me", "3"}},
+		{"/files/a/b/c.txt?a=b", []string{"a/b/c.txt"}},
+		{"/legacy/12", []string{"12"}},
+	} {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+
+		_, params := router.find(req, "GET")
+		if len(params) != len(c.params)+1 {
+			t.Errorf("<%s> expect params %+v, but %q", c.uri, c.params, params)
+			continue
+		}
+
+		for i, value := range c.params {
+			if string(params[i+1]) != value {
+				t.Errorf("<%s> expect params %+v, but %q", c.uri, c.params, params)
+			}
+		}
+	}
+
+	// the down api is skipped
+	apis[getAPIKey("", "/users/me", "GET")].Status = APIStatusDown
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/me")
+	if api, _ := router.find(req, "GET"); nil == api || api.URL != "/users/{id}" {
+		t.Errorf("expect </users/{id}>, but <%+v>", api)
+	}
+}
+
+func TestParsePathTemplate(t *testing.T) {
+	for _, url := range []string{"/users/{id}/{path*}/x", "/users/{1d}", "/users/a{id}"} {
+		if _, _, err := parsePathTemplate(url); err == nil {
+			t.Errorf("<%s> expect error", url)
+		}
+	}
+
+	if api := newRegexpTestAPI("/users/{id}", "GET"); nil != api.segments {
+		t.Error("expect a regexp api without path template")
+	}
+
+	api := newRouterTestAPI("/users/{id}/orders/{orderID}", "GET")
+	if nil == api.segments {
+		t.Error("expect a path template api")
+		return
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/1/orders/2?a=b")
+
+	_, params := newAPIRouter(map[string]*API{api.key(): api}).find(req, "GET")
+	ctx := &requestContext{
+		req:     req,
+		pattern: api.Pattern,
+		params:  params,
+	}
+
+	if string(ctx.getPathValue("orderID")) != "2" || string(ctx.getPathValue("1")) != "1" {
+		t.Errorf("path params parse failed, id=<%s> orderID=<%s>",
+			ctx.getPathValue("1"),
+			ctx.getPathValue("orderID"))
+	}
+
+	node := &Node{Rewrite: "/orders?user={id}&id={orderID}&$1"}
+	api.Nodes = []*Node{node}
+	api.Parse()
+
+	expect := "/orders?user=1&id=2&$1&a=b"
+	if value := api.getNodeURL(req, node); value != expect {
+		t.Errorf("expect <%s>, but <%s>", expect, value)
+	}
+}
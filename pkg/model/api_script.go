@@ -0,0 +1,479 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/log"
+	"github.com/robertkrimen/otto"
+	"github.com/valyala/fasthttp"
+)
+
+// The scripts are javascript(ES5) run by otto, a pure go interpreter.
+// The interpreters of a api are pooled, a run takes one with these objects only. The script runs in
+// a function, so the var declarations are not kept by the interpreter, and the undeclared variables are
+// removed after the run. The objects are frozen and can't be reassigned, so a run can't break the next runs:
+//   req:   method(), path(), uri(), ip(), header(name), query(name), cookie(name), param(name), body(), json(path),
+//          setHeader(name, value), delHeader(name), setQuery(name, value), delQuery(name), setPath(path), setBody(body)
+//   res:   status(), header(name), body(), setStatus(code), setHeader(name, value), delHeader(name), setBody(body)
+//   attrs: get(key), set(key, value), del(key)
+//   reject(status, [body]) rejects the request and stops the script
+// The setters of req throw a TypeError in the post script.
+
+const (
+	// ScriptPhasePre the script runs before the request sent to the backend server
+	ScriptPhasePre = "pre"
+	// ScriptPhasePost the script runs after the backend server responded
+	ScriptPhasePost = "post"
+
+	defaultScriptTimeout   = 50 // ms
+	maxScriptStackDepth    = 256
+	scriptConsoleVar       = "console"
+	scriptRequestVar       = "req"
+	scriptResponseVar      = "res"
+	scriptAttrsVar         = "attrs"
+	scriptRejectFunc       = "reject"
+	scriptNewObject        = "({})"
+	scriptWrapperStart     = "(function() {"
+	scriptWrapperEnd       = "\n})();"
+	scriptRequestReadOnly  = "can't change the request in the post script"
+	scriptInvalidStatus    = "invalid status code"
+	scriptInvalidRejection = "invalid reject status code"
+)
+
+// the scripts run before the scripts of the api, they bind the globals of a interpreter
+const (
+	scriptGlobalObject  = "this"
+	scriptDeleteGlobal  = "(function(g, name) { delete g[name]; })"
+	scriptFreezeGlobals = `(function(g, names) {
+	for (var i = 0; i < names.length; i++) {
+		var value = g[names[i]];
+		if (typeof value === "object" && value !== null) {
+			Object.freeze(value);
+		}
+		Object.defineProperty(g, names[i], {value: value, writable: false, enumerable: false, configurable: false});
+	}
+})`
+)
+
+var (
+	// ErrScriptRejected the script rejected the request
+	ErrScriptRejected = errors.New("Script rejected")
+	// ErrScriptTimeout the script runs too long
+	ErrScriptTimeout = errors.New("Script timeout")
+)
+
+// scriptHalt stops the script, it's not a javascript value, so the try statements of the script can't catch it
+type scriptHalt int
+
+const (
+	scriptHaltReject scriptHalt = iota
+	scriptHaltTimeout
+)
+
+// ScriptAttrs the attributes of the request, they are shared with the filters
+type ScriptAttrs interface {
+	GetStringAttr(key string) string
+	SetAttr(key string, value interface{})
+}
+
+// APIScript the scripts of a api run by the script filter
+type APIScript struct {
+	// Pre the script runs before the request sent to the backend server,
+	// the changes of the response only take effect if the request is rejected
+	Pre string `json:"pre,omitempty"`
+	// Post the script runs after the backend server responded, it can't change the request
+	Post string `json:"post,omitempty"`
+	// Timeout the max milliseconds of a run, default is 50
+	Timeout int `json:"timeout,omitempty"`
+
+	pre  *otto.Script
+	post *otto.Script
+	vms  *sync.Pool // *scriptVM
+}
+
+// Check check the scripts
+func (s *APIScript) Check() error {
+	_, err := compileScript(ScriptPhasePre, s.Pre)
+	if err != nil {
+		return fmt.Errorf("pre script: %s", err.Error())
+	}
+
+	_, err = compileScript(ScriptPhasePost, s.Post)
+	if err != nil {
+		return fmt.Errorf("post script: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (s *APIScript) parse(owner string) {
+	var err error
+
+	s.pre, err = compileScript(ScriptPhasePre, s.Pre)
+	if err != nil {
+		log.Warnf("meta: pre script of <%s> is invalid and not run, errors:\n%+v",
+			owner,
+			err)
+	}
+
+	s.post, err = compileScript(ScriptPhasePost, s.Post)
+	if err != nil {
+		log.Warnf("meta: post script of <%s> is invalid and not run, errors:\n%+v",
+			owner,
+			err)
+	}
+
+	s.vms = &sync.Pool{
+		New: func() interface{} {
+			return newScriptVM()
+		},
+	}
+}
+
+// compileScript returns nil if the script is empty, the compiled script can be run by any interpreter
+func compileScript(phase, script string) (*otto.Script, error) {
+	if script == "" {
+		return nil, nil
+	}
+
+	// the first line of the script keeps its line number
+	return otto.New().Compile(phase, scriptWrapperStart+script+scriptWrapperEnd)
+}
+
+// RunScript run the script of the phase. The res is the backend server response in the post phase,
+// the origin is the response to the client, the params are the path params of the route result.
+// It returns the status code and ErrScriptRejected if the script rejects the request.
+func (a *API) RunScript(phase string, req *fasthttp.Request, params PathParams, clientIP string, res, origin *fasthttp.Response, attrs ScriptAttrs) (int, error) {
+	if nil == a.Script {
+		return fasthttp.StatusOK, nil
+	}
+
+	script := a.Script.pre
+	if phase == ScriptPhasePost {
+		script = a.Script.post
+	}
+
+	if nil == script {
+		return fasthttp.StatusOK, nil
+	}
+
+	timeout := a.Script.Timeout
+	if timeout <= 0 {
+		timeout = defaultScriptTimeout
+	}
+
+	env := &scriptEnv{
+		ctx: &requestContext{
+			req:      req,
+			pattern:  a.Pattern,
+			params:   params,
+			clientIP: clientIP,
+		},
+		post:    phase == ScriptPhasePost,
+		res:     origin,
+		headers: []*fasthttp.Response{origin},
+		origin:  origin,
+		attrs:   attrs,
+	}
+
+	if nil != res {
+		env.res = res
+		env.headers = append(env.headers, res)
+	}
+
+	vm := a.Script.vms.Get().(*scriptVM)
+	err := vm.run(env, script, time.Duration(timeout)*time.Millisecond)
+	if vm.reusable {
+		a.Script.vms.Put(vm)
+	}
+
+	if err != nil {
+		return fasthttp.StatusInternalServerError, err
+	}
+
+	if env.statusCode > 0 {
+		return env.statusCode, ErrScriptRejected
+	}
+
+	return fasthttp.StatusOK, nil
+}
+
+type scriptEnv struct {
+	ctx     *requestContext
+	post    bool
+	res     *fasthttp.Response   // the status and body of the response to the client
+	headers []*fasthttp.Response // the headers of the response to the client
+	origin  *fasthttp.Response   // the response of the rejected request
+	attrs   ScriptAttrs
+
+	statusCode int // the status code of the rejected request
+}
+
+// scriptVM a interpreter with the objects bound, the bound functions use the env of the current run
+type scriptVM struct {
+	vm       *otto.Otto
+	env      *scriptEnv
+	reusable bool // the interpreter can be reused if the last run completed
+
+	global       *otto.Object
+	globals      map[string]bool // the enumerable globals before the first run
+	deleteGlobal otto.Value      // bound before the scripts run, so the scripts can't change it
+}
+
+// run the script with the env, the interpreter is interrupted at the next statement after the timeout,
+// so the loops of the script can't run forever
+func (v *scriptVM) run(env *scriptEnv, script *otto.Script, timeout time.Duration) (err error) {
+	v.env = env
+	v.reusable = false
+	defer func() {
+		v.env = nil
+	}()
+
+	timer := time.AfterFunc(timeout, func() {
+		v.vm.Interrupt <- func() {
+			panic(scriptHaltTimeout)
+		}
+	})
+
+	defer func() {
+		// the interrupt may be sent after the run completed
+		fired := !timer.Stop()
+
+		if caught := recover(); caught != nil {
+			switch caught {
+			case scriptHaltReject:
+				err = nil
+			case scriptHaltTimeout:
+				err = ErrScriptTimeout
+			default:
+				panic(caught)
+			}
+			return
+		}
+
+		v.reusable = !fired && nil == err && v.resetGlobals()
+	}()
+
+	_, err = v.vm.Run(script)
+	return err
+}
+
+// resetGlobals remove the undeclared variables of the last run, returns false if failed
+func (v *scriptVM) resetGlobals() bool {
+	for _, name := range v.global.Keys() {
+		if v.globals[name] {
+			continue
+		}
+
+		if _, err := v.deleteGlobal.Call(otto.NullValue(), v.global, name); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newScriptVM returns a interpreter with the objects bound
+func newScriptVM() *scriptVM {
+	v := &scriptVM{
+		vm: otto.New(),
+	}
+
+	vm := v.vm
+	vm.SetStackDepthLimit(maxScriptStackDepth)
+	vm.Interrupt = make(chan func(), 1)
+	vm.Set(scriptConsoleVar, otto.UndefinedValue())
+	vm.Set(scriptRequestVar, newScriptObject(vm, map[string]func(call otto.FunctionCall) otto.Value{
+		"method": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.Header.Method())
+		}),
+		"path": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.URI().Path())
+		}),
+		"uri": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.URI().RequestURI())
+		}),
+		"ip": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return env.ctx.clientIP
+		}),
+		"header": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.Header.Peek(stringArg(call, 0)))
+		}),
+		"query": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.URI().QueryArgs().Peek(stringArg(call, 0)))
+		}),
+		"cookie": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.Header.Cookie(stringArg(call, 0)))
+		}),
+		"param": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.getPathValue(stringArg(call, 0)))
+		}),
+		"body": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.req.Body())
+		}),
+		"json": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.ctx.getBodyValue(stringArg(call, 0)))
+		}),
+		"setHeader": v.requestFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.ctx.req.Header.Set(stringArg(call, 0), stringArg(call, 1))
+		}),
+		"delHeader": v.requestFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.ctx.req.Header.Del(stringArg(call, 0))
+		}),
+		"setQuery": v.requestFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.ctx.req.URI().QueryArgs().Set(stringArg(call, 0), stringArg(call, 1))
+		}),
+		"delQuery": v.requestFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.ctx.req.URI().QueryArgs().Del(stringArg(call, 0))
+		}),
+		"setPath": v.requestFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.ctx.req.URI().SetPath(stringArg(call, 0))
+		}),
+		"setBody": v.requestFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.ctx.req.SetBodyString(stringArg(call, 0))
+			env.ctx.bodyDecoded = false
+		}),
+	}))
+
+	vm.Set(scriptResponseVar, newScriptObject(vm, map[string]func(call otto.FunctionCall) otto.Value{
+		"status": func(call otto.FunctionCall) otto.Value {
+			value, _ := otto.ToValue(v.env.res.StatusCode())
+			return value
+		},
+		"header": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.res.Header.Peek(stringArg(call, 0)))
+		}),
+		"body": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			return string(env.res.Body())
+		}),
+		"setStatus": v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			statusCode := statusArg(call, scriptInvalidStatus)
+			env.res.SetStatusCode(statusCode)
+		}),
+		"setHeader": v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			for _, res := range env.headers {
+				res.Header.Set(stringArg(call, 0), stringArg(call, 1))
+			}
+		}),
+		"delHeader": v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			for _, res := range env.headers {
+				res.Header.Del(stringArg(call, 0))
+			}
+		}),
+		"setBody": v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			env.res.SetBodyString(stringArg(call, 0))
+		}),
+	}))
+
+	vm.Set(scriptAttrsVar, newScriptObject(vm, map[string]func(call otto.FunctionCall) otto.Value{
+		"get": v.stringFunc(func(env *scriptEnv, call otto.FunctionCall) string {
+			if nil == env.attrs {
+				return ""
+			}
+			return env.attrs.GetStringAttr(stringArg(call, 0))
+		}),
+		"set": v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			if nil != env.attrs {
+				env.attrs.SetAttr(stringArg(call, 0), stringArg(call, 1))
+			}
+		}),
+		"del": v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+			if nil != env.attrs {
+				env.attrs.SetAttr(stringArg(call, 0), nil)
+			}
+		}),
+	}))
+
+	vm.Set(scriptRejectFunc, func(call otto.FunctionCall) otto.Value {
+		env := v.env
+		statusCode := statusArg(call, scriptInvalidRejection)
+		if statusCode < 300 {
+			panic(call.Otto.MakeRangeError(fmt.Sprintf("%s: %d", scriptInvalidRejection, statusCode)))
+		}
+
+		env.statusCode = statusCode
+		if len(call.ArgumentList) > 1 {
+			env.origin.SetBodyString(stringArg(call, 1))
+		}
+
+		panic(scriptHaltReject)
+	})
+
+	v.bindGlobals(scriptConsoleVar, scriptRequestVar, scriptResponseVar, scriptAttrsVar, scriptRejectFunc)
+	return v
+}
+
+// bindGlobals freeze the objects and make the globals read only, the global names are kept by resetGlobals
+func (v *scriptVM) bindGlobals(names ...string) {
+	global, _ := v.vm.Run(scriptGlobalObject)
+	v.global = global.Object()
+
+	freeze, _ := v.vm.Run(scriptFreezeGlobals)
+	if _, err := freeze.Call(otto.NullValue(), v.global, names); err != nil {
+		log.Fatalf("meta: freeze the script objects failed, errors:\n%+v", err)
+	}
+
+	v.deleteGlobal, _ = v.vm.Run(scriptDeleteGlobal)
+	v.globals = make(map[string]bool)
+	for _, name := range v.global.Keys() {
+		v.globals[name] = true
+	}
+}
+
+func newScriptObject(vm *otto.Otto, funcs map[string]func(call otto.FunctionCall) otto.Value) *otto.Object {
+	obj, _ := vm.Object(scriptNewObject)
+	for name, fn := range funcs {
+		obj.Set(name, fn)
+	}
+
+	return obj
+}
+
+func (v *scriptVM) stringFunc(fn func(env *scriptEnv, call otto.FunctionCall) string) func(call otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		value, _ := otto.ToValue(fn(v.env, call))
+		return value
+	}
+}
+
+func (v *scriptVM) voidFunc(fn func(env *scriptEnv, call otto.FunctionCall)) func(call otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		fn(v.env, call)
+		return otto.UndefinedValue()
+	}
+}
+
+// requestFunc the request can't be changed in the post script
+func (v *scriptVM) requestFunc(fn func(env *scriptEnv, call otto.FunctionCall)) func(call otto.FunctionCall) otto.Value {
+	return v.voidFunc(func(env *scriptEnv, call otto.FunctionCall) {
+		if env.post {
+			panic(call.Otto.MakeTypeError(scriptRequestReadOnly))
+		}
+
+		fn(env, call)
+	})
+}
+
+// statusArg returns the status code of the first arg, throws a RangeError if it's invalid
+func statusArg(call otto.FunctionCall, message string) int {
+	value, err := call.Argument(0).ToInteger()
+	if err != nil || http.StatusText(int(value)) == "" {
+		panic(call.Otto.MakeRangeError(fmt.Sprintf("%s: %s", message, call.Argument(0).String())))
+	}
+
+	return int(value)
+}
+
+// stringArg returns the string value of the arg, or empty if it's undefined or null
+func stringArg(call otto.FunctionCall, index int) string {
+	value := call.Argument(index)
+	if value.IsUndefined() || value.IsNull() {
+		return ""
+	}
+
+	return value.String()
+}
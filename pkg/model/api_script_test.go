@@ -0,0 +1,234 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestCheckScript(t *testing.T) {
+	cases := []struct {
+		script *APIScript
+		ok     bool
+	}{
+		{script: &APIScript{}, ok: true},
+		{script: &APIScript{Pre: `req.setHeader("X-User", req.header("X-Token"));`}, ok: true},
+		{script: &APIScript{Post: `if (res.status() >= 500) { res.setBody("failed"); }`}, ok: true},
+		{script: &APIScript{Pre: `if (req.header("X-Token") == "" {`}, ok: false},
+		{script: &APIScript{Post: `var a = ;`}, ok: false},
+	}
+
+	for _, c := range cases {
+		err := c.script.Check()
+		if (err == nil) != c.ok {
+			t.Errorf("script %+v expect ok %v, but %v", c.script, c.ok, err)
+		}
+	}
+}
+
+func newScriptTestAPI(pre, post string, timeout int) *API {
+	api := &API{
+		URL:     "/users/(\\d+)",
+		Pattern: regexp.MustCompile(`^/users/(\d+)`),
+		Script: &APIScript{
+			Pre:     pre,
+			Post:    post,
+			Timeout: timeout,
+		},
+	}
+	api.Script.parse(api.URL)
+
+	return api
+}
+
+func TestParseAndRunScript(t *testing.T) {
+	api := newScriptTestAPI(`
+req.setHeader("X-User", "user-" + req.param("1"));
+req.delQuery("debug");
+if (req.header("X-Token") == "") {
+	reject(401, '{"error":"missing token"}');
+}
+req.setPath("/v2/users/" + req.param("1"));
+attrs.set("user.id", req.param("1"));`,
+		`res.setHeader("X-Status", String(res.status()));
+res.setHeader("X-User", attrs.get("user.id"));`, 0)
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/10?debug=1&a=b")
+	origin := &fasthttp.Response{}
+	code, err := api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, origin, nil)
+	if err != ErrScriptRejected || code != fasthttp.StatusUnauthorized {
+		t.Errorf("expect rejected with 401, but %d %v", code, err)
+	}
+
+	if string(origin.Body()) != `{"error":"missing token"}` {
+		t.Errorf("unexpected reject body: %s", origin.Body())
+	}
+
+	attrs := testScriptAttrs(make(map[string]string))
+	req = &fasthttp.Request{}
+	req.SetRequestURI("/users/10?debug=1&a=b")
+	req.Header.Set("X-Token", "t")
+	code, err = api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, &fasthttp.Response{}, attrs)
+	if err != nil || code != fasthttp.StatusOK {
+		t.Errorf("expect allowed, but %d %v", code, err)
+	}
+
+	if string(req.Header.Peek("X-User")) != "user-10" {
+		t.Errorf("unexpected header: %s", req.Header.Peek("X-User"))
+	}
+
+	if string(req.URI().RequestURI()) != "/v2/users/10?a=b" {
+		t.Errorf("unexpected uri: %s", req.URI().RequestURI())
+	}
+
+	res := &fasthttp.Response{}
+	res.SetStatusCode(fasthttp.StatusCreated)
+	origin = &fasthttp.Response{}
+	api.RunScript(ScriptPhasePost, req, nil, "127.0.0.1", res, origin, attrs)
+	if string(res.Header.Peek("X-Status")) != "201" || string(origin.Header.Peek("X-Status")) != "201" {
+		t.Errorf("unexpected response header: %s", res.Header.Peek("X-Status"))
+	}
+
+	if string(res.Header.Peek("X-User")) != "10" {
+		t.Errorf("unexpected attr: %s", res.Header.Peek("X-User"))
+	}
+}
+
+func TestRunScriptErrors(t *testing.T) {
+	cases := []struct {
+		pre    string
+		post   string
+		code   int
+		err    error
+		nonNil bool
+	}{
+		// the rejection can't be caught by the script
+		{pre: `try { reject(403); } catch (e) {} req.setHeader("X-Caught", "1");`, code: fasthttp.StatusForbidden, err: ErrScriptRejected},
+		{pre: `reject(200);`, code: fasthttp.StatusInternalServerError, nonNil: true},
+		{post: `req.setHeader("X-User", "u");`, code: fasthttp.StatusInternalServerError, nonNil: true},
+		{post: `res.setStatus(42);`, code: fasthttp.StatusInternalServerError, nonNil: true},
+		{pre: `console.log("a");`, code: fasthttp.StatusInternalServerError, nonNil: true},
+		{pre: `function f() { return f(); } f();`, code: fasthttp.StatusInternalServerError, nonNil: true},
+		{pre: `throw new Error("failed");`, code: fasthttp.StatusInternalServerError, nonNil: true},
+		{pre: `req.setHeader("X-Json", req.json("user.name"));`, code: fasthttp.StatusOK},
+	}
+
+	for i, c := range cases {
+		api := newScriptTestAPI(c.pre, c.post, 0)
+
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/users/10")
+		req.SetBodyString(`{"user":{"name":"a"}}`)
+
+		phase := ScriptPhasePre
+		if c.post != "" {
+			phase = ScriptPhasePost
+		}
+
+		code, err := api.RunScript(phase, req, api.matchURI(req), "127.0.0.1", &fasthttp.Response{}, &fasthttp.Response{}, nil)
+		if code != c.code || (c.nonNil && err == nil) || (!c.nonNil && err != c.err) {
+			t.Errorf("case %d: expect %d %v, but %d %v", i, c.code, c.err, code, err)
+		}
+
+		if len(req.Header.Peek("X-Caught")) > 0 {
+			t.Errorf("case %d: expect the script stopped by reject", i)
+		}
+	}
+}
+
+func TestRunScriptTimeout(t *testing.T) {
+	api := newScriptTestAPI(`while (true) { try { var a = 1; } catch (e) {} }`, "", 20)
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/10")
+
+	start := time.Now()
+	code, err := api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, &fasthttp.Response{}, nil)
+	if err != ErrScriptTimeout || code != fasthttp.StatusInternalServerError {
+		t.Errorf("expect timeout, but %d %v", code, err)
+	}
+
+	if time.Since(start) > time.Second {
+		t.Errorf("expect interrupted after the timeout, but %s", time.Since(start))
+	}
+}
+
+type testScriptAttrs map[string]string
+
+func (attrs testScriptAttrs) GetStringAttr(key string) string {
+	return attrs[key]
+}
+
+func (attrs testScriptAttrs) SetAttr(key string, value interface{}) {
+	if nil == value {
+		delete(attrs, key)
+		return
+	}
+
+	attrs[key] = value.(string)
+}
+
+func TestRunScriptReuseInterpreter(t *testing.T) {
+	api := newScriptTestAPI(`if (typeof seen !== "undefined") { reject(409); }
+var seen = req.header("X-Seen");
+req.setHeader("X-Seen", "1");`, "", 0)
+
+	for i := 0; i < 3; i++ {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/users/10")
+		code, err := api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, &fasthttp.Response{}, nil)
+		if err != nil || code != fasthttp.StatusOK || string(req.Header.Peek("X-Seen")) != "1" {
+			t.Fatalf("expect run %d not see the vars of the last run, but %d %+v", i, code, err)
+		}
+	}
+}
+
+func TestRunScriptResetGlobals(t *testing.T) {
+	api := newScriptTestAPI(`if (typeof leaked !== "undefined" || typeof this.other !== "undefined") { reject(409); }
+leaked = req.header("X-Seen");
+this.other = 1;
+req.header = function() { return "changed"; };
+req = null;
+res = null;`, "", 0)
+
+	for i := 0; i < 3; i++ {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/users/10")
+		req.Header.Set("X-Seen", "1")
+		code, err := api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, &fasthttp.Response{}, nil)
+		if err != nil || code != fasthttp.StatusOK {
+			t.Fatalf("expect run %d not see the globals of the last run, but %d %+v", i, code, err)
+		}
+	}
+
+	api = newScriptTestAPI(`if (req.header("X-Seen") != "1") { reject(409); }
+req.header = function() { return "changed"; };
+req = null;`, "", 0)
+
+	for i := 0; i < 3; i++ {
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/users/10")
+		req.Header.Set("X-Seen", "1")
+		code, err := api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, &fasthttp.Response{}, nil)
+		if err != nil || code != fasthttp.StatusOK {
+			t.Fatalf("expect run %d use the bound objects, but %d %+v", i, code, err)
+		}
+	}
+}
+
+func BenchmarkRunScript(b *testing.B) {
+	api := newScriptTestAPI(`req.setHeader("a", "b");`, "", 0)
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/10")
+	origin := &fasthttp.Response{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		api.RunScript(ScriptPhasePre, req, api.matchURI(req), "127.0.0.1", nil, origin, nil)
+	}
+}
@@ -0,0 +1,170 @@
+package model
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/util"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// HeaderSignatureKeyID header of the consumer id who signed the request
+	HeaderSignatureKeyID = "X-Signature-Key-ID"
+	// HeaderSignatureTimestamp header of the unix seconds when the request signed
+	HeaderSignatureTimestamp = "X-Signature-Timestamp"
+	// HeaderSignatureNonce header of the random string, can only be used once
+	HeaderSignatureNonce = "X-Signature-Nonce"
+	// HeaderSignature header of the base64 HMAC-SHA256 signature
+	HeaderSignature = "X-Signature"
+
+	// DefaultSignatureClockSkew default max seconds between the signed time and the proxy time
+	DefaultSignatureClockSkew = 300
+
+	// maxSignatureNonces the max nonces of a consumer in the clock skew window
+	maxSignatureNonces = 102400
+)
+
+var (
+	// ErrMissingSignature request has no signature headers
+	ErrMissingSignature = errors.New("Missing signature")
+	// ErrSignatureExpired the signed time is out of the clock skew window
+	ErrSignatureExpired = errors.New("Signature expired")
+	// ErrSignatureInvalid signature not matches
+	ErrSignatureInvalid = errors.New("Invalid signature")
+	// ErrSignatureReplayed the nonce is already used
+	ErrSignatureReplayed = errors.New("Signature replayed")
+	// ErrSignatureNoncesFull the consumer used too many nonces in the clock skew window, the request can't be checked
+	ErrSignatureNoncesFull = errors.New("Too many signed requests")
+)
+
+// signatureNonces the used nonces of the consumers, every consumer has its own set,
+// so a consumer can't use up the nonces of the others
+type signatureNonces struct {
+	sync.Mutex
+
+	maxSize int
+	sets    map[string]*util.ExpireSet // consumer id -> nonces
+}
+
+func newSignatureNonces(maxSize int) *signatureNonces {
+	return &signatureNonces{
+		maxSize: maxSize,
+		sets:    make(map[string]*util.ExpireSet),
+	}
+}
+
+func (n *signatureNonces) add(id, nonce string, expireAt, now time.Time) error {
+	n.Lock()
+	set, ok := n.sets[id]
+	if !ok {
+		set = util.NewExpireSet(n.maxSize)
+		n.sets[id] = set
+	}
+	n.Unlock()
+
+	return set.Add(nonce, expireAt, now)
+}
+
+func (n *signatureNonces) remove(id string) {
+	n.Lock()
+	delete(n.sets, id)
+	n.Unlock()
+}
+
+// SignatureRule the request signature setting of a api.
+// The signature is base64(HMAC-SHA256(consumer secret, string to sign)), and the string to sign is
+// method + "\n" + request uri + "\n" + timestamp + "\n" + nonce + "\n" + hex(sha256(body))
+type SignatureRule struct {
+	// ClockSkew max seconds between the signed time and the proxy time, default is 300
+	ClockSkew int `json:"clockSkew,omitempty"`
+}
+
+func (s *SignatureRule) clockSkew() time.Duration {
+	if s.ClockSkew > 0 {
+		return time.Duration(s.ClockSkew) * time.Second
+	}
+
+	return time.Duration(DefaultSignatureClockSkew) * time.Second
+}
+
+// VerifySignature verify the signature of the request, returns the consumer who signed the request.
+// The req is the request of the client, not rewritten by the nodes, and it's verified once a request,
+// otherwise the nonce is replayed by the other nodes of the api.
+// The used nonces are kept by every proxy, a nonce can be replayed to the other proxies in the clock skew window.
+// Returns empty consumer and nil error if the api not require signature.
+func (r *RouteTable) VerifySignature(api *API, req *fasthttp.Request, now time.Time) (string, error) {
+	if nil == api.Signature {
+		return "", nil
+	}
+
+	id := string(req.Header.Peek(HeaderSignatureKeyID))
+	timestamp := string(req.Header.Peek(HeaderSignatureTimestamp))
+	nonce := string(req.Header.Peek(HeaderSignatureNonce))
+	signature := req.Header.Peek(HeaderSignature)
+	if id == "" || timestamp == "" || nonce == "" || len(signature) == 0 {
+		return "", ErrMissingSignature
+	}
+
+	secs, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", ErrSignatureInvalid
+	}
+
+	skew := api.Signature.clockSkew()
+	signedAt := time.Unix(secs, 0)
+	if signedAt.Before(now.Add(-skew)) || signedAt.After(now.Add(skew)) {
+		return "", ErrSignatureExpired
+	}
+
+	r.rwLock.RLock()
+	consumer, ok := r.consumers[id]
+	r.rwLock.RUnlock()
+
+	if !ok || consumer.Secret == "" {
+		return "", ErrSignatureInvalid
+	}
+
+	expect := signRequest(consumer.Secret, req, timestamp, nonce)
+	actual, err := base64.StdEncoding.DecodeString(string(signature))
+	if err != nil || !hmac.Equal(expect, actual) {
+		return "", ErrSignatureInvalid
+	}
+
+	// the signed time is checked, so the nonce only need to be kept in the clock skew window
+	err = r.nonces.add(id, nonce, signedAt.Add(skew), now)
+	if err == util.ErrSetFull {
+		return "", ErrSignatureNoncesFull
+	} else if err != nil {
+		return "", ErrSignatureReplayed
+	}
+
+	if consumer.Disabled || (nil != api.Consumers && !api.Consumers.allow(consumer)) {
+		return consumer.ID, ErrConsumerForbidden
+	}
+
+	return consumer.ID, nil
+}
+
+func signRequest(secret string, req *fasthttp.Request, timestamp, nonce string) []byte {
+	bodyHash := sha256.Sum256(req.Body())
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(req.Header.Method())
+	mac.Write([]byte("\n"))
+	mac.Write(req.RequestURI())
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("\n"))
+	mac.Write([]byte(hex.EncodeToString(bodyHash[:])))
+
+	return mac.Sum(nil)
+}
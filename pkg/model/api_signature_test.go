@@ -0,0 +1,123 @@
+package model
+
+import (
+	"encoding/base64"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newTestSignedRequest(secret, id, nonce string, signedAt time.Time) *fasthttp.Request {
+	req := &fasthttp.Request{}
+	req.Header.SetMethod("POST")
+	req.SetRequestURI("/orders?a=b")
+	req.SetBodyString(`{"id":1}`)
+
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req.Header.Set(HeaderSignatureKeyID, id)
+	req.Header.Set(HeaderSignatureTimestamp, timestamp)
+	req.Header.Set(HeaderSignatureNonce, nonce)
+	req.Header.Set(HeaderSignature, base64.StdEncoding.EncodeToString(signRequest(secret, req, timestamp, nonce)))
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	r := &RouteTable{
+		rwLock: &sync.RWMutex{},
+		consumers: map[string]*Consumer{
+			"c1": {ID: "c1", Secret: "s1", Groups: []string{"partners"}},
+			"c2": {ID: "c2", Secret: "s2"},
+		},
+		nonces: newSignatureNonces(maxSignatureNonces),
+	}
+
+	api := &API{
+		Signature: &SignatureRule{ClockSkew: 60},
+		Consumers: &ConsumerControl{Groups: []string{"partners"}},
+	}
+
+	now := time.Now()
+	req := newTestSignedRequest("s1", "c1", "n1", now)
+	if consumer, err := r.VerifySignature(api, req, now); err != nil || consumer != "c1" {
+		t.Fatalf("expect verified, but %s %+v", consumer, err)
+	}
+
+	if _, err := r.VerifySignature(api, req, now); err != ErrSignatureReplayed {
+		t.Errorf("expect replayed, but %+v", err)
+	}
+
+	req = newTestSignedRequest("s1", "c1", "n2", now.Add(-time.Minute*2))
+	if _, err := r.VerifySignature(api, req, now); err != ErrSignatureExpired {
+		t.Errorf("expect expired, but %+v", err)
+	}
+
+	req = newTestSignedRequest("s2", "c1", "n3", now)
+	if _, err := r.VerifySignature(api, req, now); err != ErrSignatureInvalid {
+		t.Errorf("expect invalid signature, but %+v", err)
+	}
+
+	req = newTestSignedRequest("s1", "c1", "n4", now)
+	req.SetRequestURI("/orders?a=c")
+	if _, err := r.VerifySignature(api, req, now); err != ErrSignatureInvalid {
+		t.Errorf("expect invalid signature of the changed uri, but %+v", err)
+	}
+
+	req = newTestSignedRequest("s2", "c2", "n5", now)
+	if _, err := r.VerifySignature(api, req, now); err != ErrConsumerForbidden {
+		t.Errorf("expect consumer forbidden, but %+v", err)
+	}
+
+	if _, err := r.VerifySignature(api, &fasthttp.Request{}, now); err != ErrMissingSignature {
+		t.Errorf("expect missing signature, but %+v", err)
+	}
+
+	if consumer, err := r.VerifySignature(&API{}, &fasthttp.Request{}, now); err != nil || consumer != "" {
+		t.Errorf("expect api without signature skipped, but %s %+v", consumer, err)
+	}
+}
+
+func TestVerifySignatureNoncesFull(t *testing.T) {
+	r := &RouteTable{
+		rwLock: &sync.RWMutex{},
+		consumers: map[string]*Consumer{
+			"c1": {ID: "c1", Secret: "s1"},
+			"c2": {ID: "c2", Secret: "s2"},
+		},
+		nonces: newSignatureNonces(1),
+	}
+
+	api := &API{Signature: &SignatureRule{ClockSkew: 60}}
+
+	now := time.Now()
+	if _, err := r.VerifySignature(api, newTestSignedRequest("s1", "c1", "n1", now), now); err != nil {
+		t.Fatalf("expect verified, but %+v", err)
+	}
+
+	if _, err := r.VerifySignature(api, newTestSignedRequest("s1", "c1", "n2", now), now); err != ErrSignatureNoncesFull {
+		t.Errorf("expect nonces full, but %+v", err)
+	}
+
+	// the nonces of a consumer don't limit the others
+	if _, err := r.VerifySignature(api, newTestSignedRequest("s2", "c2", "n1", now), now); err != nil {
+		t.Errorf("expect verified, but %+v", err)
+	}
+
+	later := now.Add(time.Minute * 2)
+	if _, err := r.VerifySignature(api, newTestSignedRequest("s1", "c1", "n3", later), later); err != nil {
+		t.Errorf("expect verified after the nonces expired, but %+v", err)
+	}
+}
+
+func TestConsumerMasked(t *testing.T) {
+	consumer := &Consumer{ID: "c1", Secret: "s1"}
+	if consumer.Masked().Secret != MaskedSecret || consumer.Secret != "s1" {
+		t.Errorf("expect a masked copy, but %s %s", consumer.Masked().Secret, consumer.Secret)
+	}
+
+	if (&Consumer{ID: "c2"}).Masked().Secret != "" {
+		t.Error("expect empty secret not masked")
+	}
+}
@@ -1,28 +1,97 @@
 package model
 
 import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/mail"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/fagongzi/log"
 	"github.com/valyala/fasthttp"
 )
 
+const (
+	jsonContentType = "application/json"
+)
+
 const (
 	// FromQueryString query string
 	FromQueryString = iota
 	// FromForm form data
 	FromForm
+	// FromHeader header
+	FromHeader
+	// FromCookie cookie
+	FromCookie
+	// FromPath path parameter extracted by the api url pattern, the attr is the group name or the group index
+	FromPath
+	// FromJSONBody field of the json body, the attr is a dot path like user.name or items.0.id
+	FromJSONBody
 )
 
 const (
 	// Regexp reg type
 	Regexp = iota
+	// Range numeric range, expression is min,max, either bound can be omitted, like 1,100 or ,100
+	Range
+	// Length length range, expression is min,max like Range
+	Length
+	// Enum enum values, expression is values separated by comma, like a,b,c
+	Enum
+	// Format value format, expression is one of email, uuid, date, datetime, ip, integer, number
+	Format
+)
+
+var (
+	validationSources = []string{"query", "form", "header", "cookie", "path", "body"}
+
+	uuidPattern = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+	validationFormats = map[string]func(value string) bool{
+		"email": func(value string) bool {
+			addr, err := mail.ParseAddress(value)
+			return err == nil && addr.Address == value
+		},
+		"uuid": func(value string) bool {
+			return uuidPattern.MatchString(value)
+		},
+		"date": func(value string) bool {
+			_, err := time.Parse("2006-01-02", value)
+			return err == nil
+		},
+		"datetime": func(value string) bool {
+			_, err := time.Parse(time.RFC3339, value)
+			return err == nil
+		},
+		"ip": func(value string) bool {
+			return nil != net.ParseIP(value)
+		},
+		"integer": func(value string) bool {
+			_, err := strconv.ParseInt(value, 10, 64)
+			return err == nil
+		},
+		"number": func(value string) bool {
+			_, err := strconv.ParseFloat(value, 64)
+			return err == nil
+		},
+	}
 )
 
 // ValidationRule validation rule
 type ValidationRule struct {
 	Type       int    `json:"type, omitempty"`
 	Expression string `json:"expression, omitempty"`
-	pattern    *regexp.Regexp
+
+	pattern  *regexp.Regexp
+	min, max *float64
+	values   map[string]bool
+	format   func(value string) bool
+	invalid  bool
 }
 
 // Validation validate rule
@@ -33,62 +102,238 @@ type Validation struct {
 	Rules    []*ValidationRule `json:"rules, omitempty"`
 }
 
-func (v ValidationRule) validate(value []byte) bool {
-	return v.pattern.Match(value)
+func (r *ValidationRule) parse() error {
+	switch r.Type {
+	case Regexp:
+		pattern, err := regexp.Compile(r.Expression)
+		if err != nil {
+			return err
+		}
+		r.pattern = pattern
+	case Range, Length:
+		min, max, err := parseValidationRange(r.Expression)
+		if err != nil {
+			return err
+		}
+		r.min, r.max = min, max
+	case Enum:
+		r.values = make(map[string]bool)
+		for _, value := range strings.Split(r.Expression, ",") {
+			r.values[strings.TrimSpace(value)] = true
+		}
+	case Format:
+		format, ok := validationFormats[r.Expression]
+		if !ok {
+			return fmt.Errorf("unknown format: %s", r.Expression)
+		}
+		r.format = format
+	default:
+		return fmt.Errorf("unknown validation rule type: %d", r.Type)
+	}
+
+	return nil
+}
+
+func (r *ValidationRule) validate(value []byte) bool {
+	if r.invalid {
+		return false
+	}
+
+	switch r.Type {
+	case Regexp:
+		return r.pattern.Match(value)
+	case Range:
+		number, err := strconv.ParseFloat(string(value), 64)
+		return err == nil && r.inRange(number)
+	case Length:
+		return r.inRange(float64(utf8.RuneCount(value)))
+	case Enum:
+		return r.values[string(value)]
+	case Format:
+		return r.format(string(value))
+	}
+
+	return true
+}
+
+// reason returns why the value is invalid
+func (r *ValidationRule) reason() string {
+	if r.invalid {
+		return "has a invalid validation rule"
+	}
+
+	switch r.Type {
+	case Range:
+		return fmt.Sprintf("must be a number in range [%s]", r.Expression)
+	case Length:
+		return fmt.Sprintf("length must be in range [%s]", r.Expression)
+	case Enum:
+		return fmt.Sprintf("must be one of %s", r.Expression)
+	case Format:
+		return fmt.Sprintf("must be a valid %s", r.Expression)
+	}
+
+	return fmt.Sprintf("must match %s", r.Expression)
+}
+
+func (r *ValidationRule) inRange(value float64) bool {
+	return (nil == r.min || value >= *r.min) && (nil == r.max || value <= *r.max)
+}
+
+// Check check the rules of the validation
+func (v Validation) Check() error {
+	for _, rule := range v.Rules {
+		err := rule.parse()
+		if err != nil {
+			return fmt.Errorf("validation of <%s>: %s", v.Attr, err.Error())
+		}
+	}
+
+	return nil
 }
 
-// ParseValidation parse validation
+// ParseValidation parse validation, the requests are rejected by the invalid rules
 func (v Validation) ParseValidation() {
-	if v.Rules != nil {
-		for _, rule := range v.Rules {
-			rule.pattern = regexp.MustCompile(rule.Expression)
+	for _, rule := range v.Rules {
+		err := rule.parse()
+		rule.invalid = err != nil
+		if err != nil {
+			log.Errorf("meta: validation rule of <%s> is invalid, the requests are rejected, rule=<%+v> errors:\n%+v",
+				v.Attr,
+				rule,
+				err)
 		}
 	}
 }
 
-func (v Validation) getValue(req *fasthttp.Request) []byte {
-	if v.GetFrom == FromQueryString {
+func (v Validation) field() string {
+	if v.GetFrom == FromJSONBody {
+		return schemaRootPath + "." + v.Attr
+	}
+
+	if v.GetFrom >= 0 && v.GetFrom < len(validationSources) {
+		return validationSources[v.GetFrom] + "." + v.Attr
+	}
+
+	return v.Attr
+}
+
+func (v Validation) getValue(ctx *requestContext) []byte {
+	req := ctx.req
+
+	switch v.GetFrom {
+	case FromQueryString:
 		return req.URI().QueryArgs().Peek(v.Attr)
-	} else if v.GetFrom == FromForm {
+	case FromForm:
 		return req.PostArgs().Peek(v.Attr)
+	case FromHeader:
+		return req.Header.Peek(v.Attr)
+	case FromCookie:
+		return req.Header.Cookie(v.Attr)
+	case FromPath:
+		return ctx.getPathValue(v.Attr)
+	case FromJSONBody:
+		return ctx.getBodyValue(v.Attr)
 	}
 
 	return nil
 }
 
-func (v Validation) validate(req *fasthttp.Request) bool {
+func (v Validation) validate(ctx *requestContext) *Violation {
 	if nil == v.Rules || len(v.Rules) == 0 {
-		return true
+		return nil
 	}
 
-	value := v.getValue(req)
+	for _, rule := range v.Rules {
+		if rule.invalid {
+			return newViolation(v.field(), "%s", rule.reason())
+		}
+	}
+
+	value := v.getValue(ctx)
 
 	if nil == value && v.Required {
-		return false
+		return newViolation(v.field(), "is required")
 	} else if nil == value && !v.Required {
-		return true
+		return nil
 	}
 
 	for _, rule := range v.Rules {
 		if !rule.validate(value) {
-			return false
+			return newViolation(v.field(), "%s", rule.reason())
 		}
 	}
 
-	return true
+	return nil
 }
 
-// Validate validate request
-func (n *Node) Validate(req *fasthttp.Request) bool {
-	if n.Validations == nil || len(n.Validations) == 0 {
-		return true
+// Validate validate request by the validations and the body schemas of the api and node.
+// The path params are captured by the router from the origin request, because the request may be rewritten.
+func (a *API) Validate(node *Node, req *fasthttp.Request, params PathParams) []*Violation {
+	ctx := &requestContext{
+		req:     req,
+		pattern: a.Pattern,
+		params:  params,
 	}
 
-	for _, validation := range n.Validations {
-		if !validation.validate(req) {
-			return false
+	violations := validateBody(a.BodySchema, req)
+
+	for _, validation := range node.Validations {
+		if violation := validation.validate(ctx); nil != violation {
+			violations = append(violations, violation)
 		}
 	}
 
-	return true
+	return append(violations, validateBody(node.BodySchema, req)...)
+}
+
+func validateBody(schema *JSONSchema, req *fasthttp.Request) []*Violation {
+	if nil == schema {
+		return nil
+	}
+
+	if !bytes.HasPrefix(req.Header.ContentType(), []byte(jsonContentType)) {
+		return []*Violation{newViolation(schemaRootPath, "content type must be %s", jsonContentType)}
+	}
+
+	return schema.ValidateBody(req.Body())
+}
+
+func parseBodySchema(schema *JSONSchema, owner string) *JSONSchema {
+	if nil == schema {
+		return nil
+	}
+
+	err := schema.Parse()
+	schema.invalid = err != nil
+	if err != nil {
+		log.Errorf("meta: body schema of <%s> is invalid, all the bodies are rejected, errors:\n%+v",
+			owner,
+			err)
+	}
+
+	return schema
+}
+
+func parseValidationRange(expression string) (*float64, *float64, error) {
+	values := strings.Split(expression, ",")
+	if len(values) != 2 {
+		return nil, nil, fmt.Errorf("invalid range: %s, must be min,max", expression)
+	}
+
+	var bounds [2]*float64
+	for index, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+
+		bound, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid range: %s, %s", expression, err)
+		}
+		bounds[index] = &bound
+	}
+
+	return bounds[0], bounds[1], nil
 }
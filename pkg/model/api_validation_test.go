@@ -0,0 +1,130 @@
+package model
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newTestValidationAPI(validations ...*Validation) (*API, *Node) {
+	node := &Node{
+		Validations: validations,
+	}
+
+	for _, v := range validations {
+		v.ParseValidation()
+	}
+
+	return &API{Pattern: regexp.MustCompile(`^/users/(?P<id>\d+)$`)}, node
+}
+
+func TestValidationSources(t *testing.T) {
+	api, node := newTestValidationAPI(
+		&Validation{Attr: "X-Token", GetFrom: FromHeader, Required: true, Rules: []*ValidationRule{{Type: Length, Expression: "4,8"}}},
+		&Validation{Attr: "lang", GetFrom: FromCookie, Rules: []*ValidationRule{{Type: Enum, Expression: "en,zh"}}},
+		&Validation{Attr: "id", GetFrom: FromPath, Required: true, Rules: []*ValidationRule{{Type: Range, Expression: "1,"}}},
+		&Validation{Attr: "user.email", GetFrom: FromJSONBody, Required: true, Rules: []*ValidationRule{{Type: Format, Expression: "email"}}},
+	)
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/users/10")
+	req.Header.Set("X-Token", "abcde")
+	req.Header.SetCookie("lang", "en")
+	req.SetBodyString(`{"user": {"email": "a@example.com"}}`)
+
+	violations := api.Validate(node, req, api.matchURI(req))
+	if len(violations) != 0 {
+		t.Errorf("expect no violations, but %+v", violations[0])
+	}
+
+	req.Header.Set("X-Token", "abc")
+	req.Header.SetCookie("lang", "fr")
+	req.SetBodyString(`{"user": {"email": "example.com"}}`)
+
+	violations = api.Validate(node, req, PathParams{nil, []byte("0")})
+	expects := []string{"header.X-Token", "cookie.lang", "path.id", "$.user.email"}
+	if len(violations) != len(expects) {
+		t.Fatalf("expect %d violations, but %d", len(expects), len(violations))
+	}
+
+	for index, field := range expects {
+		if violations[index].Field != field {
+			t.Errorf("expect violation of %s, but %s", field, violations[index].Field)
+		}
+	}
+}
+
+func TestValidationFormats(t *testing.T) {
+	cases := map[string][]string{
+		"uuid":     {"3f2504e0-4f89-11d3-9a0c-0305e82c3301", "3f2504e0"},
+		"date":     {"2017-01-02", "2017-13-02"},
+		"datetime": {"2017-01-02T15:04:05Z", "2017-01-02 15:04:05"},
+		"ip":       {"::1", "1.2.3"},
+	}
+
+	for format, values := range cases {
+		rule := &ValidationRule{Type: Format, Expression: format}
+		if err := rule.parse(); err != nil {
+			t.Fatalf("parse format %s failed: %+v", format, err)
+		}
+
+		if !rule.validate([]byte(values[0])) {
+			t.Errorf("expect %s is a valid %s", values[0], format)
+		}
+
+		if rule.validate([]byte(values[1])) {
+			t.Errorf("expect %s is not a valid %s", values[1], format)
+		}
+	}
+}
+
+func TestValidationInvalidRules(t *testing.T) {
+	rules := []*ValidationRule{
+		{Type: Regexp, Expression: "("},
+		{Type: Range, Expression: "1"},
+		{Type: Length, Expression: "a,b"},
+		{Type: Format, Expression: "unknown"},
+		{Type: 100, Expression: "abc"},
+	}
+
+	for _, rule := range rules {
+		v := &Validation{Attr: "abc", Rules: []*ValidationRule{rule}}
+		if err := v.Check(); err == nil {
+			t.Errorf("expect check error of the rule %+v", rule)
+		}
+
+		api, node := newTestValidationAPI(v)
+
+		req := &fasthttp.Request{}
+		req.SetRequestURI("/users/10")
+
+		violations := api.Validate(node, req, api.matchURI(req))
+		if len(violations) != 1 || violations[0].Field != "query.abc" {
+			t.Errorf("expect the invalid rule %+v rejects the request, but %+v", rule, violations)
+		}
+	}
+}
+
+func TestAPICheckValidations(t *testing.T) {
+	api := &API{
+		Nodes: []*Node{{ClusterName: "c", Validations: []*Validation{
+			{Attr: "abc", Rules: []*ValidationRule{{Type: Enum, Expression: "a,b"}}},
+		}}},
+	}
+
+	if err := api.Check(); err != nil {
+		t.Errorf("expect check ok, but %+v", err)
+	}
+
+	api.Nodes[0].Validations[0].Rules = append(api.Nodes[0].Validations[0].Rules, &ValidationRule{Type: Regexp, Expression: "["})
+	if err := api.Check(); err == nil {
+		t.Error("expect check error of the invalid rule")
+	}
+
+	api.Nodes[0].Validations = nil
+	api.BodySchema = &JSONSchema{Type: "map"}
+	if err := api.Check(); err == nil {
+		t.Error("expect check error of the invalid body schema")
+	}
+}
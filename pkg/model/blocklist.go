@@ -0,0 +1,243 @@
+package model
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/util"
+	"github.com/fagongzi/goetty"
+	"github.com/fagongzi/log"
+)
+
+const (
+	blockedIPTimerPrefix = "Blocked-"
+)
+
+// BlockedIP a entry of the global blocklist, the requests from the ip are rejected by all the proxies.
+type BlockedIP struct {
+	ID string `json:"id,omitempty"`
+	// IP a CIDR, a single ip or a ipv4 with tail wildcards
+	IP     string `json:"ip"`
+	Reason string `json:"reason,omitempty"`
+	// Auto the entry is added by the auto ban rule
+	Auto bool `json:"auto,omitempty"`
+	// ExpireAt unix seconds when the entry expired, 0 means never
+	ExpireAt int64 `json:"expireAt,omitempty"`
+
+	ipNet *net.IPNet
+}
+
+// UnMarshalBlockedIP unmarshal
+func UnMarshalBlockedIP(data []byte) *BlockedIP {
+	v := &BlockedIP{}
+	json.Unmarshal(data, v)
+
+	return v
+}
+
+// UnMarshalBlockedIPFromReader unmarshal from reader
+func UnMarshalBlockedIPFromReader(r io.Reader) (*BlockedIP, error) {
+	v := &BlockedIP{}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(v)
+
+	if v.ID == "" {
+		v.ID = goetty.NewV4UUID()
+	}
+
+	return v, err
+}
+
+// Marshal marshal
+func (b *BlockedIP) Marshal() []byte {
+	v, _ := json.Marshal(b)
+	return v
+}
+
+// Check check config
+func (b *BlockedIP) Check() error {
+	return b.parse()
+}
+
+// Expired returns true if the entry is expired at the time
+func (b *BlockedIP) Expired(now time.Time) bool {
+	return b.ExpireAt > 0 && b.ExpireAt <= now.Unix()
+}
+
+func (b *BlockedIP) parse() error {
+	ipNet, err := util.ParseIPRange(b.IP)
+	if err != nil {
+		return err
+	}
+
+	b.ipNet = ipNet
+	return nil
+}
+
+func (b *BlockedIP) isSingle() bool {
+	ones, bits := b.ipNet.Mask.Size()
+	return ones == bits
+}
+
+// blocklist the single ips are indexed by a map, the auto bans are always single ips.
+// A ip may have many entries, e.g. a short auto ban and a long ban added by admin.
+type blocklist struct {
+	entries map[string]*BlockedIP   // id -> entry
+	singles map[string][]*BlockedIP // ip -> entries
+	ranges  []*BlockedIP
+}
+
+func newBlocklist() *blocklist {
+	return &blocklist{
+		entries: make(map[string]*BlockedIP),
+		singles: make(map[string][]*BlockedIP),
+	}
+}
+
+func (l *blocklist) add(b *BlockedIP) {
+	l.remove(b.ID)
+
+	l.entries[b.ID] = b
+	if b.isSingle() {
+		ip := b.ipNet.IP.String()
+		l.singles[ip] = append(l.singles[ip], b)
+	} else {
+		l.ranges = append(l.ranges, b)
+	}
+}
+
+func (l *blocklist) remove(id string) bool {
+	b, ok := l.entries[id]
+	if !ok {
+		return false
+	}
+
+	delete(l.entries, id)
+	if b.isSingle() {
+		ip := b.ipNet.IP.String()
+		l.singles[ip] = removeBlockedIP(l.singles[ip], b)
+		if len(l.singles[ip]) == 0 {
+			delete(l.singles, ip)
+		}
+
+		return true
+	}
+
+	l.ranges = removeBlockedIP(l.ranges, b)
+	return true
+}
+
+func removeBlockedIP(values []*BlockedIP, b *BlockedIP) []*BlockedIP {
+	for index, value := range values {
+		if value == b {
+			return append(values[:index], values[index+1:]...)
+		}
+	}
+
+	return values
+}
+
+// get returns the entry which contains the ip and not expired
+func (l *blocklist) get(ip net.IP, now time.Time) *BlockedIP {
+	if nil == ip {
+		return nil
+	}
+
+	if v4 := ip.To4(); nil != v4 {
+		ip = v4
+	}
+
+	for _, b := range l.singles[ip.String()] {
+		if !b.Expired(now) {
+			return b
+		}
+	}
+
+	for _, b := range l.ranges {
+		if !b.Expired(now) && b.ipNet.Contains(ip) {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// IsBlocked returns true if the ip is in the global blocklist
+func (r *RouteTable) IsBlocked(ip string) bool {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	return nil != r.blocklist.get(net.ParseIP(ip), time.Now())
+}
+
+// BanIP add the ip to the global blocklist of this proxy for the duration, it takes effect at once.
+// The returned entry should be saved to the store by SaveBlockedIP, then all the proxies will receive it.
+func (r *RouteTable) BanIP(ip string, reason string, duration time.Duration) (*BlockedIP, error) {
+	blockedIP := &BlockedIP{
+		ID:       goetty.NewV4UUID(),
+		IP:       ip,
+		Reason:   reason,
+		Auto:     true,
+		ExpireAt: time.Now().Add(duration).Unix(),
+	}
+
+	err := r.UpdateBlockedIP(blockedIP)
+	if err != nil {
+		return nil, err
+	}
+
+	return blockedIP, nil
+}
+
+// SaveBlockedIP save the entry to the store, the store removes it after expired if it supports ttl
+func (r *RouteTable) SaveBlockedIP(blockedIP *BlockedIP) error {
+	return r.store.SaveBlockedIP(blockedIP)
+}
+
+func (r *RouteTable) addBlockedIPExpiration(blockedIP *BlockedIP) {
+	key := getBlockedIPTimerKey(blockedIP.ID)
+	r.tw.Cancel(key)
+
+	if blockedIP.ExpireAt > 0 {
+		timeout := time.Unix(blockedIP.ExpireAt, 0).Sub(time.Now())
+		if timeout < time.Second {
+			timeout = time.Second
+		}
+
+		r.tw.AddWithID(timeout, key, r.expireBlockedIP)
+	}
+}
+
+// expireBlockedIP remove the expired entry from the blocklist of this proxy, it's not removed from the store
+// by every proxy, the store removes it by the ttl, or the admin removes it.
+// The timer may be triggered by a replaced one, so check the entry again.
+func (r *RouteTable) expireBlockedIP(key string) {
+	id := strings.TrimPrefix(key, blockedIPTimerPrefix)
+
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	blockedIP, ok := r.blocklist.entries[id]
+	if !ok {
+		return
+	}
+
+	if !blockedIP.Expired(time.Now()) {
+		r.addBlockedIPExpiration(blockedIP)
+		return
+	}
+
+	r.blocklist.remove(id)
+
+	log.Infof("meta: blocked ip <%s> expired, ip=<%s>",
+		blockedIP.ID,
+		blockedIP.IP)
+}
+
+func getBlockedIPTimerKey(id string) string {
+	return blockedIPTimerPrefix + id
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBlocklist(t *testing.T) {
+	now := time.Now()
+	l := newBlocklist()
+
+	for _, b := range []*BlockedIP{
+		{ID: "long", IP: "10.0.0.1", ExpireAt: now.Add(time.Hour).Unix()},
+		{ID: "short", IP: "10.0.0.1", ExpireAt: now.Add(time.Minute).Unix()},
+		{ID: "range", IP: "192.168.0.0/16"},
+	} {
+		if err := b.parse(); err != nil {
+			t.Fatalf("parse %s failed: %+v", b.IP, err)
+		}
+		l.add(b)
+	}
+
+	cases := map[string]bool{
+		"10.0.0.1":        true,
+		"::ffff:10.0.0.1": true,
+		"10.0.0.2":        false,
+		"192.168.1.1":     true,
+	}
+
+	for ip, expect := range cases {
+		if (nil != l.get(net.ParseIP(ip), now)) != expect {
+			t.Errorf("%s expect blocked %v", ip, expect)
+		}
+	}
+
+	// the short ban expired and removed, the long ban still blocks the ip
+	if nil == l.get(net.ParseIP("10.0.0.1"), now.Add(2*time.Minute)) {
+		t.Error("expect blocked by the long ban after the short ban expired")
+	}
+
+	l.remove("short")
+	if nil == l.get(net.ParseIP("10.0.0.1"), now) {
+		t.Error("expect blocked by the long ban after the short ban removed")
+	}
+
+	l.remove("long")
+	if nil != l.get(net.ParseIP("10.0.0.1"), now) || len(l.singles) != 0 {
+		t.Error("expect not blocked after all bans removed")
+	}
+
+	l.remove("range")
+	if nil != l.get(net.ParseIP("192.168.1.1"), now) || len(l.ranges) != 0 {
+		t.Error("expect range removed")
+	}
+}
+
+func TestExpireBlockedIP(t *testing.T) {
+	r := NewRouteTable(nil, nil, nil)
+
+	long := &BlockedIP{ID: "long", IP: "10.0.0.1", ExpireAt: time.Now().Add(time.Hour).Unix()}
+	short := &BlockedIP{ID: "short", IP: "10.0.0.1", ExpireAt: time.Now().Add(time.Hour).Unix()}
+	r.UpdateBlockedIP(long)
+	r.UpdateBlockedIP(short)
+
+	// the route table has no store, the expired entry is only removed locally
+	short.ExpireAt = time.Now().Add(-time.Second).Unix()
+	r.expireBlockedIP(getBlockedIPTimerKey(short.ID))
+
+	if _, ok := r.blocklist.entries[short.ID]; ok {
+		t.Error("expect the short ban removed")
+	}
+
+	if !r.IsBlocked("10.0.0.1") {
+		t.Error("expect blocked by the long ban")
+	}
+
+	// not expired, the timer is added again
+	r.expireBlockedIP(getBlockedIPTimerKey(long.ID))
+	if _, ok := r.blocklist.entries[long.ID]; !ok {
+		t.Error("expect the long ban kept")
+	}
+}
+
+func TestBanIP(t *testing.T) {
+	r := NewRouteTable(nil, nil, nil)
+
+	blockedIP, err := r.BanIP("10.0.0.1", "test", time.Minute)
+	if err != nil || !blockedIP.Auto || blockedIP.ExpireAt <= time.Now().Unix() {
+		t.Fatalf("expect a auto ban, but %+v %+v", blockedIP, err)
+	}
+
+	if !r.IsBlocked("10.0.0.1") {
+		t.Error("expect the ban takes effect at once")
+	}
+
+	if _, err := r.BanIP("invalid", "test", time.Minute); err == nil {
+		t.Error("expect invalid ip failed")
+	}
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/fagongzi/goetty"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// DefaultAPIKeyHeader default header to read the api key
+	DefaultAPIKeyHeader = "X-Api-Key"
+	// DefaultAPIKeyQuery default query string arg to read the api key
+	DefaultAPIKeyQuery = "apikey"
+	// MaskedSecret the secret returns by admin if the consumer has a secret
+	MaskedSecret = "******"
+	// ConsumerHeader header to forward the consumer identity to the backend server
+	ConsumerHeader = "X-Consumer-ID"
+)
+
+var (
+	// ErrMissingAPIKey request has no api key
+	ErrMissingAPIKey = errors.New("Missing api key")
+	// ErrInvalidAPIKey api key not belongs to any consumer
+	ErrInvalidAPIKey = errors.New("Invalid api key")
+	// ErrConsumerForbidden consumer can not call the api
+	ErrConsumerForbidden = errors.New("Consumer forbidden")
+)
+
+// Consumer the caller of the apis, it identified by the api keys
+type Consumer struct {
+	ID     string   `json:"id,omitempty"`
+	Name   string   `json:"name,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// Keys sha256 hash of the api keys, the plain keys are not stored
+	Keys []string `json:"keys,omitempty"`
+	// Secret the shared secret to sign the requests
+	Secret string `json:"secret,omitempty"`
+	// Disabled the disabled consumer can't call any api, the keys and the secret are kept
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// ConsumerControl consumers who can call the api, the api require a api key if it's set.
+// If both IDs and Groups are empty, all consumers can call the api.
+type ConsumerControl struct {
+	IDs    []string `json:"ids,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+	// KeyHeader header to read the api key, default is X-Api-Key
+	KeyHeader string `json:"keyHeader,omitempty"`
+	// KeyQuery query string arg to read the api key if the header is absent, default is apikey
+	KeyQuery string `json:"keyQuery,omitempty"`
+}
+
+// UnMarshalConsumer unmarshal
+func UnMarshalConsumer(data []byte) *Consumer {
+	v := &Consumer{}
+	json.Unmarshal(data, v)
+
+	return v
+}
+
+// UnMarshalConsumerFromReader unmarshal from reader
+func UnMarshalConsumerFromReader(r io.Reader) (*Consumer, error) {
+	v := &Consumer{}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(v)
+
+	if v.ID == "" {
+		v.ID = goetty.NewV4UUID()
+	}
+
+	return v, err
+}
+
+// Marshal marshal
+func (c *Consumer) Marshal() []byte {
+	v, _ := json.Marshal(c)
+	return v
+}
+
+// NewKey generate a new api key for the consumer, returns the plain key.
+// Only the hash of the key is kept, so the plain key can't be got again.
+func (c *Consumer) NewKey() (string, error) {
+	data := make([]byte, 24)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+
+	key := hex.EncodeToString(data)
+	c.Keys = append(c.Keys, HashAPIKey(key))
+	return key, nil
+}
+
+// NewSecret generate a new secret to sign the requests
+func (c *Consumer) NewSecret() (string, error) {
+	data := make([]byte, 32)
+	_, err := rand.Read(data)
+	if err != nil {
+		return "", err
+	}
+
+	c.Secret = hex.EncodeToString(data)
+	return c.Secret, nil
+}
+
+// Masked returns a copy of the consumer with the secret masked, the secret only returns by NewSecret
+func (c *Consumer) Masked() *Consumer {
+	value := *c
+	if value.Secret != "" {
+		value.Secret = MaskedSecret
+	}
+
+	return &value
+}
+
+// RemoveKey remove the api key by it's hash
+func (c *Consumer) RemoveKey(hash string) bool {
+	for index, value := range c.Keys {
+		if value == hash {
+			c.Keys = append(c.Keys[:index], c.Keys[index+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// InGroup returns true if the consumer is in the group
+func (c *Consumer) InGroup(group string) bool {
+	for _, value := range c.Groups {
+		if value == group {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HashAPIKey returns the hash of the api key
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (cc *ConsumerControl) allow(consumer *Consumer) bool {
+	if consumer.Disabled {
+		return false
+	}
+
+	if len(cc.IDs) == 0 && len(cc.Groups) == 0 {
+		return true
+	}
+
+	for _, id := range cc.IDs {
+		if id == consumer.ID {
+			return true
+		}
+	}
+
+	for _, group := range cc.Groups {
+		if consumer.InGroup(group) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cc *ConsumerControl) getKey(req *fasthttp.Request) string {
+	if value := req.Header.Peek(cc.keyHeader()); len(value) > 0 {
+		return string(value)
+	}
+
+	return string(req.URI().QueryArgs().Peek(cc.keyQuery()))
+}
+
+// StripKey remove the api key from the request, the key is not sent to the backend servers
+func (cc *ConsumerControl) StripKey(req *fasthttp.Request) {
+	req.Header.Del(cc.keyHeader())
+
+	uri := req.URI()
+	args := uri.QueryArgs()
+	if args.Has(cc.keyQuery()) {
+		args.Del(cc.keyQuery())
+		// the uri keeps the origin query string if all the args are removed
+		uri.SetQueryStringBytes(args.AppendBytes(nil))
+	}
+}
+
+func (cc *ConsumerControl) keyHeader() string {
+	if cc.KeyHeader == "" {
+		return DefaultAPIKeyHeader
+	}
+
+	return cc.KeyHeader
+}
+
+func (cc *ConsumerControl) keyQuery() string {
+	if cc.KeyQuery == "" {
+		return DefaultAPIKeyQuery
+	}
+
+	return cc.KeyQuery
+}
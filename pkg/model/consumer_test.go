@@ -0,0 +1,110 @@
+package model
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newTestConsumerRouteTable(consumers ...*Consumer) *RouteTable {
+	r := &RouteTable{
+		rwLock:       &sync.RWMutex{},
+		consumers:    make(map[string]*Consumer),
+		consumerKeys: make(map[string]*Consumer),
+	}
+
+	for _, consumer := range consumers {
+		r.UpdateConsumer(consumer)
+	}
+
+	return r
+}
+
+func TestAuthenticateByKey(t *testing.T) {
+	partner := &Consumer{ID: "a", Groups: []string{"partners"}}
+	key, err := partner.NewKey()
+	if err != nil {
+		t.Fatalf("new key failed: %+v", err)
+	}
+
+	if partner.Keys[0] == key || partner.Keys[0] != HashAPIKey(key) {
+		t.Fatalf("expect only the hash of the key kept, but %+v", partner.Keys)
+	}
+
+	other := &Consumer{ID: "b"}
+	otherKey, _ := other.NewKey()
+
+	r := newTestConsumerRouteTable(partner, other)
+	api := &API{Consumers: &ConsumerControl{Groups: []string{"partners"}}}
+
+	req := &fasthttp.Request{}
+	if _, err := r.AuthenticateByKey(api, req); err != ErrMissingAPIKey {
+		t.Errorf("expect missing key, but %+v", err)
+	}
+
+	req.SetRequestURI("/a?apikey=" + key)
+	if consumer, err := r.AuthenticateByKey(api, req); err != nil || consumer.ID != "a" {
+		t.Errorf("expect consumer a by the query key, but %+v %+v", consumer, err)
+	}
+
+	req.Header.Set(DefaultAPIKeyHeader, HashAPIKey(key))
+	if _, err := r.AuthenticateByKey(api, req); err != ErrInvalidAPIKey {
+		t.Errorf("expect the hash is not a valid key, but %+v", err)
+	}
+
+	req.Header.Set(DefaultAPIKeyHeader, otherKey)
+	if _, err := r.AuthenticateByKey(api, req); err != ErrConsumerForbidden {
+		t.Errorf("expect consumer b not in the allow list, but %+v", err)
+	}
+
+	partner.Disabled = true
+	req.Header.Set(DefaultAPIKeyHeader, key)
+	if _, err := r.AuthenticateByKey(api, req); err != ErrConsumerForbidden {
+		t.Errorf("expect disabled consumer forbidden, but %+v", err)
+	}
+
+	if _, err := r.AuthenticateByKey(&API{Consumers: &ConsumerControl{}}, req); err != ErrConsumerForbidden {
+		t.Errorf("expect disabled consumer forbidden by any api, but %+v", err)
+	}
+}
+
+func TestAllowConsumer(t *testing.T) {
+	r := newTestConsumerRouteTable(&Consumer{ID: "a"}, &Consumer{ID: "b"})
+	api := &API{Consumers: &ConsumerControl{IDs: []string{"a"}}}
+
+	cases := map[string]error{
+		"a": nil,
+		"b": ErrConsumerForbidden,
+		"c": ErrConsumerForbidden,
+	}
+
+	for id, expect := range cases {
+		if err := r.AllowConsumer(api, id); err != expect {
+			t.Errorf("consumer %s expect %+v, but %+v", id, expect, err)
+		}
+	}
+
+	if err := r.AllowConsumer(&API{}, "c"); err != nil {
+		t.Errorf("expect api without consumers allows all, but %+v", err)
+	}
+}
+
+func TestStripKey(t *testing.T) {
+	cc := &ConsumerControl{KeyHeader: "X-Key", KeyQuery: "key"}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("/a?key=k1&b=1")
+	req.Header.Set("X-Key", "k1")
+	cc.StripKey(req)
+
+	if len(req.Header.Peek("X-Key")) > 0 || string(req.RequestURI()) != "/a?b=1" {
+		t.Errorf("expect the key removed, but %s %s", req.Header.Peek("X-Key"), req.RequestURI())
+	}
+
+	req.SetRequestURI("/a?key=k1")
+	cc.StripKey(req)
+	if string(req.RequestURI()) != "/a" {
+		t.Errorf("expect the key removed, but %s", req.RequestURI())
+	}
+}
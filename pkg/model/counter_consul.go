@@ -0,0 +1,107 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// consulCounter consul has no ttl for kv, so the expire time stored with the value
+type consulCounter struct {
+	Value    int64 `json:"value"`
+	ExpireAt int64 `json:"expireAt"`
+}
+
+// consulCounterExpired returns true if the counter is expired, the invalid counter is expired too
+func consulCounterExpired(value []byte, now time.Time) bool {
+	counter := &consulCounter{}
+	if err := json.Unmarshal(value, counter); err != nil {
+		return true
+	}
+
+	return counter.ExpireAt <= now.UnixNano()
+}
+
+// Incr add delta to the counter, the counter will be reset after ttl since it created,
+// and the expired counters are deleted by the sweep
+func (s *consulStore) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	s.counterSweep.Do(func() {
+		s.startSweep(s.countersDir, consulCounterExpired)
+	})
+
+	key = fmt.Sprintf("%s/%s", s.countersDir, key)
+
+	for {
+		pair, _, err := s.client.KV().Get(key, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		now := time.Now()
+		counter := &consulCounter{
+			ExpireAt: now.Add(ttl).UnixNano(),
+		}
+
+		var index uint64
+		if nil != pair {
+			index = pair.ModifyIndex
+
+			old := &consulCounter{}
+			json.Unmarshal(pair.Value, old)
+			if old.ExpireAt > now.UnixNano() {
+				counter = old
+			}
+		}
+
+		counter.Value += delta
+		value, _ := json.Marshal(counter)
+
+		// index 0 means only create if not exists
+		ok, _, err := s.client.KV().CAS(&api.KVPair{
+			Key:         key,
+			Value:       value,
+			ModifyIndex: index,
+		}, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok {
+			return counter.Value, nil
+		}
+
+		// changed by other proxy, retry
+	}
+}
+
+// GetCounter returns the value of the counter, returns 0 if not exists or expired
+func (s *consulStore) GetCounter(key string) (int64, error) {
+	key = fmt.Sprintf("%s/%s", s.countersDir, key)
+
+	pair, _, err := s.client.KV().Get(key, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	if nil == pair {
+		return 0, nil
+	}
+
+	if consulCounterExpired(pair.Value, time.Now()) {
+		return 0, nil
+	}
+
+	counter := &consulCounter{}
+	json.Unmarshal(pair.Value, counter)
+	return counter.Value, nil
+}
+
+// DeleteCounter delete the counter
+func (s *consulStore) DeleteCounter(key string) error {
+	key = fmt.Sprintf("%s/%s", s.countersDir, key)
+
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"golang.org/x/net/context"
+)
+
+// counterLeases the counters expired at the same second share a lease, the windows of the counters are aligned,
+// so a lease is granted once a window instead of once a counter
+type counterLeases struct {
+	sync.Mutex
+	leases map[int64]clientv3.LeaseID
+}
+
+// counterLease returns the lease expired at the second of expireAt
+func (e *EtcdStore) counterLease(expireAt time.Time) (clientv3.LeaseID, error) {
+	at := expireAt.Add(time.Second - 1).Unix()
+	now := time.Now().Unix()
+
+	e.counterLeases.Lock()
+	defer e.counterLeases.Unlock()
+
+	for key := range e.counterLeases.leases {
+		if key <= now {
+			delete(e.counterLeases.leases, key)
+		}
+	}
+
+	if leaseID, ok := e.counterLeases.leases[at]; ok {
+		return leaseID, nil
+	}
+
+	// one more second, the lease is never expired before it's removed from the cache
+	leaseID, err := e.grant(at - now + 1)
+	if err != nil {
+		return 0, err
+	}
+
+	e.counterLeases.leases[at] = leaseID
+	return leaseID, nil
+}
+
+// Incr add delta to the counter, the counter will be removed after ttl since it created
+func (e *EtcdStore) Incr(key string, delta int64, ttl time.Duration) (int64, error) {
+	key = fmt.Sprintf("%s/%s", e.countersDir, key)
+
+	for {
+		ctx, cancel := context.WithTimeout(e.cli.Ctx(), DefaultRequestTimeout)
+		resp, err := clientv3.NewKV(e.cli).Get(ctx, key)
+		cancel()
+
+		if err != nil {
+			return 0, err
+		}
+
+		var value int64
+		var cmp clientv3.Cmp
+		var op clientv3.Op
+
+		if len(resp.Kvs) == 0 {
+			leaseID, err := e.counterLease(time.Now().Add(ttl))
+			if err != nil {
+				return 0, err
+			}
+
+			value = delta
+			cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+			op = clientv3.OpPut(key, strconv.FormatInt(value, 10), clientv3.WithLease(leaseID))
+		} else {
+			current, _ := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+
+			value = current + delta
+			cmp = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+			op = clientv3.OpPut(key, strconv.FormatInt(value, 10), clientv3.WithIgnoreLease())
+		}
+
+		txnResp, err := e.txn().If(cmp).Then(op).Commit()
+		if err != nil {
+			return 0, err
+		}
+
+		if txnResp.Succeeded {
+			return value, nil
+		}
+
+		// changed by other proxy, retry
+	}
+}
+
+// GetCounter returns the value of the counter, returns 0 if not exists
+func (e *EtcdStore) GetCounter(key string) (int64, error) {
+	key = fmt.Sprintf("%s/%s", e.countersDir, key)
+
+	var value int64
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value, _ = strconv.ParseInt(string(item.Value), 10, 64)
+		}
+	})
+
+	return value, err
+}
+
+// DeleteCounter delete the counter
+func (e *EtcdStore) DeleteCounter(key string) error {
+	return e.delete(fmt.Sprintf("%s/%s", e.countersDir, key))
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/fagongzi/gateway/pkg/util"
+	"github.com/fagongzi/log"
+)
+
+const (
+	ipSetRefPrefix = "@"
+)
+
+// IPSet named ip ranges, it can be referenced by the access control of apis as @name
+type IPSet struct {
+	Name string   `json:"name"`
+	IPs  []string `json:"ips"`
+
+	trie *util.IPTrie
+}
+
+// ipList ip ranges and referenced ip sets of the access control
+type ipList struct {
+	trie *util.IPTrie
+	sets []string
+}
+
+// UnMarshalIPSet unmarshal
+func UnMarshalIPSet(data []byte) *IPSet {
+	v := &IPSet{}
+	json.Unmarshal(data, v)
+
+	return v
+}
+
+// UnMarshalIPSetFromReader unmarshal from reader
+func UnMarshalIPSetFromReader(r io.Reader) (*IPSet, error) {
+	v := &IPSet{}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(v)
+
+	return v, err
+}
+
+// Marshal marshal
+func (s *IPSet) Marshal() []byte {
+	v, _ := json.Marshal(s)
+	return v
+}
+
+// Check check config
+func (s *IPSet) Check() error {
+	return s.parse()
+}
+
+func (s *IPSet) parse() error {
+	trie := util.NewIPTrie()
+	for _, ip := range s.IPs {
+		err := trie.Add(ip)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.trie = trie
+	return nil
+}
+
+func (s *IPSet) contains(ip net.IP) bool {
+	return nil != s.trie && s.trie.Contains(ip)
+}
+
+// checkIPList returns error if a ip range is invalid or a referenced ip set has no name
+func checkIPList(values []string) error {
+	trie := util.NewIPTrie()
+	for _, value := range values {
+		if strings.HasPrefix(value, ipSetRefPrefix) {
+			if value == ipSetRefPrefix {
+				return fmt.Errorf("missing ip set name: %s", value)
+			}
+			continue
+		}
+
+		err := trie.Add(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseIPList(values []string) *ipList {
+	l := &ipList{
+		trie: util.NewIPTrie(),
+	}
+
+	for _, value := range values {
+		if strings.HasPrefix(value, ipSetRefPrefix) {
+			l.sets = append(l.sets, value[len(ipSetRefPrefix):])
+			continue
+		}
+
+		err := l.trie.Add(value)
+		if err != nil {
+			log.Warnf("meta: access control ip <%s> ignored, errors:\n%+v",
+				value,
+				err)
+		}
+	}
+
+	return l
+}
+
+func (l *ipList) contains(ip net.IP, sets map[string]*IPSet) bool {
+	if l.trie.Contains(ip) {
+		return true
+	}
+
+	for _, name := range l.sets {
+		if set, ok := sets[name]; ok && set.contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,24 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestAPICheckAccessControl(t *testing.T) {
+	cases := []struct {
+		accessControl *AccessControl
+		ok            bool
+	}{
+		{&AccessControl{Whitelist: []string{"10.0.0.0/8", "192.168.1.1", "@office"}, Blacklist: []string{"10.0.0.1"}}, true},
+		{&AccessControl{Whitelist: []string{"10.0.0.0/33"}}, false},
+		{&AccessControl{Blacklist: []string{"bad"}}, false},
+		{&AccessControl{Blacklist: []string{"@"}}, false},
+	}
+
+	for _, c := range cases {
+		api := &API{AccessControl: c.accessControl}
+		if err := api.Check(); (err == nil) != c.ok {
+			t.Errorf("%+v: expect ok %v, but %+v", c.accessControl, c.ok, err)
+		}
+	}
+}
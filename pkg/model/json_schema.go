@@ -0,0 +1,296 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	schemaTypeObject  = "object"
+	schemaTypeArray   = "array"
+	schemaTypeString  = "string"
+	schemaTypeNumber  = "number"
+	schemaTypeInteger = "integer"
+	schemaTypeBoolean = "boolean"
+	schemaTypeNull    = "null"
+
+	schemaRootPath = "$"
+)
+
+// JSONSchema a subset of the JSON Schema(draft 4) to validate the json request body.
+// Supported keywords: type, enum, properties, required, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum, maximum.
+type JSONSchema struct {
+	// Type a type name or a list of type names
+	Type                 interface{}            `json:"type,omitempty"`
+	Enum                 []interface{}          `json:"enum,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	MinItems             *int                   `json:"minItems,omitempty"`
+	MaxItems             *int                   `json:"maxItems,omitempty"`
+	MinLength            *int                   `json:"minLength,omitempty"`
+	MaxLength            *int                   `json:"maxLength,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Minimum              *float64               `json:"minimum,omitempty"`
+	Maximum              *float64               `json:"maximum,omitempty"`
+
+	types   []string
+	pattern *regexp.Regexp
+	invalid bool // the schema failed to parse, all the bodies are rejected
+}
+
+// Violation a failed validation of the request
+type Violation struct {
+	// Field the source and name of the value like query.id or header.X-Token, or the json path of the body like $.items[0].name
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func newViolation(field string, format string, args ...interface{}) *Violation {
+	return &Violation{
+		Field:  field,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
+
+// Parse check and compile the schema
+func (s *JSONSchema) Parse() error {
+	s.types = nil
+	switch t := s.Type.(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []interface{}:
+		for _, value := range t {
+			name, ok := value.(string)
+			if !ok {
+				return fmt.Errorf("invalid schema type: %v", s.Type)
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return fmt.Errorf("invalid schema type: %v", s.Type)
+	}
+
+	for _, name := range s.types {
+		switch name {
+		case schemaTypeObject, schemaTypeArray, schemaTypeString, schemaTypeNumber,
+			schemaTypeInteger, schemaTypeBoolean, schemaTypeNull:
+		default:
+			return fmt.Errorf("invalid schema type: %s", name)
+		}
+	}
+
+	s.pattern = nil
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return err
+		}
+		s.pattern = pattern
+	}
+
+	for _, property := range s.Properties {
+		err := property.Parse()
+		if err != nil {
+			return err
+		}
+	}
+
+	if nil != s.Items {
+		return s.Items.Parse()
+	}
+
+	return nil
+}
+
+// ValidateBody validate the json body, returns the violations
+func (s *JSONSchema) ValidateBody(body []byte) []*Violation {
+	if s.invalid {
+		return []*Violation{newViolation(schemaRootPath, "the body schema is invalid")}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return []*Violation{newViolation(schemaRootPath, "invalid json body: %s", err)}
+	}
+
+	return s.validate(schemaRootPath, value, nil)
+}
+
+func (s *JSONSchema) validate(path string, value interface{}, violations []*Violation) []*Violation {
+	if len(s.types) > 0 && !s.matchesType(value) {
+		return append(violations, newViolation(path, "must be %s", strings.Join(s.types, " or ")))
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		violations = append(violations, newViolation(path, "must be one of the enum values"))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		violations = s.validateObject(path, v, violations)
+	case []interface{}:
+		violations = s.validateArray(path, v, violations)
+	case string:
+		violations = s.validateString(path, v, violations)
+	case json.Number:
+		violations = s.validateNumber(path, v, violations)
+	}
+
+	return violations
+}
+
+func (s *JSONSchema) validateObject(path string, value map[string]interface{}, violations []*Violation) []*Violation {
+	for _, name := range s.Required {
+		if _, ok := value[name]; !ok {
+			violations = append(violations, newViolation(path+"."+name, "is required"))
+		}
+	}
+
+	// validate in order, so the violations are stable
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if ok {
+			violations = property.validate(path+"."+name, value[name], violations)
+		} else if nil != s.AdditionalProperties && !*s.AdditionalProperties {
+			violations = append(violations, newViolation(path+"."+name, "is not allowed"))
+		}
+	}
+
+	return violations
+}
+
+func (s *JSONSchema) validateArray(path string, value []interface{}, violations []*Violation) []*Violation {
+	if nil != s.MinItems && len(value) < *s.MinItems {
+		violations = append(violations, newViolation(path, "must have at least %d items", *s.MinItems))
+	}
+
+	if nil != s.MaxItems && len(value) > *s.MaxItems {
+		violations = append(violations, newViolation(path, "must have at most %d items", *s.MaxItems))
+	}
+
+	if nil != s.Items {
+		for index, item := range value {
+			violations = s.Items.validate(fmt.Sprintf("%s[%d]", path, index), item, violations)
+		}
+	}
+
+	return violations
+}
+
+func (s *JSONSchema) validateString(path string, value string, violations []*Violation) []*Violation {
+	length := utf8.RuneCountInString(value)
+
+	if nil != s.MinLength && length < *s.MinLength {
+		violations = append(violations, newViolation(path, "length must be at least %d", *s.MinLength))
+	}
+
+	if nil != s.MaxLength && length > *s.MaxLength {
+		violations = append(violations, newViolation(path, "length must be at most %d", *s.MaxLength))
+	}
+
+	if nil != s.pattern && !s.pattern.MatchString(value) {
+		violations = append(violations, newViolation(path, "must match pattern %s", s.Pattern))
+	}
+
+	return violations
+}
+
+func (s *JSONSchema) validateNumber(path string, value json.Number, violations []*Violation) []*Violation {
+	number, err := value.Float64()
+	if err != nil {
+		return append(violations, newViolation(path, "invalid number"))
+	}
+
+	if nil != s.Minimum && number < *s.Minimum {
+		violations = append(violations, newViolation(path, "must be >= %v", *s.Minimum))
+	}
+
+	if nil != s.Maximum && number > *s.Maximum {
+		violations = append(violations, newViolation(path, "must be <= %v", *s.Maximum))
+	}
+
+	return violations
+}
+
+func (s *JSONSchema) matchesType(value interface{}) bool {
+	for _, name := range s.types {
+		if schemaTypeOf(value, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *JSONSchema) inEnum(value interface{}) bool {
+	for _, item := range s.Enum {
+		if jsonEquals(item, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func schemaTypeOf(value interface{}, name string) bool {
+	switch v := value.(type) {
+	case nil:
+		return name == schemaTypeNull
+	case bool:
+		return name == schemaTypeBoolean
+	case string:
+		return name == schemaTypeString
+	case map[string]interface{}:
+		return name == schemaTypeObject
+	case []interface{}:
+		return name == schemaTypeArray
+	case json.Number:
+		if name == schemaTypeNumber {
+			return true
+		}
+
+		if name == schemaTypeInteger {
+			number, err := v.Float64()
+			return err == nil && number == math.Trunc(number)
+		}
+	}
+
+	return false
+}
+
+// jsonEquals compare the enum value and the body value, the numbers are compared by value
+func jsonEquals(expect interface{}, value interface{}) bool {
+	if number, ok := value.(json.Number); ok {
+		expectNumber, ok := expect.(float64)
+		if !ok {
+			return false
+		}
+
+		actual, err := number.Float64()
+		return err == nil && actual == expectNumber
+	}
+
+	expectData, _ := json.Marshal(expect)
+	valueData, _ := json.Marshal(value)
+	return bytes.Equal(expectData, valueData)
+}
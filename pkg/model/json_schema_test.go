@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testSchema = `{
+	"type": "object",
+	"required": ["name", "items"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 1, "maxLength": 8},
+		"kind": {"enum": ["a", "b"]},
+		"items": {
+			"type": "array",
+			"minItems": 1,
+			"items": {"type": "integer", "minimum": 0}
+		}
+	}
+}`
+
+func newTestSchema(t *testing.T) *JSONSchema {
+	schema := &JSONSchema{}
+	err := json.Unmarshal([]byte(testSchema), schema)
+	if err != nil {
+		t.Fatalf("unmarshal schema failed: %+v", err)
+	}
+
+	err = schema.Parse()
+	if err != nil {
+		t.Fatalf("parse schema failed: %+v", err)
+	}
+
+	return schema
+}
+
+func TestJSONSchemaValid(t *testing.T) {
+	schema := newTestSchema(t)
+
+	violations := schema.ValidateBody([]byte(`{"name": "abc", "kind": "a", "items": [1, 2]}`))
+	if len(violations) != 0 {
+		t.Errorf("expect no violations, but %+v", violations[0])
+	}
+}
+
+func TestJSONSchemaViolations(t *testing.T) {
+	schema := newTestSchema(t)
+
+	violations := schema.ValidateBody([]byte(`{"name": "", "kind": "c", "items": [1.5, -1], "other": 1}`))
+
+	expects := []string{"$.items[0]", "$.items[1]", "$.kind", "$.name", "$.other"}
+	if len(violations) != len(expects) {
+		t.Fatalf("expect %d violations, but %d", len(expects), len(violations))
+	}
+
+	for index, field := range expects {
+		if violations[index].Field != field {
+			t.Errorf("expect violation of %s, but %s", field, violations[index].Field)
+		}
+	}
+}
+
+func TestJSONSchemaInvalidBody(t *testing.T) {
+	schema := newTestSchema(t)
+
+	violations := schema.ValidateBody([]byte(`{"name":`))
+	if len(violations) != 1 || violations[0].Field != schemaRootPath {
+		t.Errorf("expect a violation of invalid body, but %+v", violations)
+	}
+}
+
+func TestJSONSchemaParseError(t *testing.T) {
+	schema := &JSONSchema{Type: "map"}
+	if schema.Parse() == nil {
+		t.Error("expect parse error of invalid type")
+	}
+
+	// the invalid schema rejects all the bodies
+	schema = parseBodySchema(&JSONSchema{Type: "object", Pattern: "["}, "test")
+	if violations := schema.ValidateBody([]byte(`{}`)); len(violations) != 1 || violations[0].Field != schemaRootPath {
+		t.Errorf("expect a violation of invalid schema, but %+v", violations)
+	}
+}
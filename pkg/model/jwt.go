@@ -0,0 +1,412 @@
+package model
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	// ErrMissingJWT request has no bearer jwt
+	ErrMissingJWT = errors.New("Missing bearer token")
+	// ErrJWTKeyNotFound no key to verify the jwt
+	ErrJWTKeyNotFound = errors.New("No key to verify the token")
+	// ErrJWTInvalidIssuer the issuer of the jwt is not trusted
+	ErrJWTInvalidIssuer = errors.New("Invalid token issuer")
+	// ErrJWTInvalidAudience the audience of the jwt not matches
+	ErrJWTInvalidAudience = errors.New("Invalid token audience")
+	// ErrJWTForbidden the claims of the jwt not satisfy the api rule
+	ErrJWTForbidden = errors.New("Token claims forbidden")
+	// ErrJWTKeySetInvalid key set has no valid key
+	ErrJWTKeySetInvalid = errors.New("Key set has no valid key")
+
+	bearerPrefix = []byte("Bearer ")
+)
+
+// JWTKeySet keys to verify the jwt signature.
+// Secret is used by HS256/384/512, PublicKey(PEM) is used by RS/PS/ES algorithms,
+// JWKS is a json web key set document, the key is selected by the kid header of the jwt.
+// If many key sets match a jwt, they are tried in the order of the id until the signature is verified.
+type JWTKeySet struct {
+	ID        string `json:"id"`
+	Issuer    string `json:"issuer,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+	JWKS      string `json:"jwks,omitempty"`
+
+	secret    []byte
+	publicKey interface{}
+	jwks      map[string]interface{}
+}
+
+// JWTRule the jwt setting of a api
+type JWTRule struct {
+	// Issuers trusted issuers, empty means all issuers of the key sets
+	Issuers []string `json:"issuers,omitempty"`
+	// Audiences the aud claim must contain one of them if not empty
+	Audiences []string `json:"audiences,omitempty"`
+	// Claims required claims
+	Claims []*JWTClaimRule `json:"claims,omitempty"`
+	// Scopes required scopes, read from the scope claim(space separated) or the scp claim
+	Scopes []string `json:"scopes,omitempty"`
+	// Headers claims forward to the backend server
+	Headers []*JWTClaimHeader `json:"headers,omitempty"`
+}
+
+// JWTClaimRule the claim must exist, and must be one of values if values is not empty
+type JWTClaimRule struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values,omitempty"`
+}
+
+// JWTClaimHeader forward the claim to the backend server in the header
+type JWTClaimHeader struct {
+	Claim  string `json:"claim"`
+	Header string `json:"header"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// UnMarshalJWTKeySet unmarshal
+func UnMarshalJWTKeySet(data []byte) *JWTKeySet {
+	v := &JWTKeySet{}
+	json.Unmarshal(data, v)
+
+	return v
+}
+
+// UnMarshalJWTKeySetFromReader unmarshal from reader
+func UnMarshalJWTKeySetFromReader(r io.Reader) (*JWTKeySet, error) {
+	v := &JWTKeySet{}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(v)
+
+	return v, err
+}
+
+// Marshal marshal
+func (s *JWTKeySet) Marshal() []byte {
+	v, _ := json.Marshal(s)
+	return v
+}
+
+// Check check config
+func (s *JWTKeySet) Check() error {
+	return s.parse()
+}
+
+func (s *JWTKeySet) parse() error {
+	s.secret = nil
+	s.publicKey = nil
+	s.jwks = nil
+
+	if s.Secret != "" {
+		s.secret = []byte(s.Secret)
+	}
+
+	if s.PublicKey != "" {
+		key, err := parsePublicKeyFromPEM([]byte(s.PublicKey))
+		if err != nil {
+			return err
+		}
+		s.publicKey = key
+	}
+
+	if s.JWKS != "" {
+		jwks, err := parseJWKS([]byte(s.JWKS))
+		if err != nil {
+			return err
+		}
+		s.jwks = jwks
+	}
+
+	if nil == s.secret && nil == s.publicKey && len(s.jwks) == 0 {
+		return ErrJWTKeySetInvalid
+	}
+
+	return nil
+}
+
+func (s *JWTKeySet) matches(token *jwt.Token) bool {
+	if s.Issuer != "" {
+		if iss, _ := token.Claims["iss"].(string); iss != s.Issuer {
+			return false
+		}
+	}
+
+	return s.getKey(token) != nil
+}
+
+// getKey returns the key to verify the token, the type of the key must match the alg.
+// The kid header selects the key of the JWKS, the secret or the public key is used if the JWKS has no such key.
+func (s *JWTKeySet) getKey(token *jwt.Token) interface{} {
+	var key interface{}
+
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" && nil != s.jwks[kid] {
+		key = s.jwks[kid]
+	} else if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		key = s.secret
+	} else {
+		key = s.publicKey
+	}
+
+	// avoid using a public key as hmac secret
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if value, ok := key.([]byte); ok && len(value) > 0 {
+			return value
+		}
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if value, ok := key.(*rsa.PublicKey); ok {
+			return value
+		}
+	case *jwt.SigningMethodECDSA:
+		if value, ok := key.(*ecdsa.PublicKey); ok {
+			return value
+		}
+	}
+
+	return nil
+}
+
+func (r *JWTRule) trustIssuer(issuer string) bool {
+	if len(r.Issuers) == 0 {
+		return true
+	}
+
+	for _, value := range r.Issuers {
+		if value == issuer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *JWTRule) checkAudience(claims map[string]interface{}) bool {
+	if len(r.Audiences) == 0 {
+		return true
+	}
+
+	for _, aud := range claimValues(claims["aud"]) {
+		for _, value := range r.Audiences {
+			if value == aud {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (r *JWTRule) checkClaims(claims map[string]interface{}) bool {
+	for _, rule := range r.Claims {
+		values := claimValues(claims[rule.Name])
+		if len(values) == 0 {
+			return false
+		}
+
+		if len(rule.Values) > 0 && !containsAny(rule.Values, values) {
+			return false
+		}
+	}
+
+	if len(r.Scopes) > 0 {
+		var scopes []string
+		if scope, ok := claims["scope"].(string); ok {
+			scopes = strings.Fields(scope)
+		} else {
+			scopes = claimValues(claims["scp"])
+		}
+
+		for _, scope := range r.Scopes {
+			if !containsAny([]string{scope}, scopes) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// headers returns all mapped headers, the value is empty if the claim not exists
+func (r *JWTRule) headers(claims map[string]interface{}) map[string]string {
+	if len(r.Headers) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string, len(r.Headers))
+	for _, h := range r.Headers {
+		headers[h.Header] = strings.Join(claimValues(claims[h.Claim]), ",")
+	}
+
+	return headers
+}
+
+func claimValues(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			values = append(values, fmt.Sprintf("%v", item))
+		}
+		return values
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	default:
+		return []string{fmt.Sprintf("%v", v)}
+	}
+}
+
+func containsAny(expect []string, values []string) bool {
+	for _, e := range expect {
+		for _, v := range values {
+			if e == v {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// verifyKey returns the first key verifies the signature of the token,
+// returns the first key if no key verifies, the parser reports the invalid signature
+func verifyKey(token *jwt.Token, keys []interface{}) interface{} {
+	if len(keys) == 1 {
+		return keys[0]
+	}
+
+	if idx := strings.LastIndex(token.Raw, "."); idx > 0 {
+		for _, key := range keys {
+			if token.Method.Verify(token.Raw[:idx], token.Raw[idx+1:], key) == nil {
+				return key
+			}
+		}
+	}
+
+	return keys[0]
+}
+
+func getBearerToken(req *fasthttp.Request) string {
+	auth := req.Header.Peek("Authorization")
+	if !bytes.HasPrefix(auth, bearerPrefix) {
+		return ""
+	}
+
+	return string(auth[len(bearerPrefix):])
+}
+
+func parsePublicKeyFromPEM(data []byte) (interface{}, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return key, nil
+	}
+
+	return jwt.ParseECPublicKeyFromPEM(data)
+}
+
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	doc := &struct {
+		Keys []*jsonWebKey `json:"keys"`
+	}{}
+
+	err := json.Unmarshal(data, doc)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, err
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("not support curve: %s", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(k.K, "="))
+	default:
+		return nil, fmt.Errorf("not support key type: %s", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
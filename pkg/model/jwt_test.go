@@ -0,0 +1,135 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestJWTRouteTable(t *testing.T, keySets ...*JWTKeySet) *RouteTable {
+	r := &RouteTable{
+		rwLock:     &sync.RWMutex{},
+		jwtKeySets: make(map[string]*JWTKeySet),
+	}
+
+	for _, keySet := range keySets {
+		if err := keySet.parse(); err != nil {
+			t.Fatalf("parse key set %s failed: %+v", keySet.ID, err)
+		}
+		r.jwtKeySets[keySet.ID] = keySet
+	}
+
+	return r
+}
+
+func newTestJWTRequest(t *testing.T, method jwt.SigningMethod, key interface{}, header map[string]interface{}, claims map[string]interface{}) *fasthttp.Request {
+	token := jwt.New(method)
+	for name, value := range header {
+		token.Header[name] = value
+	}
+	token.Claims = claims
+
+	value, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token failed: %+v", err)
+	}
+
+	req := &fasthttp.Request{}
+	req.Header.Set("Authorization", "Bearer "+value)
+	return req
+}
+
+func TestVerifyJWTBySecrets(t *testing.T) {
+	r := newTestJWTRouteTable(t,
+		&JWTKeySet{ID: "a", Secret: "secret-a"},
+		&JWTKeySet{ID: "b", Secret: "secret-b"})
+	api := &API{JWT: &JWTRule{}}
+	exp := float64(time.Now().Add(time.Hour).Unix())
+
+	// the kid header is ignored by the secret key sets, every matched key set is tried
+	for i := 0; i < 10; i++ {
+		req := newTestJWTRequest(t, jwt.SigningMethodHS256, []byte("secret-b"), map[string]interface{}{"kid": "k1"}, map[string]interface{}{"sub": "u1", "exp": exp})
+		claims, _, err := r.VerifyJWT(api, req)
+		if err != nil || claims["sub"] != "u1" {
+			t.Fatalf("expect verified, but %+v", err)
+		}
+	}
+
+	req := newTestJWTRequest(t, jwt.SigningMethodHS256, []byte("secret-c"), nil, map[string]interface{}{"sub": "u1"})
+	if _, _, err := r.VerifyJWT(api, req); err == nil {
+		t.Error("expect invalid signature")
+	}
+
+	req = newTestJWTRequest(t, jwt.SigningMethodHS256, []byte("secret-a"), nil, map[string]interface{}{"sub": "u1", "exp": float64(time.Now().Add(-time.Hour).Unix())})
+	if _, _, err := r.VerifyJWT(api, req); err == nil {
+		t.Error("expect expired")
+	}
+
+	if _, _, err := r.VerifyJWT(api, &fasthttp.Request{}); err != ErrMissingJWT {
+		t.Errorf("expect missing jwt, but %+v", err)
+	}
+}
+
+func TestVerifyJWTByJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generate key failed: %+v", err)
+	}
+
+	jwks := fmt.Sprintf(`{"keys":[{"kid":"k1","kty":"RSA","n":"%s","e":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()))
+	r := newTestJWTRouteTable(t,
+		&JWTKeySet{ID: "idp", Issuer: "https://idp", JWKS: jwks},
+		&JWTKeySet{ID: "local", Secret: "secret"})
+
+	api := &API{
+		JWT: &JWTRule{
+			Issuers:   []string{"https://idp"},
+			Audiences: []string{"gateway"},
+			Scopes:    []string{"read"},
+			Claims:    []*JWTClaimRule{{Name: "role", Values: []string{"admin"}}},
+			Headers:   []*JWTClaimHeader{{Claim: "sub", Header: "X-User"}},
+		},
+	}
+
+	claims := map[string]interface{}{"iss": "https://idp", "aud": []interface{}{"gateway"}, "scope": "read write", "role": "admin", "sub": "u1"}
+	req := newTestJWTRequest(t, jwt.SigningMethodRS256, key, map[string]interface{}{"kid": "k1"}, claims)
+	_, headers, err := r.VerifyJWT(api, req)
+	if err != nil || headers["X-User"] != "u1" {
+		t.Fatalf("expect verified, but %+v %+v", headers, err)
+	}
+
+	claims["role"] = "guest"
+	req = newTestJWTRequest(t, jwt.SigningMethodRS256, key, map[string]interface{}{"kid": "k1"}, claims)
+	if _, _, err := r.VerifyJWT(api, req); err != ErrJWTForbidden {
+		t.Errorf("expect forbidden, but %+v", err)
+	}
+
+	claims["role"] = "admin"
+	claims["aud"] = "other"
+	req = newTestJWTRequest(t, jwt.SigningMethodRS256, key, map[string]interface{}{"kid": "k1"}, claims)
+	if _, _, err := r.VerifyJWT(api, req); err != ErrJWTInvalidAudience {
+		t.Errorf("expect invalid audience, but %+v", err)
+	}
+
+	// the secret key set has no issuer, it's matched but the issuer is not trusted by the api
+	req = newTestJWTRequest(t, jwt.SigningMethodHS256, []byte("secret"), nil, map[string]interface{}{"iss": "local"})
+	if _, _, err := r.VerifyJWT(api, req); err != ErrJWTInvalidIssuer {
+		t.Errorf("expect invalid issuer, but %+v", err)
+	}
+
+	// a public key is never used as a hmac secret
+	req = newTestJWTRequest(t, jwt.SigningMethodHS256, []byte("x"), map[string]interface{}{"kid": "k1"}, map[string]interface{}{"iss": "https://idp"})
+	if _, _, err := r.VerifyJWT(api, req); err == nil {
+		t.Error("expect no key")
+	}
+}
@@ -0,0 +1,154 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// QuotaPeriodDay the quota is reset every day
+	QuotaPeriodDay = iota
+	// QuotaPeriodMonth the quota is reset every month
+	QuotaPeriodMonth
+)
+
+var (
+	// ErrQuotaInvalid quota has no group or limit
+	ErrQuotaInvalid = errors.New("Quota group and limit are required")
+)
+
+const (
+	// QuotaAnyConsumer quota for all consumers of the group which has no spec quota
+	QuotaAnyConsumer = "*"
+)
+
+// APIQuota the quota setting of a api
+type APIQuota struct {
+	// Group quota group, apis in the same group share the quota
+	Group string `json:"group"`
+	// KeyFrom where to get the consumer, same as RateLimit
+	KeyFrom int    `json:"keyFrom"`
+	Attr    string `json:"attr,omitempty"`
+}
+
+// Quota calls limit of a consumer in a period for a api group
+type Quota struct {
+	Consumer string `json:"consumer"`
+	Group    string `json:"group"`
+	Period   int    `json:"period"`
+	Limit    int64  `json:"limit"`
+}
+
+// QuotaExceededError the quota of the consumer is exhausted
+type QuotaExceededError struct {
+	Message  string `json:"error"`
+	Consumer string `json:"consumer"`
+	Group    string `json:"group"`
+	Period   string `json:"period"`
+	Limit    int64  `json:"limit"`
+	ResetAt  int64  `json:"resetAt"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return e.Message
+}
+
+// QuotaUsage quota and current usage
+type QuotaUsage struct {
+	Quota   *Quota `json:"quota"`
+	Used    int64  `json:"used"`
+	ResetAt int64  `json:"resetAt"`
+}
+
+// UnMarshalQuota unmarshal
+func UnMarshalQuota(data []byte) *Quota {
+	v := &Quota{}
+	json.Unmarshal(data, v)
+
+	return v
+}
+
+// UnMarshalQuotaFromReader unmarshal from reader
+func UnMarshalQuotaFromReader(r io.Reader) (*Quota, error) {
+	v := &Quota{}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(v)
+
+	return v, err
+}
+
+// Marshal marshal
+func (q *Quota) Marshal() []byte {
+	v, _ := json.Marshal(q)
+	return v
+}
+
+// Check check config
+func (q *Quota) Check() error {
+	if q.Consumer == "" {
+		q.Consumer = QuotaAnyConsumer
+	}
+
+	if q.Group == "" || q.Limit <= 0 {
+		return ErrQuotaInvalid
+	}
+
+	return nil
+}
+
+// Key returns the uniq key of the quota
+func (q *Quota) Key() string {
+	return getQuotaKey(q.Consumer, q.Group)
+}
+
+// UsageKey returns the counter key of the consumer usage in current period
+func (q *Quota) UsageKey(consumer string, now time.Time) string {
+	var period string
+	if q.Period == QuotaPeriodMonth {
+		period = now.Format("200601")
+	} else {
+		period = now.Format("20060102")
+	}
+
+	return fmt.Sprintf("quota/%s/%s", getQuotaKey(consumer, q.Group), period)
+}
+
+// ResetAt returns the time of the quota reset
+func (q *Quota) ResetAt(now time.Time) time.Time {
+	year, month, day := now.Date()
+
+	if q.Period == QuotaPeriodMonth {
+		return time.Date(year, month+1, 1, 0, 0, 0, 0, now.Location())
+	}
+
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+}
+
+// PeriodName returns the name of the quota period
+func (q *Quota) PeriodName() string {
+	if q.Period == QuotaPeriodMonth {
+		return "month"
+	}
+
+	return "day"
+}
+
+func (a *API) getQuotaConsumer(req *fasthttp.Request, clientIP string, claims map[string]interface{}) (string, bool) {
+	if nil == a.Quota {
+		return "", false
+	}
+
+	return getKeyValue(a.Quota.KeyFrom, a.Quota.Attr, req, clientIP, claims)
+}
+
+func getQuotaKey(consumer, group string) string {
+	key := fmt.Sprintf("%s-%s", group, consumer)
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestCheckQuota(t *testing.T) {
+	r := &RouteTable{
+		rwLock:        &sync.RWMutex{},
+		quotas:        make(map[string]*Quota),
+		globalLimiter: newTestGlobalLimiter(&memoryCounter{values: make(map[string]int64)}),
+	}
+
+	for _, q := range []*Quota{
+		{Consumer: "partner-a", Group: "g", Limit: 2},
+		{Consumer: QuotaAnyConsumer, Group: "g", Limit: 1},
+	} {
+		r.quotas[q.Key()] = q
+	}
+
+	api := &API{
+		Quota: &APIQuota{Group: "g", KeyFrom: KeyFromHeader, Attr: "X-Consumer"},
+	}
+
+	req := &fasthttp.Request{}
+	req.Header.Set("X-Consumer", "partner-b")
+
+	// the authenticated consumer is used, the header is ignored
+	for i := 0; i < 2; i++ {
+		if err := r.CheckQuota(api, "partner-a", req, "127.0.0.1", nil); err != nil {
+			t.Fatalf("expect call %d allowed, but %+v", i, err)
+		}
+	}
+
+	err := r.CheckQuota(api, "partner-a", req, "127.0.0.1", nil)
+	if e, ok := err.(*QuotaExceededError); !ok || e.Consumer != "partner-a" || e.Limit != 2 {
+		t.Errorf("expect quota of partner-a exceeded, but %+v", err)
+	}
+
+	// no authenticated consumer, get from the request by the key from
+	if err := r.CheckQuota(api, "", req, "127.0.0.1", nil); err != nil {
+		t.Errorf("expect allowed by the * quota, but %+v", err)
+	}
+
+	err = r.CheckQuota(api, "", req, "127.0.0.1", nil)
+	if e, ok := err.(*QuotaExceededError); !ok || e.Consumer != "partner-b" || e.Limit != 1 {
+		t.Errorf("expect quota of partner-b exceeded, but %+v", err)
+	}
+
+	if err := r.CheckQuota(&API{}, "partner-a", req, "127.0.0.1", nil); err != nil {
+		t.Errorf("expect api without quota allowed, but %+v", err)
+	}
+}
+
+func TestCheckQuotaLoadUsage(t *testing.T) {
+	counter := &memoryCounter{values: make(map[string]int64)}
+	r := &RouteTable{
+		rwLock:        &sync.RWMutex{},
+		quotas:        make(map[string]*Quota),
+		globalLimiter: newTestGlobalLimiter(counter),
+	}
+
+	quota := &Quota{Consumer: "partner-a", Group: "g", Limit: 3}
+	r.quotas[quota.Key()] = quota
+
+	// used by the other proxies, or before the proxy restarted
+	counter.values[quota.UsageKey("partner-a", time.Now())] = 2
+
+	api := &API{Quota: &APIQuota{Group: "g"}}
+	req := &fasthttp.Request{}
+
+	if err := r.CheckQuota(api, "partner-a", req, "127.0.0.1", nil); err != nil {
+		t.Fatalf("expect the last call allowed, but %+v", err)
+	}
+
+	if err := r.CheckQuota(api, "partner-a", req, "127.0.0.1", nil); err == nil {
+		t.Error("expect quota exceeded with the usage in the store")
+	}
+}
@@ -0,0 +1,89 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// PathParams the path params of the matched api captured by the router,
+// they are indexed like the groups of the api pattern.
+type PathParams [][]byte
+
+// requestContext the variables of a request used by the validations, routings and mocks,
+// the json body is decoded once
+type requestContext struct {
+	req        *fasthttp.Request
+	pattern    *regexp.Regexp
+	params     PathParams
+	requestURI []byte
+	clientIP   string
+
+	body        interface{}
+	bodyDecoded bool
+}
+
+func (ctx *requestContext) getPathValue(name string) []byte {
+	if nil == ctx.pattern {
+		return nil
+	}
+
+	index, err := strconv.Atoi(name)
+	if err != nil {
+		index = -1
+		for i, value := range ctx.pattern.SubexpNames() {
+			if value == name {
+				index = i
+				break
+			}
+		}
+	}
+
+	if index <= 0 || index >= len(ctx.params) || nil == ctx.params[index] {
+		return nil
+	}
+
+	return ctx.params[index]
+}
+
+func (ctx *requestContext) getBodyValue(path string) []byte {
+	if !ctx.bodyDecoded {
+		ctx.bodyDecoded = true
+
+		decoder := json.NewDecoder(bytes.NewReader(ctx.req.Body()))
+		decoder.UseNumber()
+		decoder.Decode(&ctx.body)
+	}
+
+	value := ctx.body
+	for _, name := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[name]
+		case []interface{}:
+			index, err := strconv.Atoi(name)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil
+			}
+			value = v[index]
+		default:
+			return nil
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []byte(v)
+	case json.Number:
+		return []byte(v.String())
+	}
+
+	data, _ := json.Marshal(value)
+	return data
+}
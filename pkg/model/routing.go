@@ -3,14 +3,16 @@ package model
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/brettlangdon/forge"
+	"github.com/fagongzi/gateway/pkg/util"
 	"github.com/fagongzi/goetty"
 	"github.com/valyala/fasthttp"
 )
@@ -18,18 +20,26 @@ import (
 var (
 	// GlobalCfgDesc global desc cfg
 	GlobalCfgDesc = "desc"
-	// GlobalCfgOrder global order cfg
+	// GlobalCfgOrder global order cfg, the routings are evaluated by the order asc
 	GlobalCfgOrder = "order"
-	// GlobalCfgDeadline global deadline cfg
+	// GlobalCfgDeadline global deadline cfg, seconds after the routing created, 0 means never
 	GlobalCfgDeadline = "deadline"
+	// GlobalCfgStart global start cfg, seconds after the routing created
+	GlobalCfgStart = "start"
+	// GlobalCfgWindows global windows cfg, recurring time windows like "Mon-Fri 09:00-18:00"
+	GlobalCfgWindows = "windows"
+	// GlobalCfgTimezone global timezone cfg of the windows, default is the local timezone
+	GlobalCfgTimezone = "timezone"
 	// GlobalCfgRule global rule cfg
 	GlobalCfgRule = "rule"
 	// GlobalCfgOr global or cfg
 	GlobalCfgOr = "or"
+	// GlobalCfgExpression global expression cfg, it replaces the rule and or cfg
+	GlobalCfgExpression = "expression"
 )
 
-// rule: left [==,>,<=,>=,in,~] right
-// can use var: $header_, $cookie_, $query_
+// rule: left [==,!=,>,<=,>=,in,~] right
+// can use var: $header_, $cookie_, $query_, $body_, $path, $method, $host, $ip
 var (
 	// ValueHeader value of header prefix
 	ValueHeader = "$HEADER"
@@ -37,11 +47,23 @@ var (
 	ValueCookie = "$COOKIE"
 	// ValueQuery value of query string prefix
 	ValueQuery = "$QUERY"
+	// ValueBody value of json body prefix, the attr is a dot path
+	ValueBody = "$BODY"
+	// ValuePath value of request path
+	ValuePath = "$PATH"
+	// ValueMethod value of request method
+	ValueMethod = "$METHOD"
+	// ValueHost value of request host
+	ValueHost = "$HOST"
+	// ValueIP value of client ip
+	ValueIP = "$IP"
 )
 
 var (
 	// EQ ==
 	EQ = "=="
+	// NE !=
+	NE = "!="
 	// LT <
 	LT = "<"
 	// LE <=
@@ -54,9 +76,6 @@ var (
 	IN = "in"
 	// MATCH reg matches
 	MATCH = "~"
-
-	// PATTERN reg pattern for expression
-	PATTERN = regexp.MustCompile(fmt.Sprintf("^(?U)(.+)(%s|%s|%s|%s|%s|%s|%s)(.+)$", EQ, LE, LT, GE, GT, IN, MATCH))
 )
 
 var (
@@ -69,9 +88,13 @@ type RoutingItem struct {
 	rule string
 
 	attrName       string
-	sourceValueFun func(req *fasthttp.Request) string
+	sourceValueFun func(ctx *requestContext) string
 	opFun          func(srvValue string) bool
 	targetValue    string
+
+	source   string
+	pattern  *regexp.Regexp
+	ipRanges *util.IPTrie
 }
 
 // Routing routing
@@ -80,13 +103,20 @@ type Routing struct {
 	ID          string `json:"id,omitempty"`
 	Cfg         string `json:"cfg,omitempty"`
 	URL         string `json:"url,omitempty"`
+	// CreateAt unix seconds when the routing created, the start and deadline are relative to it
+	CreateAt int64 `json:"createAt,omitempty"`
+	// Disabled the disabled routing is paused and never matches
+	Disabled bool `json:"disabled,omitempty"`
 
 	desc     string
+	order    int64
+	start    int64
 	deadline int64
+	windows  []*routingWindow
+	location *time.Location
 	regexp   *regexp.Regexp
 
-	andItems []*RoutingItem
-	orItems  []*RoutingItem
+	expr routingExpr
 }
 
 // UnMarshalRouting unmarshal
@@ -110,6 +140,10 @@ func UnMarshalRoutingFromReader(r io.Reader) (*Routing, error) {
 		v.ID = goetty.NewV4UUID()
 	}
 
+	if v.CreateAt == 0 {
+		v.CreateAt = time.Now().Unix()
+	}
+
 	return v, err
 }
 
@@ -131,6 +165,7 @@ func NewRouting(cfgString string, clusterName string, url string) (*Routing, err
 	r.ClusterName = clusterName
 	r.URL = url
 	r.ID = goetty.NewV4UUID()
+	r.CreateAt = time.Now().Unix()
 
 	return r, r.init()
 }
@@ -162,6 +197,37 @@ func (r *Routing) init() error {
 	}
 	r.deadline = deadline
 
+	r.order, err = getOptionalInteger(cfg, GlobalCfgOrder)
+	if nil != err {
+		return err
+	}
+
+	r.start, err = getOptionalInteger(cfg, GlobalCfgStart)
+	if nil != err {
+		return err
+	}
+
+	err = r.initWindows(cfg)
+	if nil != err {
+		return err
+	}
+
+	if cfg.Exists(GlobalCfgExpression) {
+		expression, err := cfg.GetString(GlobalCfgExpression)
+		if nil != err {
+			return err
+		}
+
+		expr, err := parseRoutingExpr(expression)
+		if nil != err {
+			return err
+		}
+		r.expr = expr
+
+		return nil
+	}
+
+	// the rule and or cfg: all the rules matches, or any of the or rules matches
 	andRules, err := cfg.GetList(GlobalCfgRule)
 	if nil != err {
 		return err
@@ -170,7 +236,7 @@ func (r *Routing) init() error {
 	if nil != err {
 		return err
 	}
-	r.andItems = items
+	expr := routingOr{routingAnd(items)}
 
 	if cfg.Exists(GlobalCfgOr) {
 		orRules, err := cfg.GetList(GlobalCfgOr)
@@ -181,7 +247,49 @@ func (r *Routing) init() error {
 		if nil != err {
 			return err
 		}
-		r.orItems = items
+		expr = append(expr, items...)
+	}
+	r.expr = expr
+
+	return nil
+}
+
+func (r *Routing) initWindows(cfg *forge.Section) error {
+	r.windows = nil
+	r.location = time.Local
+
+	if cfg.Exists(GlobalCfgTimezone) {
+		timezone, err := cfg.GetString(GlobalCfgTimezone)
+		if nil != err {
+			return err
+		}
+
+		r.location, err = time.LoadLocation(timezone)
+		if nil != err {
+			return err
+		}
+	}
+
+	if !cfg.Exists(GlobalCfgWindows) {
+		return nil
+	}
+
+	windows, err := cfg.GetList(GlobalCfgWindows)
+	if nil != err {
+		return err
+	}
+
+	for i := 0; i < windows.Length(); i++ {
+		value, err := windows.GetString(i)
+		if nil != err {
+			return err
+		}
+
+		window, err := parseRoutingWindow(value)
+		if nil != err {
+			return err
+		}
+		r.windows = append(r.windows, window)
 	}
 
 	return nil
@@ -189,35 +297,109 @@ func (r *Routing) init() error {
 
 // Matches return true if req matches
 func (r *Routing) Matches(req *fasthttp.Request) bool {
-	if !r.regexp.MatchString(string(req.URI().Path())) {
+	return r.matches(&requestContext{req: req}, time.Now())
+}
+
+func (r *Routing) matches(ctx *requestContext, now time.Time) bool {
+	if r.Disabled || !r.Active(now) {
 		return false
 	}
 
-	for _, item := range r.andItems {
-		if !item.matches(req) {
-			return r.matchesOr(req)
-		}
+	if !r.regexp.MatchString(string(ctx.req.URI().Path())) {
+		return false
 	}
 
-	return true
+	return r.expr.eval(ctx)
 }
 
-func (r *Routing) matchesOr(req *fasthttp.Request) bool {
-	if nil != r.orItems {
-		for _, item := range r.orItems {
-			if item.matches(req) {
-				return true
-			}
-		}
+// Active returns true if the routing is started, not expired and in the time windows at the time
+func (r *Routing) Active(now time.Time) bool {
+	if r.CreateAt > 0 && now.Unix() < r.CreateAt+r.start {
+		return false
+	}
 
+	if r.Expired(now) {
 		return false
 	}
 
+	if len(r.windows) == 0 {
+		return true
+	}
+
+	now = now.In(r.location)
+	for _, window := range r.windows {
+		if window.contains(now) {
+			return true
+		}
+	}
+
 	return false
 }
 
-func parseRoutingItems(rules *forge.List) ([]*RoutingItem, error) {
-	items := make([]*RoutingItem, rules.Length())
+// Expired returns true if the deadline passed at the time.
+// The routing created without the create time is never expired, it's expired by the store.
+func (r *Routing) Expired(now time.Time) bool {
+	return r.CreateAt > 0 && r.deadline > 0 && now.Unix() >= r.expireAt()
+}
+
+func (r *Routing) expireAt() int64 {
+	return r.CreateAt + r.deadline
+}
+
+// ttl returns the seconds before the deadline, 0 means never expired
+func (r *Routing) ttl(now time.Time) int64 {
+	if r.deadline <= 0 {
+		return 0
+	}
+
+	if r.CreateAt == 0 {
+		return r.deadline
+	}
+
+	ttl := r.expireAt() - now.Unix()
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return ttl
+}
+
+// before returns true if the routing is evaluated before the other one
+func (r *Routing) before(other *Routing) bool {
+	if r.order != other.order {
+		return r.order < other.order
+	}
+
+	if r.CreateAt != other.CreateAt {
+		return r.CreateAt < other.CreateAt
+	}
+
+	return r.ID < other.ID
+}
+
+func (r *RouteTable) sortRoutings() {
+	routings := make([]*Routing, 0, len(r.routings))
+	for _, routing := range r.routings {
+		routings = append(routings, routing)
+	}
+
+	sort.Slice(routings, func(i, j int) bool {
+		return routings[i].before(routings[j])
+	})
+
+	r.sortedRoutings = routings
+}
+
+func getOptionalInteger(cfg *forge.Section, name string) (int64, error) {
+	if !cfg.Exists(name) {
+		return 0, nil
+	}
+
+	return cfg.GetInteger(name)
+}
+
+func parseRoutingItems(rules *forge.List) ([]routingExpr, error) {
+	items := make([]routingExpr, rules.Length())
 	for i := 0; i < rules.Length(); i++ {
 		rule, err := rules.GetString(i)
 		if nil != err {
@@ -235,152 +417,273 @@ func parseRoutingItems(rules *forge.List) ([]*RoutingItem, error) {
 }
 
 func newRoutingItem(rule string) (*RoutingItem, error) {
-	item := &RoutingItem{rule: rule}
-	err := item.parse()
-	return item, err
+	expr, err := parseRoutingExpr(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	item, ok := expr.(*RoutingItem)
+	if !ok {
+		return nil, ErrSyntax
+	}
+
+	return item, nil
 }
 
-func (r *RoutingItem) parse() error {
-	mg := PATTERN.FindStringSubmatch(r.rule)
-	if len(mg) != 4 {
+func (r *RoutingItem) init(source, op, value string) error {
+	attrInfos := strings.SplitN(source, "_", 2)
+	r.source = strings.ToUpper(attrInfos[0])
+	if len(attrInfos) == 2 {
+		r.attrName = attrInfos[1]
+	}
+
+	switch r.source {
+	case ValueHeader:
+		r.sourceValueFun = r.getHeaderValue
+	case ValueCookie:
+		r.sourceValueFun = r.getCookieValue
+	case ValueQuery:
+		r.sourceValueFun = r.getQueryValue
+	case ValueBody:
+		r.sourceValueFun = r.getBodyValue
+	case ValuePath:
+		r.sourceValueFun = r.getPathValue
+	case ValueMethod:
+		r.sourceValueFun = r.getMethodValue
+		value = strings.ToUpper(value)
+	case ValueHost:
+		r.sourceValueFun = r.getHostValue
+		value = strings.ToLower(value)
+	case ValueIP:
+		r.sourceValueFun = r.getIPValue
+	default:
+		return ErrSyntax
+	}
+
+	// these sources have no attr
+	if (r.attrName == "") != (r.source == ValuePath || r.source == ValueMethod || r.source == ValueHost || r.source == ValueIP) {
 		return ErrSyntax
 	}
 
-	infos := mg[1:]
-	op := strings.TrimSpace(infos[1])
+	r.targetValue = value
+
 	switch op {
 	case EQ:
 		r.opFun = r.eq
-		break
+	case NE:
+		r.opFun = r.ne
 	case LT:
 		r.opFun = r.lt
-		break
 	case LE:
 		r.opFun = r.le
-		break
 	case GT:
 		r.opFun = r.gt
-		break
 	case GE:
 		r.opFun = r.ge
-		break
 	case IN:
 		r.opFun = r.in
-		break
 	case MATCH:
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		r.pattern = pattern
 		r.opFun = r.reg
-		break
 	default:
 		return ErrSyntax
 	}
 
-	attr := strings.TrimSpace(infos[0])
-	attrInfos := strings.SplitN(attr, "_", 2)
-	if len(attrInfos) != 2 {
-		return ErrSyntax
-	}
-	prefix := strings.ToUpper(strings.TrimSpace(attrInfos[0]))
-	switch prefix {
-	case ValueHeader:
-		r.sourceValueFun = r.getHeaderValue
-		break
-	case ValueCookie:
-		r.sourceValueFun = r.getCookieValue
-		break
-	case ValueQuery:
-		r.sourceValueFun = r.getQueryValue
-	default:
-		return ErrSyntax
+	// compare the client ip with ip ranges, like $ip == 10.0.0.0/8 or $ip in 10.0.0.0/8,192.168.0.0/16
+	if r.source == ValueIP && (op == EQ || op == NE || op == IN) {
+		r.ipRanges = util.NewIPTrie()
+		for _, value := range strings.Split(value, ",") {
+			err := r.ipRanges.Add(value)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
-	r.attrName = strings.TrimSpace(attrInfos[1])
-	r.targetValue = strings.TrimSpace(infos[2])
-
 	return nil
 }
 
+func (r *RoutingItem) eval(ctx *requestContext) bool {
+	return r.opFun(r.sourceValueFun(ctx))
+}
+
 func (r *RoutingItem) matches(req *fasthttp.Request) bool {
-	return r.opFun(r.sourceValueFun(req))
+	return r.eval(&requestContext{req: req})
 }
 
-func (r *RoutingItem) getCookieValue(req *fasthttp.Request) string {
-	return string(req.Header.Cookie(r.attrName))
+func (r *RoutingItem) getCookieValue(ctx *requestContext) string {
+	return string(ctx.req.Header.Cookie(r.attrName))
 }
 
-func (r *RoutingItem) getHeaderValue(req *fasthttp.Request) string {
-	return string(req.Header.Peek(r.attrName))
+func (r *RoutingItem) getHeaderValue(ctx *requestContext) string {
+	return string(ctx.req.Header.Peek(r.attrName))
 }
 
-func (r *RoutingItem) getQueryValue(req *fasthttp.Request) string {
-	v, _ := url.QueryUnescape(string(req.URI().QueryArgs().Peek(r.attrName)))
+func (r *RoutingItem) getQueryValue(ctx *requestContext) string {
+	v, _ := url.QueryUnescape(string(ctx.req.URI().QueryArgs().Peek(r.attrName)))
 	return v
 }
 
+func (r *RoutingItem) getBodyValue(ctx *requestContext) string {
+	return string(ctx.getBodyValue(r.attrName))
+}
+
+func (r *RoutingItem) getPathValue(ctx *requestContext) string {
+	return string(ctx.req.URI().Path())
+}
+
+func (r *RoutingItem) getMethodValue(ctx *requestContext) string {
+	return string(ctx.req.Header.Method())
+}
+
+func (r *RoutingItem) getHostValue(ctx *requestContext) string {
+	return strings.ToLower(string(ctx.req.Host()))
+}
+
+func (r *RoutingItem) getIPValue(ctx *requestContext) string {
+	return ctx.clientIP
+}
+
 func (r *RoutingItem) eq(srvValue string) bool {
+	if nil != r.ipRanges {
+		return r.ipRanges.ContainsString(srvValue)
+	}
+
 	return srvValue == r.targetValue
 }
 
+func (r *RoutingItem) ne(srvValue string) bool {
+	return !r.eq(srvValue)
+}
+
 func (r *RoutingItem) lt(srvValue string) bool {
-	s, err := strconv.Atoi(srvValue)
-	if err != nil {
-		return false
-	}
+	result, ok := compareValue(srvValue, r.targetValue)
+	return ok && result < 0
+}
 
-	t, err := strconv.Atoi(r.targetValue)
-	if err != nil {
-		return false
+func (r *RoutingItem) le(srvValue string) bool {
+	result, ok := compareValue(srvValue, r.targetValue)
+	return ok && result <= 0
+}
+
+func (r *RoutingItem) gt(srvValue string) bool {
+	result, ok := compareValue(srvValue, r.targetValue)
+	return ok && result > 0
+}
+
+func (r *RoutingItem) ge(srvValue string) bool {
+	result, ok := compareValue(srvValue, r.targetValue)
+	return ok && result >= 0
+}
+
+func (r *RoutingItem) in(srvValue string) bool {
+	if nil != r.ipRanges {
+		return r.ipRanges.ContainsString(srvValue)
 	}
 
-	return s < t
+	return strings.Index(srvValue, r.targetValue) != -1
 }
 
-func (r *RoutingItem) le(srvValue string) bool {
-	s, err := strconv.Atoi(srvValue)
+func (r *RoutingItem) reg(srvValue string) bool {
+	return r.pattern.MatchString(srvValue)
+}
+
+// compareValue compare as semver if the target is a semver like v1.2 or 1.2.3, otherwise compare as float.
+// Returns false if the values are not comparable.
+func compareValue(value, target string) (int, bool) {
+	if isSemver(target) {
+		return compareSemver(value, target)
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		return false
+		return 0, false
 	}
 
-	t, err := strconv.Atoi(r.targetValue)
+	t, err := strconv.ParseFloat(target, 64)
 	if err != nil {
-		return false
+		return 0, false
 	}
 
-	return s <= t
+	if v < t {
+		return -1, true
+	} else if v > t {
+		return 1, true
+	}
+
+	return 0, true
 }
 
-func (r *RoutingItem) gt(srvValue string) bool {
-	s, err := strconv.Atoi(srvValue)
-	if err != nil {
-		return false
+func isSemver(value string) bool {
+	return strings.HasPrefix(value, "v") || strings.Count(value, ".") >= 2
+}
+
+// compareSemver compare the major.minor.patch versions, the pre-release version is less than the release one
+func compareSemver(value, target string) (int, bool) {
+	v, vPre, ok := parseSemver(value)
+	if !ok {
+		return 0, false
 	}
 
-	t, err := strconv.Atoi(r.targetValue)
-	if err != nil {
-		return false
+	t, tPre, ok := parseSemver(target)
+	if !ok {
+		return 0, false
+	}
+
+	for i := 0; i < len(v); i++ {
+		if v[i] != t[i] {
+			if v[i] < t[i] {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+
+	if vPre == tPre {
+		return 0, true
+	} else if vPre == "" {
+		return 1, true
+	} else if tPre == "" {
+		return -1, true
+	} else if vPre < tPre {
+		return -1, true
 	}
 
-	return s > t
+	return 1, true
 }
 
-func (r *RoutingItem) ge(srvValue string) bool {
-	s, err := strconv.Atoi(srvValue)
-	if err != nil {
-		return false
+func parseSemver(value string) ([3]int, string, bool) {
+	var version [3]int
+
+	value = strings.TrimPrefix(value, "v")
+
+	// the build metadata is ignored
+	if index := strings.Index(value, "+"); index >= 0 {
+		value = value[:index]
 	}
 
-	t, err := strconv.Atoi(r.targetValue)
-	if err != nil {
-		return false
+	pre := ""
+	if index := strings.Index(value, "-"); index >= 0 {
+		pre = value[index+1:]
+		value = value[:index]
 	}
 
-	return s >= t
-}
+	numbers := strings.Split(value, ".")
+	if len(numbers) > 3 {
+		return version, "", false
+	}
 
-func (r *RoutingItem) in(srvValue string) bool {
-	return strings.Index(srvValue, r.targetValue) != -1
-}
+	for index, number := range numbers {
+		v, err := strconv.Atoi(number)
+		if err != nil || v < 0 {
+			return version, "", false
+		}
+		version[index] = v
+	}
 
-func (r *RoutingItem) reg(srvValue string) bool {
-	matches, err := regexp.MatchString(r.targetValue, srvValue)
-	return err == nil && matches
+	return version, pre, true
 }
@@ -0,0 +1,306 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// routing expression grammar:
+//   expr       := and ( "||" and )*
+//   and        := unary ( "&&" unary )*
+//   unary      := "!" unary | "(" expr ")" | comparison
+//   comparison := source op value
+// The value can be quoted by "", otherwise it ends at &&, || or a unbalanced ).
+// The spaces around the op can be omitted, like $header_abc==abc,
+// a value starts with the chars of the ops needs a space after the op.
+
+const (
+	tokenAnd = "&&"
+	tokenOr  = "||"
+
+	operatorChars = "=!<>~"
+)
+
+type routingExpr interface {
+	eval(ctx *requestContext) bool
+}
+
+type routingAnd []routingExpr
+
+type routingOr []routingExpr
+
+type routingNot struct {
+	expr routingExpr
+}
+
+func (e routingAnd) eval(ctx *requestContext) bool {
+	for _, expr := range e {
+		if !expr.eval(ctx) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e routingOr) eval(ctx *requestContext) bool {
+	for _, expr := range e {
+		if expr.eval(ctx) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e routingNot) eval(ctx *requestContext) bool {
+	return !e.expr.eval(ctx)
+}
+
+type routingParser struct {
+	input string
+	pos   int
+}
+
+func parseRoutingExpr(input string) (routingExpr, error) {
+	p := &routingParser{
+		input: input,
+	}
+
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, ErrSyntax
+	}
+
+	return expr, nil
+}
+
+func (p *routingParser) parseOr() (routingExpr, error) {
+	var exprs routingOr
+	for {
+		expr, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		p.skipSpaces()
+		if !p.consume(tokenOr) {
+			break
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+
+	return exprs, nil
+}
+
+func (p *routingParser) parseAnd() (routingExpr, error) {
+	var exprs routingAnd
+	for {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+
+		p.skipSpaces()
+		if !p.consume(tokenAnd) {
+			break
+		}
+	}
+
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+
+	return exprs, nil
+}
+
+func (p *routingParser) parseUnary() (routingExpr, error) {
+	p.skipSpaces()
+
+	if p.consume("!") {
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return routingNot{expr: expr}, nil
+	}
+
+	if p.consume("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpaces()
+		if !p.consume(")") {
+			return nil, ErrSyntax
+		}
+
+		return expr, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *routingParser) parseComparison() (routingExpr, error) {
+	start := p.pos
+
+	source := p.readSource()
+	p.skipSpaces()
+	op := p.readOperator()
+	p.skipSpaces()
+
+	value, err := p.readValue()
+	if err != nil {
+		return nil, err
+	}
+
+	item := &RoutingItem{
+		rule: strings.TrimSpace(p.input[start:p.pos]),
+	}
+
+	err = item.init(source, op, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// readSource read until the whitespace if a operator follows, like $header_abc == abc,
+// otherwise the operator follows the source without spaces, like $header_abc==abc
+func (p *routingParser) readSource() string {
+	start := p.pos
+	for !p.eof() && !unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	end := p.pos
+	p.skipSpaces()
+	if p.peekOperator() {
+		p.pos = end
+		return p.input[start:end]
+	}
+
+	p.pos = start
+	for !p.eof() && !unicode.IsSpace(rune(p.input[p.pos])) && !strings.ContainsRune(operatorChars, rune(p.input[p.pos])) {
+		p.pos++
+	}
+
+	return p.input[start:p.pos]
+}
+
+// readOperator read the symbol operator like ==, or the word operator like in
+func (p *routingParser) readOperator() string {
+	start := p.pos
+	if !p.eof() && strings.ContainsRune(operatorChars, rune(p.input[p.pos])) {
+		for !p.eof() && strings.ContainsRune(operatorChars, rune(p.input[p.pos])) {
+			p.pos++
+		}
+	} else {
+		for !p.eof() && unicode.IsLetter(rune(p.input[p.pos])) {
+			p.pos++
+		}
+	}
+
+	return p.input[start:p.pos]
+}
+
+func (p *routingParser) peekOperator() bool {
+	pos := p.pos
+	op := p.readOperator()
+	p.pos = pos
+
+	return op == IN || (op != "" && strings.ContainsRune(operatorChars, rune(op[0])))
+}
+
+func (p *routingParser) readValue() (string, error) {
+	if p.eof() {
+		return "", ErrSyntax
+	}
+
+	if p.input[p.pos] == '"' {
+		return p.readQuoted()
+	}
+
+	start := p.pos
+	depth := 0
+	for !p.eof() {
+		if strings.HasPrefix(p.input[p.pos:], tokenAnd) || strings.HasPrefix(p.input[p.pos:], tokenOr) {
+			break
+		}
+
+		c := p.input[p.pos]
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		}
+
+		p.pos++
+	}
+
+	value := strings.TrimSpace(p.input[start:p.pos])
+	if value == "" {
+		return "", ErrSyntax
+	}
+
+	return value, nil
+}
+
+func (p *routingParser) readQuoted() (string, error) {
+	start := p.pos
+	p.pos++
+
+	for !p.eof() {
+		c := p.input[p.pos]
+		p.pos++
+
+		if c == '\\' {
+			p.pos++
+		} else if c == '"' {
+			value, err := strconv.Unquote(p.input[start:p.pos])
+			if err != nil {
+				return "", ErrSyntax
+			}
+
+			return value, nil
+		}
+	}
+
+	return "", ErrSyntax
+}
+
+func (p *routingParser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *routingParser) consume(token string) bool {
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+
+	return false
+}
+
+func (p *routingParser) eof() bool {
+	return p.pos >= len(p.input)
+}
@@ -1,7 +1,10 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/valyala/fasthttp"
 )
@@ -23,7 +26,7 @@ func TestParse(t *testing.T) {
 }
 
 func TestParseError(t *testing.T) {
-	_, err := newRoutingItem("$header_abc != abc")
+	_, err := newRoutingItem("$header_abc <> abc")
 
 	if err == nil {
 		t.Error("parse error.")
@@ -41,7 +44,7 @@ func TestParseHeader(t *testing.T) {
 	req.SetRequestURI("/abc")
 	req.Header.Add("abc", "abc")
 
-	if r.sourceValueFun(req) != "abc" {
+	if r.sourceValueFun(&requestContext{req: req}) != "abc" {
 		t.Error("parse header error")
 	}
 }
@@ -57,7 +60,7 @@ func TestParseCookie(t *testing.T) {
 	req.SetRequestURI("/abc")
 	req.Header.Add("cookie", "abc=abc")
 
-	if r.sourceValueFun(req) != "abc" {
+	if r.sourceValueFun(&requestContext{req: req}) != "abc" {
 		t.Error("parse cookie error")
 	}
 }
@@ -72,7 +75,7 @@ func TestParseQuery(t *testing.T) {
 	req := &fasthttp.Request{}
 	req.SetRequestURI("http://127.0.0.1:8080/abc?abc=abc")
 
-	if r.sourceValueFun(req) != "abc" {
+	if r.sourceValueFun(&requestContext{req: req}) != "abc" {
 		t.Error("parse cookie error")
 	}
 }
@@ -281,3 +284,275 @@ func TestMatchesRoutingAllLogic(t *testing.T) {
 		t.Error("matches and error")
 	}
 }
+
+func TestMatchesExpression(t *testing.T) {
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://api.example.com/users/1?version=2.5&app=v1.10.0")
+	req.Header.SetMethod("POST")
+	req.Header.SetContentType("application/json")
+	req.SetBodyString(`{"user":{"name":"a b","level":3}}`)
+	req.Header.Set("abc", "abc")
+
+	ctx := &requestContext{
+		req:      req,
+		clientIP: "10.1.2.3",
+	}
+
+	cases := []struct {
+		expr  string
+		value bool
+	}{
+		{"$method == post", true},
+		{"$host == API.example.com", true},
+		{"$path ~ ^/users/\\d+$", true},
+		{"$ip == 10.0.0.0/8", true},
+		{"$ip in 192.168.0.0/16,10.1.2.3", true},
+		{"$ip != 10.0.0.0/8", false},
+		{"$query_version > 2.10", true},
+		{"$query_version >= 2.5", true},
+		{"$query_app > v1.9.0", true},
+		{"$query_app < 1.10.0", false},
+		{`$body_user.name == "a b"`, true},
+		{"$body_user.level <= 3", true},
+		{"$query_missing != abc", true},
+		{"!$method == GET", true},
+		{"$method == GET || $query_version < 3 && $ip == 10.1.2.3", true},
+		{"($method == GET || $query_version < 3) && $ip == 127.0.0.1", false},
+		{"!($method == GET || $query_version < 2) && ($path ~ ^/users(/.*)?$)", true},
+		{"$method==post", true},
+		{"$header_abc==abc", true},
+		{"$header_abc !=abc", false},
+		{"$query_version>=2.5", true},
+		{"$query_version<2.5", false},
+		{"$query_app!=v1.10.0", false},
+		{"$path~^/users/\\d+$", true},
+		{"$ip in192.168.0.0/16,10.1.2.3", true},
+		{"$body_user.level<=3&&$method==POST", true},
+		{"!($method==GET)&&$query_version>2", true},
+	}
+
+	for _, c := range cases {
+		expr, err := parseRoutingExpr(c.expr)
+		if err != nil {
+			t.Errorf("parse <%s> failed, errors:%+v", c.expr, err)
+			continue
+		}
+
+		if expr.eval(ctx) != c.value {
+			t.Errorf("<%s> expect %v, but %v", c.expr, c.value, !c.value)
+		}
+	}
+}
+
+func TestParseExpressionError(t *testing.T) {
+	exprs := []string{
+		"$method_abc == GET",
+		"$query == abc",
+		"$ip == abc",
+		"($query_abc == 1",
+		"$query_abc == 1 &&",
+		`$query_abc == "abc`,
+		"$query_abc ~ (",
+		"$query_abc<>1",
+		"$query_abc==",
+	}
+
+	for _, expr := range exprs {
+		_, err := parseRoutingExpr(expr)
+		if err == nil {
+			t.Errorf("<%s> expect syntax error", expr)
+		}
+	}
+}
+
+func TestMatchesRoutingExpression(t *testing.T) {
+	data := `desc = "test";
+	deadline = 100;
+	expression = "$query_abc == 10 && !($header_x-env == test || $cookie_uid in admin)";
+	`
+
+	r, err := NewRouting(data, "cluster", "/abc*")
+	if err != nil {
+		t.Errorf("parse error, errors:%+v", err)
+		return
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://127.0.0.1:8080/abc?abc=10")
+	if !r.Matches(req) {
+		t.Error("matches and error")
+	}
+
+	req.Header.Set("x-env", "test")
+	if r.Matches(req) {
+		t.Error("matches and error")
+	}
+}
+
+func TestParseRoutingWindow(t *testing.T) {
+	// 2026-10-16 is a Friday
+	cases := []struct {
+		window string
+		now    string
+		value  bool
+	}{
+		{"Mon-Fri 09:00-18:00", "2026-10-16 09:00", true},
+		{"Mon-Fri 09:00-18:00", "2026-10-16 18:00", false},
+		{"Mon-Fri 09:00-18:00", "2026-10-17 10:00", false},
+		{"Sat-Mon 09:00-18:00", "2026-10-19 10:00", true},
+		{"Mon,Fri 09:00-18:00", "2026-10-15 10:00", false},
+		{"Fri 22:00-06:00", "2026-10-17 05:59", true},
+		{"Fri 22:00-06:00", "2026-10-16 05:59", false},
+		{"* 22:00-06:00", "2026-10-16 23:00", true},
+	}
+
+	for _, c := range cases {
+		w, err := parseRoutingWindow(c.window)
+		if err != nil {
+			t.Errorf("parse <%s> failed, errors:%+v", c.window, err)
+			continue
+		}
+
+		now, _ := time.Parse("2006-01-02 15:04", c.now)
+		if w.contains(now) != c.value {
+			t.Errorf("<%s> at <%s> expect %v, but %v", c.window, c.now, c.value, !c.value)
+		}
+	}
+
+	for _, window := range []string{"Mon-Fri", "Mon-Xyz 09:00-18:00", "* 9-18", "* 09:00-25:00"} {
+		_, err := parseRoutingWindow(window)
+		if err == nil {
+			t.Errorf("<%s> expect error", window)
+		}
+	}
+}
+
+func TestMatchesRoutingTime(t *testing.T) {
+	data := `desc = "test";
+	start = 10;
+	deadline = 100;
+	timezone = "UTC";
+	windows = ["Mon-Fri 09:00-18:00"];
+	rule = ["$query_abc == 10"];
+	`
+
+	r, err := NewRouting(data, "cluster", "/abc*")
+	if err != nil {
+		t.Errorf("parse error, errors:%+v", err)
+		return
+	}
+
+	// a friday
+	r.CreateAt = time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC).Unix()
+	created := time.Unix(r.CreateAt, 0)
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://127.0.0.1:8080/abc?abc=10")
+	ctx := &requestContext{req: req}
+
+	if r.matches(ctx, created.Add(time.Second*5)) {
+		t.Error("matches before start")
+	}
+
+	if !r.matches(ctx, created.Add(time.Second*10)) {
+		t.Error("not matches after start")
+	}
+
+	if r.matches(ctx, created.Add(time.Second*100)) || !r.Expired(created.Add(time.Second*100)) {
+		t.Error("matches after deadline")
+	}
+
+	r.deadline = 0
+	if r.matches(ctx, created.Add(time.Hour*24)) {
+		t.Error("matches out of the windows")
+	}
+
+	if !r.matches(ctx, created.Add(time.Hour*72)) {
+		t.Error("not matches in the windows")
+	}
+}
+
+func TestMatchesRoutingOrder(t *testing.T) {
+	rt := &RouteTable{
+		routings: make(map[string]*Routing),
+	}
+
+	for index, order := range []int{3, 1, 2, 1} {
+		data := fmt.Sprintf(`desc = "test"; deadline = 0; order = %d; rule = ["$query_abc == 10"];`, order)
+		r, err := NewRouting(data, fmt.Sprintf("cluster-%d", index), "/abc*")
+		if err != nil {
+			t.Errorf("parse error, errors:%+v", err)
+			return
+		}
+		r.ID = fmt.Sprintf("%d", index)
+		r.CreateAt = 1
+		rt.routings[r.ID] = r
+	}
+
+	rt.sortRoutings()
+
+	var ids []string
+	for _, r := range rt.sortedRoutings {
+		ids = append(ids, r.ID)
+	}
+
+	if strings.Join(ids, ",") != "1,3,2,0" {
+		t.Errorf("expect <1,3,2,0>, but <%s>", strings.Join(ids, ","))
+	}
+}
+
+func TestMatchesRoutingDisabled(t *testing.T) {
+	data := `desc = "test";
+	deadline = 100;
+	rule = ["$query_abc == 10"];
+	`
+
+	r, err := NewRouting(data, "cluster", "/abc*")
+	if err != nil {
+		t.Errorf("parse error, errors:%+v", err)
+		return
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://127.0.0.1:8080/abc?abc=10")
+
+	r.Disabled = true
+	if r.Matches(req) {
+		t.Error("disabled routing matches")
+	}
+
+	r.Disabled = false
+	if !r.Matches(req) {
+		t.Error("enabled routing not matches")
+	}
+}
+
+func TestSelectClusterByRoutingExpired(t *testing.T) {
+	rt := NewRouteTable(nil, nil, nil)
+	src := &Cluster{Name: "src"}
+	target := &Cluster{Name: "target"}
+	rt.clusters[src.Name] = src
+	rt.clusters[target.Name] = target
+
+	r, err := NewRouting(`desc = "test"; deadline = 100; rule = ["$query_abc == 10"];`, target.Name, "/abc*")
+	if err != nil {
+		t.Fatalf("parse error, errors:%+v", err)
+	}
+	r.CreateAt = time.Now().Unix() - 100
+
+	err = rt.AddNewRouting(r)
+	if err != nil {
+		t.Fatalf("add routing error, errors:%+v", err)
+	}
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("http://127.0.0.1:8080/abc?abc=10")
+
+	if rt.selectClusterByRouting(&requestContext{req: req}, src) != src {
+		t.Error("expired routing selected")
+	}
+
+	if _, ok := rt.routings[r.ID]; !ok {
+		t.Error("expired routing removed from the route table")
+	}
+}
@@ -0,0 +1,122 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	weekdays = map[string]time.Weekday{
+		"sun": time.Sunday,
+		"mon": time.Monday,
+		"tue": time.Tuesday,
+		"wed": time.Wednesday,
+		"thu": time.Thursday,
+		"fri": time.Friday,
+		"sat": time.Saturday,
+	}
+)
+
+// routingWindow a recurring time window like "Mon-Fri 09:00-18:00",
+// the days can be *, a day, a day range or days separated by comma like Mon,Wed,Fri.
+// The window crosses midnight if the end is not after the start, like "* 22:00-06:00",
+// the time after midnight belongs to the day of the start.
+type routingWindow struct {
+	days       [7]bool
+	start, end int // minutes of the day
+}
+
+func parseRoutingWindow(value string) (*routingWindow, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("invalid time window: %s, must be <days> <HH:MM>-<HH:MM>", value)
+	}
+
+	w := &routingWindow{}
+
+	err := w.parseDays(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window: %s, %s", value, err)
+	}
+
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid time window: %s, must be <days> <HH:MM>-<HH:MM>", value)
+	}
+
+	w.start, err = parseMinutes(times[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window: %s, %s", value, err)
+	}
+
+	w.end, err = parseMinutes(times[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid time window: %s, %s", value, err)
+	}
+
+	return w, nil
+}
+
+func (w *routingWindow) parseDays(value string) error {
+	if value == "*" {
+		for i := range w.days {
+			w.days[i] = true
+		}
+		return nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		days := strings.Split(item, "-")
+		if len(days) > 2 {
+			return fmt.Errorf("invalid days: %s", item)
+		}
+
+		from, ok := weekdays[strings.ToLower(days[0])]
+		if !ok {
+			return fmt.Errorf("invalid day: %s", days[0])
+		}
+
+		to := from
+		if len(days) == 2 {
+			to, ok = weekdays[strings.ToLower(days[1])]
+			if !ok {
+				return fmt.Errorf("invalid day: %s", days[1])
+			}
+		}
+
+		// the range can wrap the week, like Sat-Mon
+		for day := from; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func (w *routingWindow) contains(now time.Time) bool {
+	minutes := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && minutes >= w.start && minutes < w.end
+	}
+
+	if minutes >= w.start {
+		return w.days[day]
+	}
+
+	return minutes < w.end && w.days[(day+6)%7]
+}
+
+func parseMinutes(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time: %s, must be HH:MM", value)
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
@@ -2,9 +2,13 @@ package model
 
 import (
 	"errors"
+	"net"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/fagongzi/gateway/pkg/conf"
 	"github.com/fagongzi/goetty"
 	"github.com/fagongzi/log"
@@ -33,17 +37,30 @@ var (
 	ErrAPINotFound = errors.New("API not found")
 	// ErrRoutingNotFound Routing not found
 	ErrRoutingNotFound = errors.New("Routing not found")
+	// ErrQuotaNotFound Quota not found
+	ErrQuotaNotFound = errors.New("Quota not found")
+	// ErrConsumerNotFound Consumer not found
+	ErrConsumerNotFound = errors.New("Consumer not found")
+	// ErrJWTKeySetNotFound JWTKeySet not found
+	ErrJWTKeySetNotFound = errors.New("JWT key set not found")
+	// ErrIPSetNotFound IPSet not found
+	ErrIPSetNotFound = errors.New("IP set not found")
+	// ErrBlockedIPNotFound BlockedIP not found
+	ErrBlockedIPNotFound = errors.New("Blocked ip not found")
+	// ErrVHostNotFound VHost not found
+	ErrVHostNotFound = errors.New("VHost not found")
 )
 
 // RouteResult RouteResult
 type RouteResult struct {
-	API   *API
-	Node  *Node
-	Svr   *Server
-	Err   error
-	Code  int
-	Res   *fasthttp.Response
-	Merge bool
+	API    *API
+	Node   *Node
+	Svr    *Server
+	Params PathParams
+	Err    error
+	Code   int
+	Res    *fasthttp.Response
+	Merge  bool
 }
 
 // Release release resp
@@ -77,7 +94,23 @@ type RouteTable struct {
 	svrs     map[string]*Server
 	mapping  map[string]map[string]*Cluster
 	apis     map[string]*API
+	router   *hostRouter // rebuilt when the apis or vhosts changed
 	routings map[string]*Routing
+	quotas   map[string]*Quota
+
+	sortedRoutings []*Routing // evaluated in this order
+
+	consumers    map[string]*Consumer
+	consumerKeys map[string]*Consumer // key hash -> consumer
+
+	jwtKeySets map[string]*JWTKeySet
+	nonces     *signatureNonces
+
+	ipSets map[string]*IPSet
+
+	blocklist *blocklist
+
+	vhosts map[string]*VHost
 
 	store Store
 
@@ -87,7 +120,8 @@ type RouteTable struct {
 	watchStopCh    chan bool
 	watchReceiveCh chan *Evt
 
-	analysiser *Analysis
+	analysiser    *Analysis
+	globalLimiter *globalLimiter
 }
 
 // NewRouteTable create a new RouteTable
@@ -100,16 +134,31 @@ func NewRouteTable(cnf *conf.Conf, store Store, taskRunner *task.Runner) *RouteT
 		tw:    tw,
 		store: store,
 
-		analysiser: newAnalysis(taskRunner),
+		analysiser:    newAnalysis(taskRunner),
+		globalLimiter: newGlobalLimiter(store, cnf, taskRunner),
 
 		rwLock: &sync.RWMutex{},
 
 		clusters: make(map[string]*Cluster),
 		svrs:     make(map[string]*Server),
 		apis:     make(map[string]*API),
+		router:   newHostRouter(nil, nil),
 		routings: make(map[string]*Routing),
+		quotas:   make(map[string]*Quota),
 		mapping:  make(map[string]map[string]*Cluster), // serverAddr -> map[clusterName]*Cluster
 
+		consumers:    make(map[string]*Consumer),
+		consumerKeys: make(map[string]*Consumer),
+
+		jwtKeySets: make(map[string]*JWTKeySet),
+		nonces:     newSignatureNonces(maxSignatureNonces),
+
+		ipSets: make(map[string]*IPSet),
+
+		blocklist: newBlocklist(),
+
+		vhosts: make(map[string]*VHost),
+
 		evtChan:        make(chan *Server, 1024),
 		watchStopCh:    make(chan bool),
 		watchReceiveCh: make(chan *Evt),
@@ -119,6 +168,14 @@ func NewRouteTable(cnf *conf.Conf, store Store, taskRunner *task.Runner) *RouteT
 	return rt
 }
 
+// GetAPI returns the api of the vhost, url and method
+func (r *RouteTable) GetAPI(vhost, url, method string) *API {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	return r.apis[getAPIKey(vhost, url, method)]
+}
+
 // GetServer return server
 func (r *RouteTable) GetServer(addr string) *Server {
 	return r.svrs[addr]
@@ -142,12 +199,32 @@ func (r *RouteTable) AddNewRouting(routing *Routing) error {
 	}
 
 	r.routings[routing.ID] = routing
+	r.sortRoutings()
 
 	log.Infof("meta: routing <%s> added", routing.Cfg)
 
 	return nil
 }
 
+// UpdateRouting add or update a route
+func (r *RouteTable) UpdateRouting(routing *Routing) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	err := routing.Check()
+
+	if nil != err {
+		return err
+	}
+
+	r.routings[routing.ID] = routing
+	r.sortRoutings()
+
+	log.Infof("meta: routing <%s> updated, disabled=<%t>", routing.Cfg, routing.Disabled)
+
+	return nil
+}
+
 // DeleteRouting delete a route
 func (r *RouteTable) DeleteRouting(id string) error {
 	r.rwLock.Lock()
@@ -160,26 +237,454 @@ func (r *RouteTable) DeleteRouting(id string) error {
 	}
 
 	delete(r.routings, id)
+	r.sortRoutings()
 
 	log.Infof("meta: routing <%s> deleted", route.Cfg)
 
 	return nil
 }
 
+// UpdateQuota add or update a quota
+func (r *RouteTable) UpdateQuota(quota *Quota) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	r.quotas[quota.Key()] = quota
+
+	log.Infof("meta: quota <%s, %s> updated, limit=<%d> period=<%s>",
+		quota.Consumer,
+		quota.Group,
+		quota.Limit,
+		quota.PeriodName())
+
+	return nil
+}
+
+// DeleteQuota delete a quota
+func (r *RouteTable) DeleteQuota(key string) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	quota, ok := r.quotas[key]
+
+	if !ok {
+		return ErrQuotaNotFound
+	}
+
+	delete(r.quotas, key)
+
+	log.Infof("meta: quota <%s, %s> deleted", quota.Consumer, quota.Group)
+
+	return nil
+}
+
+// CheckQuota take a call from the quota of the consumer, the consumer is get from the request
+// by the keyFrom of the api quota if it's empty, the claims are the claims of the verified jwt.
+// The request without consumer is not limited. Returns a QuotaExceededError if the quota is exhausted
+func (r *RouteTable) CheckQuota(api *API, consumer string, req *fasthttp.Request, clientIP string, claims map[string]interface{}) error {
+	if nil == api.Quota {
+		return nil
+	}
+
+	if consumer == "" {
+		value, ok := api.getQuotaConsumer(req, clientIP, claims)
+		if !ok {
+			return nil
+		}
+		consumer = value
+	}
+	quota := r.getQuota(consumer, api.Quota.Group)
+	if nil == quota {
+		return nil
+	}
+
+	now := time.Now()
+	resetAt := quota.ResetAt(now)
+	key := quota.UsageKey(consumer, now)
+	// the usage of the period may be counted by the other proxies, or before this proxy restarted
+	r.globalLimiter.load(key, resetAt, now)
+	ok, _, _ := r.globalLimiter.take(key, quota.Limit, resetAt, now)
+	if ok {
+		return nil
+	}
+
+	return &QuotaExceededError{
+		Message:  "quota exceeded",
+		Consumer: consumer,
+		Group:    quota.Group,
+		Period:   quota.PeriodName(),
+		Limit:    quota.Limit,
+		ResetAt:  resetAt.Unix(),
+	}
+}
+
+func (r *RouteTable) getQuota(consumer, group string) *Quota {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	if quota, ok := r.quotas[getQuotaKey(consumer, group)]; ok {
+		return quota
+	}
+
+	return r.quotas[getQuotaKey(QuotaAnyConsumer, group)]
+}
+
+// UpdateConsumer add or update a consumer
+func (r *RouteTable) UpdateConsumer(consumer *Consumer) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	r.removeConsumerKeys(consumer.ID)
+
+	r.consumers[consumer.ID] = consumer
+	for _, key := range consumer.Keys {
+		r.consumerKeys[key] = consumer
+	}
+
+	log.Infof("meta: consumer <%s, %s> updated, keys=<%d>",
+		consumer.ID,
+		consumer.Name,
+		len(consumer.Keys))
+
+	return nil
+}
+
+// DeleteConsumer delete a consumer
+func (r *RouteTable) DeleteConsumer(id string) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	if _, ok := r.consumers[id]; !ok {
+		return ErrConsumerNotFound
+	}
+
+	r.removeConsumerKeys(id)
+	delete(r.consumers, id)
+	r.nonces.remove(id)
+
+	log.Infof("meta: consumer <%s> deleted", id)
+
+	return nil
+}
+
+func (r *RouteTable) removeConsumerKeys(id string) {
+	if old, ok := r.consumers[id]; ok {
+		for _, key := range old.Keys {
+			if r.consumerKeys[key] == old {
+				delete(r.consumerKeys, key)
+			}
+		}
+	}
+}
+
+// AuthenticateByKey returns the consumer of the api key in the request.
+// Returns nil consumer and nil error if the api not require a api key.
+func (r *RouteTable) AuthenticateByKey(api *API, req *fasthttp.Request) (*Consumer, error) {
+	if nil == api.Consumers {
+		return nil, nil
+	}
+
+	key := api.Consumers.getKey(req)
+	if key == "" {
+		return nil, ErrMissingAPIKey
+	}
+
+	r.rwLock.RLock()
+	consumer, ok := r.consumerKeys[HashAPIKey(key)]
+	r.rwLock.RUnlock()
+
+	if !ok {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if !api.Consumers.allow(consumer) {
+		return consumer, ErrConsumerForbidden
+	}
+
+	return consumer, nil
+}
+
+// AllowConsumer returns ErrConsumerForbidden if the consumer authenticated by the other filters,
+// like SIGNATURE or a remote filter, can't call the api. Returns nil if the api not require a api key.
+func (r *RouteTable) AllowConsumer(api *API, id string) error {
+	if nil == api.Consumers {
+		return nil
+	}
+
+	r.rwLock.RLock()
+	consumer, ok := r.consumers[id]
+	r.rwLock.RUnlock()
+
+	if !ok || !api.Consumers.allow(consumer) {
+		return ErrConsumerForbidden
+	}
+
+	return nil
+}
+
+// UpdateJWTKeySet add or update a jwt key set
+func (r *RouteTable) UpdateJWTKeySet(keySet *JWTKeySet) error {
+	err := keySet.parse()
+	if err != nil {
+		log.Errorf("meta: jwt key set <%s> parse failed, errors:\n%+v",
+			keySet.ID,
+			err)
+		return err
+	}
+
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	r.jwtKeySets[keySet.ID] = keySet
+
+	log.Infof("meta: jwt key set <%s> updated, issuer=<%s>",
+		keySet.ID,
+		keySet.Issuer)
+
+	return nil
+}
+
+// DeleteJWTKeySet delete a jwt key set
+func (r *RouteTable) DeleteJWTKeySet(id string) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	if _, ok := r.jwtKeySets[id]; !ok {
+		return ErrJWTKeySetNotFound
+	}
+
+	delete(r.jwtKeySets, id)
+
+	log.Infof("meta: jwt key set <%s> deleted", id)
+
+	return nil
+}
+
+// VerifyJWT verify the bearer jwt of the request by the jwt rule of the api,
+// returns the claims and the headers mapped from the claims.
+// Returns nil claims and nil error if the api has no jwt rule.
+func (r *RouteTable) VerifyJWT(api *API, req *fasthttp.Request) (map[string]interface{}, map[string]string, error) {
+	if nil == api.JWT {
+		return nil, nil, nil
+	}
+
+	value := getBearerToken(req)
+	if value == "" {
+		return nil, nil, ErrMissingJWT
+	}
+
+	parser := &jwt.Parser{}
+	token, err := parser.Parse(value, func(token *jwt.Token) (interface{}, error) {
+		keys := r.getJWTKeys(token)
+		if len(keys) == 0 {
+			return nil, ErrJWTKeyNotFound
+		}
+
+		return verifyKey(token, keys), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iss, _ := token.Claims["iss"].(string)
+	if !api.JWT.trustIssuer(iss) {
+		return nil, nil, ErrJWTInvalidIssuer
+	}
+
+	if !api.JWT.checkAudience(token.Claims) {
+		return nil, nil, ErrJWTInvalidAudience
+	}
+
+	if !api.JWT.checkClaims(token.Claims) {
+		return token.Claims, nil, ErrJWTForbidden
+	}
+
+	return token.Claims, api.JWT.headers(token.Claims), nil
+}
+
+// getJWTKeys returns the keys of the matched key sets in the order of the key set id
+func (r *RouteTable) getJWTKeys(token *jwt.Token) []interface{} {
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	var matched []*JWTKeySet
+	for _, keySet := range r.jwtKeySets {
+		if keySet.matches(token) {
+			matched = append(matched, keySet)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].ID < matched[j].ID
+	})
+
+	keys := make([]interface{}, 0, len(matched))
+	for _, keySet := range matched {
+		keys = append(keys, keySet.getKey(token))
+	}
+
+	return keys
+}
+
+// UpdateIPSet add or update a ip set
+func (r *RouteTable) UpdateIPSet(ipSet *IPSet) error {
+	err := ipSet.parse()
+	if err != nil {
+		log.Errorf("meta: ip set <%s> parse failed, errors:\n%+v",
+			ipSet.Name,
+			err)
+		return err
+	}
+
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	r.ipSets[ipSet.Name] = ipSet
+
+	log.Infof("meta: ip set <%s> updated, ips=<%d>",
+		ipSet.Name,
+		len(ipSet.IPs))
+
+	return nil
+}
+
+// DeleteIPSet delete a ip set
+func (r *RouteTable) DeleteIPSet(name string) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	if _, ok := r.ipSets[name]; !ok {
+		return ErrIPSetNotFound
+	}
+
+	delete(r.ipSets, name)
+
+	log.Infof("meta: ip set <%s> deleted", name)
+
+	return nil
+}
+
+// UpdateVHost add or update a vhost
+func (r *RouteTable) UpdateVHost(vhost *VHost) error {
+	err := vhost.Check()
+	if err != nil {
+		log.Errorf("meta: vhost <%s> check failed, errors:\n%+v",
+			vhost.Name,
+			err)
+		return err
+	}
+
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	r.vhosts[vhost.Name] = vhost
+	r.router = newHostRouter(r.vhosts, r.apis)
+
+	log.Infof("meta: vhost <%s> updated, domains=<%v>",
+		vhost.Name,
+		vhost.Domains)
+
+	return nil
+}
+
+// DeleteVHost delete a vhost, the apis of the vhost are not routable until the vhost is added again
+func (r *RouteTable) DeleteVHost(name string) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	if _, ok := r.vhosts[name]; !ok {
+		return ErrVHostNotFound
+	}
+
+	delete(r.vhosts, name)
+	r.router = newHostRouter(r.vhosts, r.apis)
+
+	log.Infof("meta: vhost <%s> deleted", name)
+
+	return nil
+}
+
+// UpdateBlockedIP add or update a entry of the global blocklist
+func (r *RouteTable) UpdateBlockedIP(blockedIP *BlockedIP) error {
+	err := blockedIP.parse()
+	if err != nil {
+		log.Errorf("meta: blocked ip <%s> parse failed, errors:\n%+v",
+			blockedIP.IP,
+			err)
+		return err
+	}
+
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	r.blocklist.add(blockedIP)
+	r.addBlockedIPExpiration(blockedIP)
+
+	log.Infof("meta: blocked ip <%s> updated, ip=<%s> auto=<%v> expireAt=<%d>",
+		blockedIP.ID,
+		blockedIP.IP,
+		blockedIP.Auto,
+		blockedIP.ExpireAt)
+
+	return nil
+}
+
+// DeleteBlockedIP delete a entry of the global blocklist
+func (r *RouteTable) DeleteBlockedIP(id string) error {
+	r.rwLock.Lock()
+	defer r.rwLock.Unlock()
+
+	if !r.blocklist.remove(id) {
+		return ErrBlockedIPNotFound
+	}
+
+	r.tw.Cancel(getBlockedIPTimerKey(id))
+
+	log.Infof("meta: blocked ip <%s> deleted", id)
+
+	return nil
+}
+
+// AccessCheckBlacklist returns true if the ip in the blacklist of the api
+func (r *RouteTable) AccessCheckBlacklist(api *API, ip string) bool {
+	if api.AccessControl == nil || api.AccessControl.blacklist == nil {
+		return false
+	}
+
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	return api.AccessControl.blacklist.contains(net.ParseIP(ip), r.ipSets)
+}
+
+// AccessCheckWhitelist returns true if the ip in the whitelist of the api, or the api has no whitelist
+func (r *RouteTable) AccessCheckWhitelist(api *API, ip string) bool {
+	if api.AccessControl == nil || api.AccessControl.whitelist == nil {
+		return true
+	}
+
+	r.rwLock.RLock()
+	defer r.rwLock.RUnlock()
+
+	return api.AccessControl.whitelist.contains(net.ParseIP(ip), r.ipSets)
+}
+
 // AddNewAPI add a new API
 func (r *RouteTable) AddNewAPI(api *API) error {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 
-	_, ok := r.apis[api.URL]
+	_, ok := r.apis[api.key()]
 
 	if ok {
 		return ErrAPIExists
 	}
 
 	api.Parse()
+	api.initGlobalRateLimits(r.globalLimiter)
 
-	r.apis[getAPIKey(api.URL, api.Method)] = api
+	r.apis[api.key()] = api
+	r.router = newHostRouter(r.vhosts, r.apis)
 
 	log.Infof("meta: api <%s-%s> added", api.Method, api.URL)
 
@@ -191,32 +696,39 @@ func (r *RouteTable) UpdateAPI(api *API) error {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 
-	if _, ok := r.apis[getAPIKey(api.URL, api.Method)]; !ok {
+	if _, ok := r.apis[api.key()]; !ok {
 		return ErrAPINotFound
 	}
 
-	r.apis[getAPIKey(api.URL, api.Method)] = api
+	r.apis[api.key()] = api
 	api.Parse()
+	api.initGlobalRateLimits(r.globalLimiter)
+	r.router = newHostRouter(r.vhosts, r.apis)
 
 	log.Infof("meta: api <%s-%s> updated", api.Method, api.URL)
 
 	return nil
 }
 
-// DeleteAPI delete a api using url
-func (r *RouteTable) DeleteAPI(url, method string) error {
+// DeleteAPI delete a api using vhost, url and method
+func (r *RouteTable) DeleteAPI(vhost, url, method string) error {
+	return r.deleteAPI(getAPIKey(vhost, url, method))
+}
+
+func (r *RouteTable) deleteAPI(key string) error {
 	r.rwLock.Lock()
 	defer r.rwLock.Unlock()
 
-	_, ok := r.apis[getAPIKey(url, method)]
+	api, ok := r.apis[key]
 
 	if !ok {
 		return ErrAPINotFound
 	}
 
-	delete(r.apis, getAPIKey(url, method))
+	delete(r.apis, key)
+	r.router = newHostRouter(r.vhosts, r.apis)
 
-	log.Infof("meta: api <%s-%s> deleted", method, url)
+	log.Infof("meta: api <%s-%s> deleted", api.Method, api.URL)
 
 	return nil
 }
@@ -458,21 +970,25 @@ func (r *RouteTable) doUnBind(svr *Server, cluster *Cluster, withLock bool) {
 }
 
 // Select return route result
-func (r *RouteTable) Select(req *fasthttp.Request) []*RouteResult {
+func (r *RouteTable) Select(req *fasthttp.Request, clientIP string) []*RouteResult {
 	r.rwLock.RLock()
 
 	var results []*RouteResult
+	ctx := &requestContext{
+		req:      req,
+		clientIP: clientIP,
+	}
 
-	for _, api := range r.apis {
-		if api.matches(req) {
-			results = make([]*RouteResult, len(api.Nodes))
+	api, params := r.router.find(req, strings.ToUpper(string(req.Header.Method())))
+	if nil != api {
+		results = make([]*RouteResult, len(api.Nodes))
 
-			for index, node := range api.Nodes {
-				results[index] = &RouteResult{
-					API:  api,
-					Node: node,
-					Svr:  r.selectServer(req, r.selectClusterByRouting(req, r.clusters[node.ClusterName])),
-				}
+		for index, node := range api.Nodes {
+			results[index] = &RouteResult{
+				API:    api,
+				Node:   node,
+				Svr:    r.selectServer(req, r.selectClusterByRouting(ctx, r.clusters[node.ClusterName])),
+				Params: params,
 			}
 		}
 	}
@@ -481,11 +997,12 @@ func (r *RouteTable) Select(req *fasthttp.Request) []*RouteResult {
 	return results
 }
 
-func (r *RouteTable) selectClusterByRouting(req *fasthttp.Request, src *Cluster) *Cluster {
+func (r *RouteTable) selectClusterByRouting(ctx *requestContext, src *Cluster) *Cluster {
 	targetCluster := src
 
-	for _, routing := range r.routings {
-		if routing.Matches(req) {
+	now := time.Now()
+	for _, routing := range r.sortedRoutings {
+		if routing.matches(ctx, now) {
 			targetCluster = r.clusters[routing.ClusterName]
 			break
 		}
@@ -537,6 +1054,18 @@ func (r *RouteTable) doEvtReceive() {
 			r.doReceiveAPI(evt)
 		} else if evt.Src == EventSrcRouting {
 			r.doReceiveRouting(evt)
+		} else if evt.Src == EventSrcQuota {
+			r.doReceiveQuota(evt)
+		} else if evt.Src == EventSrcConsumer {
+			r.doReceiveConsumer(evt)
+		} else if evt.Src == EventSrcJWTKeySet {
+			r.doReceiveJWTKeySet(evt)
+		} else if evt.Src == EventSrcIPSet {
+			r.doReceiveIPSet(evt)
+		} else if evt.Src == EventSrcBlockedIP {
+			r.doReceiveBlockedIP(evt)
+		} else if evt.Src == EventSrcVHost {
+			r.doReceiveVHost(evt)
 		} else {
 			log.Warnf("meta: evt unknown <%+v>", evt)
 		}
@@ -551,7 +1080,67 @@ func (r *RouteTable) doReceiveRouting(evt *Evt) {
 	} else if evt.Type == EventTypeDelete {
 		r.DeleteRouting(evt.Key)
 	} else if evt.Type == EventTypeUpdate {
-		// TODO: impl
+		r.UpdateRouting(routing)
+	}
+}
+
+func (r *RouteTable) doReceiveQuota(evt *Evt) {
+	quota, _ := evt.Value.(*Quota)
+
+	if evt.Type == EventTypeNew || evt.Type == EventTypeUpdate {
+		r.UpdateQuota(quota)
+	} else if evt.Type == EventTypeDelete {
+		r.DeleteQuota(evt.Key)
+	}
+}
+
+func (r *RouteTable) doReceiveConsumer(evt *Evt) {
+	consumer, _ := evt.Value.(*Consumer)
+
+	if evt.Type == EventTypeNew || evt.Type == EventTypeUpdate {
+		r.UpdateConsumer(consumer)
+	} else if evt.Type == EventTypeDelete {
+		r.DeleteConsumer(evt.Key)
+	}
+}
+
+func (r *RouteTable) doReceiveJWTKeySet(evt *Evt) {
+	keySet, _ := evt.Value.(*JWTKeySet)
+
+	if evt.Type == EventTypeNew || evt.Type == EventTypeUpdate {
+		r.UpdateJWTKeySet(keySet)
+	} else if evt.Type == EventTypeDelete {
+		r.DeleteJWTKeySet(evt.Key)
+	}
+}
+
+func (r *RouteTable) doReceiveIPSet(evt *Evt) {
+	ipSet, _ := evt.Value.(*IPSet)
+
+	if evt.Type == EventTypeNew || evt.Type == EventTypeUpdate {
+		r.UpdateIPSet(ipSet)
+	} else if evt.Type == EventTypeDelete {
+		r.DeleteIPSet(evt.Key)
+	}
+}
+
+func (r *RouteTable) doReceiveBlockedIP(evt *Evt) {
+	blockedIP, _ := evt.Value.(*BlockedIP)
+
+	if evt.Type == EventTypeNew || evt.Type == EventTypeUpdate {
+		r.UpdateBlockedIP(blockedIP)
+	} else if evt.Type == EventTypeDelete {
+		r.DeleteBlockedIP(evt.Key)
+	}
+}
+
+func (r *RouteTable) doReceiveVHost(evt *Evt) {
+	vhost, _ := evt.Value.(*VHost)
+
+	if evt.Type == EventTypeNew || evt.Type == EventTypeUpdate {
+		r.UpdateVHost(vhost)
+	} else if evt.Type == EventTypeDelete {
+		r.DeleteVHost(evt.Key)
 	}
 }
 
@@ -561,7 +1150,7 @@ func (r *RouteTable) doReceiveAPI(evt *Evt) {
 	if evt.Type == EventTypeNew {
 		r.AddNewAPI(api)
 	} else if evt.Type == EventTypeDelete {
-		r.DeleteAPI(parseAPIKey(evt.Key))
+		r.deleteAPI(evt.Key)
 	} else if evt.Type == EventTypeUpdate {
 		r.UpdateAPI(api)
 	}
@@ -609,8 +1198,14 @@ func (r *RouteTable) Load() {
 	r.loadClusters()
 	r.loadServers()
 	r.loadBinds()
+	r.loadVHosts()
 	r.loadAPIs()
 	r.loadRoutings()
+	r.loadQuotas()
+	r.loadConsumers()
+	r.loadJWTKeySets()
+	r.loadIPSets()
+	r.loadBlockedIPs()
 
 	go r.watch()
 }
@@ -670,6 +1265,90 @@ func (r *RouteTable) loadRoutings() {
 	}
 }
 
+func (r *RouteTable) loadQuotas() {
+	quotas, err := r.store.GetQuotas()
+	if nil != err {
+		log.Errorf("meta: load quotas from store failed, errors:\n%+v",
+			err)
+		return
+	}
+
+	for _, quota := range quotas {
+		r.UpdateQuota(quota)
+	}
+}
+
+func (r *RouteTable) loadConsumers() {
+	consumers, err := r.store.GetConsumers()
+	if nil != err {
+		log.Errorf("meta: load consumers from store failed, errors:\n%+v",
+			err)
+		return
+	}
+
+	for _, consumer := range consumers {
+		r.UpdateConsumer(consumer)
+	}
+}
+
+func (r *RouteTable) loadJWTKeySets() {
+	keySets, err := r.store.GetJWTKeySets()
+	if nil != err {
+		log.Errorf("meta: load jwt key sets from store failed, errors:\n%+v",
+			err)
+		return
+	}
+
+	for _, keySet := range keySets {
+		r.UpdateJWTKeySet(keySet)
+	}
+}
+
+func (r *RouteTable) loadVHosts() {
+	vhosts, err := r.store.GetVHosts()
+	if nil != err {
+		log.Errorf("meta: load vhosts from store failed, errors:\n%+v",
+			err)
+		return
+	}
+
+	for _, vhost := range vhosts {
+		r.UpdateVHost(vhost)
+	}
+}
+
+func (r *RouteTable) loadIPSets() {
+	ipSets, err := r.store.GetIPSets()
+	if nil != err {
+		log.Errorf("meta: load ip sets from store failed, errors:\n%+v",
+			err)
+		return
+	}
+
+	for _, ipSet := range ipSets {
+		r.UpdateIPSet(ipSet)
+	}
+}
+
+func (r *RouteTable) loadBlockedIPs() {
+	blockedIPs, err := r.store.GetBlockedIPs()
+	if nil != err {
+		log.Errorf("meta: load blocked ips from store failed, errors:\n%+v",
+			err)
+		return
+	}
+
+	now := time.Now()
+	for _, blockedIP := range blockedIPs {
+		// the expired entries are kept by the stores without ttl
+		if blockedIP.Expired(now) {
+			continue
+		}
+
+		r.UpdateBlockedIP(blockedIP)
+	}
+}
+
 func (r *RouteTable) loadBinds() {
 	binds, err := r.store.GetBinds()
 	if nil != err {
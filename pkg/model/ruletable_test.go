@@ -285,7 +285,7 @@ func TestEtcdWatchUpdateAPI(t *testing.T) {
 
 	waitNotify()
 
-	existAPI, _ := rt.apis[getAPIKey(api.URL, api.Method)]
+	existAPI, _ := rt.apis[api.key()]
 
 	if len(existAPI.Nodes) != len(api.Nodes) {
 		t.Errorf("Nodes expect:<%d>, acture:<%d>. ", len(existAPI.Nodes), len(api.Nodes))
@@ -343,7 +343,7 @@ func TestEtcdWatchDeleteServer(t *testing.T) {
 }
 
 func TestEtcdWatchDeleteAPI(t *testing.T) {
-	err := rt.store.DeleteAPI(apiURL, apiMethod)
+	err := rt.store.DeleteAPI("", apiURL, apiMethod)
 
 	if nil != err {
 		t.Error("delete api err.")
@@ -47,6 +47,18 @@ const (
 	EventSrcAPI = EvtSrc(3)
 	// EventSrcRouting routing event
 	EventSrcRouting = EvtSrc(4)
+	// EventSrcQuota quota event
+	EventSrcQuota = EvtSrc(5)
+	// EventSrcConsumer consumer event
+	EventSrcConsumer = EvtSrc(6)
+	// EventSrcJWTKeySet jwt key set event
+	EventSrcJWTKeySet = EvtSrc(7)
+	// EventSrcIPSet ip set event
+	EventSrcIPSet = EvtSrc(8)
+	// EventSrcBlockedIP blocked ip event
+	EventSrcBlockedIP = EvtSrc(9)
+	// EventSrcVHost virtual host event
+	EventSrcVHost = EvtSrc(10)
 )
 
 // Evt event
@@ -125,12 +137,51 @@ type Store interface {
 
 	SaveAPI(api *API) error
 	UpdateAPI(api *API) error
-	DeleteAPI(url string, method string) error
+	DeleteAPI(vhost, url, method string) error
 	GetAPIs() ([]*API, error)
-	GetAPI(url string, method string) (*API, error)
+	GetAPI(vhost, url, method string) (*API, error)
 
 	SaveRouting(routing *Routing) error
+	UpdateRouting(routing *Routing) error
+	DeleteRouting(id string) error
 	GetRoutings() ([]*Routing, error)
+	GetRouting(id string) (*Routing, error)
+
+	SaveQuota(quota *Quota) error
+	UpdateQuota(quota *Quota) error
+	DeleteQuota(consumer, group string) error
+	GetQuotas() ([]*Quota, error)
+	GetQuota(consumer, group string) (*Quota, error)
+
+	SaveConsumer(consumer *Consumer) error
+	UpdateConsumer(consumer *Consumer) error
+	DeleteConsumer(id string) error
+	GetConsumers() ([]*Consumer, error)
+	GetConsumer(id string) (*Consumer, error)
+
+	SaveJWTKeySet(keySet *JWTKeySet) error
+	UpdateJWTKeySet(keySet *JWTKeySet) error
+	DeleteJWTKeySet(id string) error
+	GetJWTKeySets() ([]*JWTKeySet, error)
+	GetJWTKeySet(id string) (*JWTKeySet, error)
+
+	SaveIPSet(ipSet *IPSet) error
+	UpdateIPSet(ipSet *IPSet) error
+	DeleteIPSet(name string) error
+	GetIPSets() ([]*IPSet, error)
+	GetIPSet(name string) (*IPSet, error)
+
+	SaveBlockedIP(blockedIP *BlockedIP) error
+	UpdateBlockedIP(blockedIP *BlockedIP) error
+	DeleteBlockedIP(id string) error
+	GetBlockedIPs() ([]*BlockedIP, error)
+	GetBlockedIP(id string) (*BlockedIP, error)
+
+	SaveVHost(vhost *VHost) error
+	UpdateVHost(vhost *VHost) error
+	DeleteVHost(name string) error
+	GetVHosts() ([]*VHost, error)
+	GetVHost(name string) (*VHost, error)
 
 	Watch(evtCh chan *Evt, stopCh chan bool) error
 
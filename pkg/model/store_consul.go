@@ -2,31 +2,47 @@ package model
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/fagongzi/log"
 	"github.com/fagongzi/util/task"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/watch"
 )
 
+const (
+	// consulSweepInterval the interval to delete the expired entries, consul has no ttl for kv
+	consulSweepInterval = time.Minute
+)
+
 type consulStore struct {
 	consulAddr string
 	client     *api.Client
 
-	prefix      string
-	clustersDir string
-	serversDir  string
-	bindsDir    string
-	apisDir     string
-	proxiesDir  string
-	routingsDir string
-
-	taskRunner *task.Runner
+	prefix        string
+	clustersDir   string
+	serversDir    string
+	bindsDir      string
+	apisDir       string
+	proxiesDir    string
+	routingsDir   string
+	quotasDir     string
+	consumersDir  string
+	jwtKeySetsDir string
+	ipSetsDir     string
+	blocklistDir  string
+	vhostsDir     string
+	countersDir   string
+
+	counterSweep sync.Once
+	taskRunner   *task.Runner
 }
 
 // NewConsulStore returns a consul implemention store
@@ -36,15 +52,22 @@ func NewConsulStore(consulAddr string, prefix string, taskRunner *task.Runner) (
 	}
 
 	store := &consulStore{
-		consulAddr:  consulAddr,
-		prefix:      prefix,
-		clustersDir: fmt.Sprintf("%s/clusters", prefix),
-		serversDir:  fmt.Sprintf("%s/servers", prefix),
-		bindsDir:    fmt.Sprintf("%s/binds", prefix),
-		apisDir:     fmt.Sprintf("%s/apis", prefix),
-		proxiesDir:  fmt.Sprintf("%s/proxy", prefix),
-		routingsDir: fmt.Sprintf("%s/routings", prefix),
-		taskRunner:  taskRunner,
+		consulAddr:    consulAddr,
+		prefix:        prefix,
+		clustersDir:   fmt.Sprintf("%s/clusters", prefix),
+		serversDir:    fmt.Sprintf("%s/servers", prefix),
+		bindsDir:      fmt.Sprintf("%s/binds", prefix),
+		apisDir:       fmt.Sprintf("%s/apis", prefix),
+		proxiesDir:    fmt.Sprintf("%s/proxy", prefix),
+		routingsDir:   fmt.Sprintf("%s/routings", prefix),
+		quotasDir:     fmt.Sprintf("%s/quotas", prefix),
+		consumersDir:  fmt.Sprintf("%s/consumers", prefix),
+		jwtKeySetsDir: fmt.Sprintf("%s/jwtkeysets", prefix),
+		ipSetsDir:     fmt.Sprintf("%s/ipsets", prefix),
+		blocklistDir:  fmt.Sprintf("%s/blocklist", prefix),
+		vhostsDir:     fmt.Sprintf("%s/vhosts", prefix),
+		countersDir:   fmt.Sprintf("%s/counters", prefix),
+		taskRunner:    taskRunner,
 	}
 
 	conf := api.DefaultConfig()
@@ -343,7 +366,7 @@ func (s *consulStore) SaveAPI(ap *API) error {
 }
 
 func (s *consulStore) doPutAPI(ap *API, et EvtType) error {
-	key := fmt.Sprintf("%s/%s", s.apisDir, getAPIKey(ap.URL, ap.Method))
+	key := fmt.Sprintf("%s/%s", s.apisDir, ap.key())
 	_, err := s.client.KV().Put(&api.KVPair{
 		Key:   key,
 		Value: ap.Marshal(),
@@ -360,8 +383,8 @@ func (s *consulStore) UpdateAPI(api *API) error {
 	return s.doPutAPI(api, EventTypeUpdate)
 }
 
-func (s *consulStore) DeleteAPI(url string, method string) error {
-	key := fmt.Sprintf("%s/%s", s.apisDir, getAPIKey(url, method))
+func (s *consulStore) DeleteAPI(vhost, url, method string) error {
+	key := fmt.Sprintf("%s/%s", s.apisDir, getAPIKey(vhost, url, method))
 	_, err := s.client.KV().Delete(key, nil)
 	if err != nil {
 		return nil
@@ -388,8 +411,8 @@ func (s *consulStore) GetAPIs() ([]*API, error) {
 	return values, nil
 }
 
-func (s *consulStore) GetAPI(url string, method string) (*API, error) {
-	key := fmt.Sprintf("%s/%s", s.apisDir, getAPIKey(url, method))
+func (s *consulStore) GetAPI(vhost, url, method string) (*API, error) {
+	key := fmt.Sprintf("%s/%s", s.apisDir, getAPIKey(vhost, url, method))
 	pair, _, err := s.client.KV().Get(key, nil)
 
 	if nil != err {
@@ -403,6 +426,10 @@ func (s *consulStore) SaveRouting(routing *Routing) error {
 	return s.doPutRouting(routing, EventTypeNew)
 }
 
+func (s *consulStore) UpdateRouting(routing *Routing) error {
+	return s.doPutRouting(routing, EventTypeUpdate)
+}
+
 func (s *consulStore) doPutRouting(routing *Routing, et EvtType) error {
 	key := fmt.Sprintf("%s/%s", s.routingsDir, routing.ID)
 
@@ -411,11 +438,13 @@ func (s *consulStore) doPutRouting(routing *Routing, et EvtType) error {
 		Value: routing.Marshal(),
 	}, nil)
 
-	if err != nil {
-		return nil
-	}
+	return err
+}
 
-	return nil
+func (s *consulStore) DeleteRouting(id string) error {
+	key := fmt.Sprintf("%s/%s", s.routingsDir, id)
+	_, err := s.client.KV().Delete(key, nil)
+	return err
 }
 
 func (s *consulStore) GetRoutings() ([]*Routing, error) {
@@ -436,6 +465,339 @@ func (s *consulStore) GetRoutings() ([]*Routing, error) {
 	return values, nil
 }
 
+func (s *consulStore) GetRouting(id string) (*Routing, error) {
+	key := fmt.Sprintf("%s/%s", s.routingsDir, id)
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalRouting(pair.Value), nil
+}
+
+func (s *consulStore) SaveQuota(quota *Quota) error {
+	return s.UpdateQuota(quota)
+}
+
+func (s *consulStore) UpdateQuota(quota *Quota) error {
+	key := fmt.Sprintf("%s/%s", s.quotasDir, quota.Key())
+	_, err := s.client.KV().Put(&api.KVPair{
+		Key:   key,
+		Value: quota.Marshal(),
+	}, nil)
+
+	return err
+}
+
+func (s *consulStore) DeleteQuota(consumer, group string) error {
+	key := fmt.Sprintf("%s/%s", s.quotasDir, getQuotaKey(consumer, group))
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+func (s *consulStore) GetQuotas() ([]*Quota, error) {
+	pairs, _, err := s.client.KV().List(s.quotasDir, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	values := make([]*Quota, len(pairs))
+	i := 0
+
+	for _, pair := range pairs {
+		values[i] = UnMarshalQuota(pair.Value)
+		i++
+	}
+
+	return values, nil
+}
+
+func (s *consulStore) GetQuota(consumer, group string) (*Quota, error) {
+	key := fmt.Sprintf("%s/%s", s.quotasDir, getQuotaKey(consumer, group))
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalQuota(pair.Value), nil
+}
+
+func (s *consulStore) SaveConsumer(consumer *Consumer) error {
+	return s.UpdateConsumer(consumer)
+}
+
+func (s *consulStore) UpdateConsumer(consumer *Consumer) error {
+	key := fmt.Sprintf("%s/%s", s.consumersDir, consumer.ID)
+	_, err := s.client.KV().Put(&api.KVPair{
+		Key:   key,
+		Value: consumer.Marshal(),
+	}, nil)
+
+	return err
+}
+
+func (s *consulStore) DeleteConsumer(id string) error {
+	key := fmt.Sprintf("%s/%s", s.consumersDir, id)
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+func (s *consulStore) GetConsumers() ([]*Consumer, error) {
+	pairs, _, err := s.client.KV().List(s.consumersDir, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	values := make([]*Consumer, len(pairs))
+	i := 0
+
+	for _, pair := range pairs {
+		values[i] = UnMarshalConsumer(pair.Value)
+		i++
+	}
+
+	return values, nil
+}
+
+func (s *consulStore) GetConsumer(id string) (*Consumer, error) {
+	key := fmt.Sprintf("%s/%s", s.consumersDir, id)
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalConsumer(pair.Value), nil
+}
+
+func (s *consulStore) SaveJWTKeySet(keySet *JWTKeySet) error {
+	return s.UpdateJWTKeySet(keySet)
+}
+
+func (s *consulStore) UpdateJWTKeySet(keySet *JWTKeySet) error {
+	key := fmt.Sprintf("%s/%s", s.jwtKeySetsDir, keySet.ID)
+	_, err := s.client.KV().Put(&api.KVPair{
+		Key:   key,
+		Value: keySet.Marshal(),
+	}, nil)
+
+	return err
+}
+
+func (s *consulStore) DeleteJWTKeySet(id string) error {
+	key := fmt.Sprintf("%s/%s", s.jwtKeySetsDir, id)
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+func (s *consulStore) GetJWTKeySets() ([]*JWTKeySet, error) {
+	pairs, _, err := s.client.KV().List(s.jwtKeySetsDir, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	values := make([]*JWTKeySet, len(pairs))
+	i := 0
+
+	for _, pair := range pairs {
+		values[i] = UnMarshalJWTKeySet(pair.Value)
+		i++
+	}
+
+	return values, nil
+}
+
+func (s *consulStore) GetJWTKeySet(id string) (*JWTKeySet, error) {
+	key := fmt.Sprintf("%s/%s", s.jwtKeySetsDir, id)
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalJWTKeySet(pair.Value), nil
+}
+
+func (s *consulStore) SaveIPSet(ipSet *IPSet) error {
+	return s.UpdateIPSet(ipSet)
+}
+
+func (s *consulStore) UpdateIPSet(ipSet *IPSet) error {
+	key := fmt.Sprintf("%s/%s", s.ipSetsDir, ipSet.Name)
+	_, err := s.client.KV().Put(&api.KVPair{
+		Key:   key,
+		Value: ipSet.Marshal(),
+	}, nil)
+
+	return err
+}
+
+func (s *consulStore) DeleteIPSet(name string) error {
+	key := fmt.Sprintf("%s/%s", s.ipSetsDir, name)
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+func (s *consulStore) GetIPSets() ([]*IPSet, error) {
+	pairs, _, err := s.client.KV().List(s.ipSetsDir, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	values := make([]*IPSet, len(pairs))
+	i := 0
+
+	for _, pair := range pairs {
+		values[i] = UnMarshalIPSet(pair.Value)
+		i++
+	}
+
+	return values, nil
+}
+
+func (s *consulStore) GetIPSet(name string) (*IPSet, error) {
+	key := fmt.Sprintf("%s/%s", s.ipSetsDir, name)
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalIPSet(pair.Value), nil
+}
+
+func (s *consulStore) SaveBlockedIP(blockedIP *BlockedIP) error {
+	return s.UpdateBlockedIP(blockedIP)
+}
+
+func (s *consulStore) UpdateBlockedIP(blockedIP *BlockedIP) error {
+	key := fmt.Sprintf("%s/%s", s.blocklistDir, blockedIP.ID)
+	_, err := s.client.KV().Put(&api.KVPair{
+		Key:   key,
+		Value: blockedIP.Marshal(),
+	}, nil)
+
+	return err
+}
+
+func (s *consulStore) DeleteBlockedIP(id string) error {
+	key := fmt.Sprintf("%s/%s", s.blocklistDir, id)
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+func (s *consulStore) GetBlockedIPs() ([]*BlockedIP, error) {
+	pairs, _, err := s.client.KV().List(s.blocklistDir, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	values := make([]*BlockedIP, len(pairs))
+	i := 0
+
+	for _, pair := range pairs {
+		values[i] = UnMarshalBlockedIP(pair.Value)
+		i++
+	}
+
+	return values, nil
+}
+
+func (s *consulStore) GetBlockedIP(id string) (*BlockedIP, error) {
+	key := fmt.Sprintf("%s/%s", s.blocklistDir, id)
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalBlockedIP(pair.Value), nil
+}
+
+func (s *consulStore) SaveVHost(vhost *VHost) error {
+	return s.UpdateVHost(vhost)
+}
+
+func (s *consulStore) UpdateVHost(vhost *VHost) error {
+	key := fmt.Sprintf("%s/%s", s.vhostsDir, vhost.Name)
+	_, err := s.client.KV().Put(&api.KVPair{
+		Key:   key,
+		Value: vhost.Marshal(),
+	}, nil)
+
+	return err
+}
+
+func (s *consulStore) DeleteVHost(name string) error {
+	key := fmt.Sprintf("%s/%s", s.vhostsDir, name)
+	_, err := s.client.KV().Delete(key, nil)
+	return err
+}
+
+func (s *consulStore) GetVHosts() ([]*VHost, error) {
+	pairs, _, err := s.client.KV().List(s.vhostsDir, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	values := make([]*VHost, len(pairs))
+	i := 0
+
+	for _, pair := range pairs {
+		values[i] = UnMarshalVHost(pair.Value)
+		i++
+	}
+
+	return values, nil
+}
+
+func (s *consulStore) GetVHost(name string) (*VHost, error) {
+	key := fmt.Sprintf("%s/%s", s.vhostsDir, name)
+	pair, _, err := s.client.KV().Get(key, nil)
+
+	if nil != err {
+		return nil, err
+	}
+
+	if nil == pair {
+		return nil, nil
+	}
+
+	return UnMarshalVHost(pair.Value), nil
+}
+
 func (s *consulStore) watchPrefix(evtCh chan *Evt, src EvtSrc, prefix string, fn func([]byte, *Evt)) (*watch.Plan, error) {
 	watchPrefix := fmt.Sprintf("%s/", prefix)
 	plan, err := watch.Parse(makeParams(fmt.Sprintf(`{"type":"keyprefix", "prefix":"%s"}`, watchPrefix)))
@@ -514,6 +876,14 @@ func (s *consulStore) watchPrefix(evtCh chan *Evt, src EvtSrc, prefix string, fn
 func (s *consulStore) Watch(evtCh chan *Evt, stopCh chan bool) error {
 	var plans []*watch.Plan
 
+	// consul has no ttl for kv, the proxies delete the expired entries
+	s.startSweep(s.blocklistDir, func(value []byte, now time.Time) bool {
+		return UnMarshalBlockedIP(value).Expired(now)
+	})
+	s.startSweep(s.routingsDir, func(value []byte, now time.Time) bool {
+		return UnMarshalRouting(value).Expired(now)
+	})
+
 	p, err := s.watchPrefix(evtCh, EventSrcCluster, s.clustersDir, func(data []byte, e *Evt) {
 		if nil != data {
 			e.Value = UnMarshalCluster(data)
@@ -548,6 +918,54 @@ func (s *consulStore) Watch(evtCh chan *Evt, stopCh chan bool) error {
 	}
 	plans = append(plans, p)
 
+	p, err = s.watchPrefix(evtCh, EventSrcQuota, s.quotasDir, func(data []byte, e *Evt) {
+		e.Value = UnMarshalQuota(data)
+	})
+	if err != nil {
+		return err
+	}
+	plans = append(plans, p)
+
+	p, err = s.watchPrefix(evtCh, EventSrcConsumer, s.consumersDir, func(data []byte, e *Evt) {
+		e.Value = UnMarshalConsumer(data)
+	})
+	if err != nil {
+		return err
+	}
+	plans = append(plans, p)
+
+	p, err = s.watchPrefix(evtCh, EventSrcJWTKeySet, s.jwtKeySetsDir, func(data []byte, e *Evt) {
+		e.Value = UnMarshalJWTKeySet(data)
+	})
+	if err != nil {
+		return err
+	}
+	plans = append(plans, p)
+
+	p, err = s.watchPrefix(evtCh, EventSrcIPSet, s.ipSetsDir, func(data []byte, e *Evt) {
+		e.Value = UnMarshalIPSet(data)
+	})
+	if err != nil {
+		return err
+	}
+	plans = append(plans, p)
+
+	p, err = s.watchPrefix(evtCh, EventSrcBlockedIP, s.blocklistDir, func(data []byte, e *Evt) {
+		e.Value = UnMarshalBlockedIP(data)
+	})
+	if err != nil {
+		return err
+	}
+	plans = append(plans, p)
+
+	p, err = s.watchPrefix(evtCh, EventSrcVHost, s.vhostsDir, func(data []byte, e *Evt) {
+		e.Value = UnMarshalVHost(data)
+	})
+	if err != nil {
+		return err
+	}
+	plans = append(plans, p)
+
 	p, err = s.watchPrefix(evtCh, EventSrcBind, s.bindsDir, func(data []byte, e *Evt) {
 		e.Value = UnMarshalBind(data)
 	})
@@ -574,6 +992,47 @@ func (s *consulStore) Watch(evtCh chan *Evt, stopCh chan bool) error {
 	return nil
 }
 
+// startSweep delete the expired entries of the dir periodically
+func (s *consulStore) startSweep(dir string, expired func(value []byte, now time.Time) bool) {
+	timer := time.NewTicker(consulSweepInterval)
+
+	s.taskRunner.RunCancelableTask(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case now := <-timer.C:
+				s.sweep(dir, expired, now)
+			}
+		}
+	})
+}
+
+func (s *consulStore) sweep(dir string, expired func(value []byte, now time.Time) bool, now time.Time) {
+	pairs, _, err := s.client.KV().List(dir, nil)
+	if err != nil {
+		log.Warnf("store: list expired entries of <%s> failed, errors:\n%+v",
+			dir,
+			err)
+		return
+	}
+
+	for _, pair := range pairs {
+		if !expired(pair.Value, now) {
+			continue
+		}
+
+		// the entry changed by the others after listed is kept
+		_, _, err := s.client.KV().DeleteCAS(pair, nil)
+		if err != nil {
+			log.Warnf("store: delete expired entry <%s> failed, errors:\n%+v",
+				pair.Key,
+				err)
+		}
+	}
+}
+
 func (s *consulStore) Clean() error {
 	_, err := s.client.KV().DeleteTree(s.prefix, nil)
 	return err
@@ -75,15 +75,23 @@ func (t *slowLogTxn) Commit() (*clientv3.TxnResponse, error) {
 
 // EtcdStore etcd store impl
 type EtcdStore struct {
-	prefix      string
-	clustersDir string
-	serversDir  string
-	bindsDir    string
-	apisDir     string
-	proxiesDir  string
-	routingsDir string
+	prefix        string
+	clustersDir   string
+	serversDir    string
+	bindsDir      string
+	apisDir       string
+	proxiesDir    string
+	routingsDir   string
+	quotasDir     string
+	consumersDir  string
+	jwtKeySetsDir string
+	ipSetsDir     string
+	blocklistDir  string
+	vhostsDir     string
+	countersDir   string
 
 	cli                *clientv3.Client
+	counterLeases      *counterLeases
 	evtCh              chan *Evt
 	watchMethodMapping map[EvtSrc]func(EvtType, *mvccpb.KeyValue) *Evt
 
@@ -100,6 +108,14 @@ func NewEtcdStore(etcdAddrs []string, prefix string, taskRunner *task.Runner) (S
 		apisDir:            fmt.Sprintf("%s/apis", prefix),
 		proxiesDir:         fmt.Sprintf("%s/proxy", prefix),
 		routingsDir:        fmt.Sprintf("%s/routings", prefix),
+		quotasDir:          fmt.Sprintf("%s/quotas", prefix),
+		consumersDir:       fmt.Sprintf("%s/consumers", prefix),
+		jwtKeySetsDir:      fmt.Sprintf("%s/jwtkeysets", prefix),
+		ipSetsDir:          fmt.Sprintf("%s/ipsets", prefix),
+		blocklistDir:       fmt.Sprintf("%s/blocklist", prefix),
+		vhostsDir:          fmt.Sprintf("%s/vhosts", prefix),
+		countersDir:        fmt.Sprintf("%s-counters", prefix),
+		counterLeases:      &counterLeases{leases: make(map[int64]clientv3.LeaseID)},
 		watchMethodMapping: make(map[EvtSrc]func(EvtType, *mvccpb.KeyValue) *Evt),
 		taskRunner:         taskRunner,
 	}
@@ -130,13 +146,13 @@ func (e *EtcdStore) SaveAPI(api *API) error {
 
 // UpdateAPI update a api in store
 func (e *EtcdStore) UpdateAPI(api *API) error {
-	key := fmt.Sprintf("%s/%s", e.apisDir, getAPIKey(api.URL, api.Method))
+	key := fmt.Sprintf("%s/%s", e.apisDir, api.key())
 	return e.put(key, string(api.Marshal()))
 }
 
 // DeleteAPI delete a api from store
-func (e *EtcdStore) DeleteAPI(apiURL, method string) error {
-	key := fmt.Sprintf("%s/%s", e.apisDir, getAPIKey(apiURL, method))
+func (e *EtcdStore) DeleteAPI(vhost, apiURL, method string) error {
+	key := fmt.Sprintf("%s/%s", e.apisDir, getAPIKey(vhost, apiURL, method))
 	return e.delete(key)
 }
 
@@ -150,13 +166,16 @@ func (e *EtcdStore) GetAPIs() ([]*API, error) {
 	return values, err
 }
 
-// GetAPI return api by url from store
-func (e *EtcdStore) GetAPI(apiURL, method string) (*API, error) {
-	key := fmt.Sprintf("%s/%s", e.apisDir, getAPIKey(apiURL, method))
+// GetAPI return api by vhost, url and method from store
+func (e *EtcdStore) GetAPI(vhost, apiURL, method string) (*API, error) {
+	key := fmt.Sprintf("%s/%s", e.apisDir, getAPIKey(vhost, apiURL, method))
 
 	var value *API
 	err := e.getList(key, func(item *mvccpb.KeyValue) {
-		value = UnMarshalAPI(item.Value)
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalAPI(item.Value)
+		}
 	})
 
 	return value, err
@@ -346,7 +365,23 @@ func (e *EtcdStore) GetBinds() ([]*Bind, error) {
 // SaveRouting save route to store
 func (e *EtcdStore) SaveRouting(routing *Routing) error {
 	key := fmt.Sprintf("%s/%s", e.routingsDir, routing.ID)
-	return e.putTTL(key, string(routing.Marshal()), int64(routing.deadline))
+	ttl := routing.ttl(time.Now())
+	if ttl <= 0 {
+		return e.put(key, string(routing.Marshal()))
+	}
+
+	return e.putTTL(key, string(routing.Marshal()), ttl)
+}
+
+// UpdateRouting update a routing in store, the ttl is the time left before the deadline
+func (e *EtcdStore) UpdateRouting(routing *Routing) error {
+	return e.SaveRouting(routing)
+}
+
+// DeleteRouting delete a routing from store
+func (e *EtcdStore) DeleteRouting(id string) error {
+	key := fmt.Sprintf("%s/%s", e.routingsDir, id)
+	return e.delete(key)
 }
 
 // GetRoutings return routes in store
@@ -359,6 +394,282 @@ func (e *EtcdStore) GetRoutings() ([]*Routing, error) {
 	return values, err
 }
 
+// GetRouting return routing in store
+func (e *EtcdStore) GetRouting(id string) (*Routing, error) {
+	key := fmt.Sprintf("%s/%s", e.routingsDir, id)
+
+	var value *Routing
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalRouting(item.Value)
+		}
+	})
+
+	return value, err
+}
+
+// SaveQuota save a quota to store
+func (e *EtcdStore) SaveQuota(quota *Quota) error {
+	return e.UpdateQuota(quota)
+}
+
+// UpdateQuota update a quota in store
+func (e *EtcdStore) UpdateQuota(quota *Quota) error {
+	key := fmt.Sprintf("%s/%s", e.quotasDir, quota.Key())
+	return e.put(key, string(quota.Marshal()))
+}
+
+// DeleteQuota delete a quota from store
+func (e *EtcdStore) DeleteQuota(consumer, group string) error {
+	key := fmt.Sprintf("%s/%s", e.quotasDir, getQuotaKey(consumer, group))
+	return e.delete(key)
+}
+
+// GetQuotas return quotas in store
+func (e *EtcdStore) GetQuotas() ([]*Quota, error) {
+	var values []*Quota
+	err := e.getList(e.quotasDir, func(item *mvccpb.KeyValue) {
+		values = append(values, UnMarshalQuota(item.Value))
+	})
+
+	return values, err
+}
+
+// GetQuota return quota of the consumer and group
+func (e *EtcdStore) GetQuota(consumer, group string) (*Quota, error) {
+	key := fmt.Sprintf("%s/%s", e.quotasDir, getQuotaKey(consumer, group))
+
+	var value *Quota
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalQuota(item.Value)
+		}
+	})
+
+	return value, err
+}
+
+// SaveConsumer save a consumer to store
+func (e *EtcdStore) SaveConsumer(consumer *Consumer) error {
+	return e.UpdateConsumer(consumer)
+}
+
+// UpdateConsumer update a consumer in store
+func (e *EtcdStore) UpdateConsumer(consumer *Consumer) error {
+	key := fmt.Sprintf("%s/%s", e.consumersDir, consumer.ID)
+	return e.put(key, string(consumer.Marshal()))
+}
+
+// DeleteConsumer delete a consumer from store
+func (e *EtcdStore) DeleteConsumer(id string) error {
+	key := fmt.Sprintf("%s/%s", e.consumersDir, id)
+	return e.delete(key)
+}
+
+// GetConsumers return consumers in store
+func (e *EtcdStore) GetConsumers() ([]*Consumer, error) {
+	var values []*Consumer
+	err := e.getList(e.consumersDir, func(item *mvccpb.KeyValue) {
+		values = append(values, UnMarshalConsumer(item.Value))
+	})
+
+	return values, err
+}
+
+// GetConsumer return consumer in store
+func (e *EtcdStore) GetConsumer(id string) (*Consumer, error) {
+	key := fmt.Sprintf("%s/%s", e.consumersDir, id)
+
+	var value *Consumer
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalConsumer(item.Value)
+		}
+	})
+
+	return value, err
+}
+
+// SaveJWTKeySet save a jwt key set to store
+func (e *EtcdStore) SaveJWTKeySet(keySet *JWTKeySet) error {
+	return e.UpdateJWTKeySet(keySet)
+}
+
+// UpdateJWTKeySet update a jwt key set in store
+func (e *EtcdStore) UpdateJWTKeySet(keySet *JWTKeySet) error {
+	key := fmt.Sprintf("%s/%s", e.jwtKeySetsDir, keySet.ID)
+	return e.put(key, string(keySet.Marshal()))
+}
+
+// DeleteJWTKeySet delete a jwt key set from store
+func (e *EtcdStore) DeleteJWTKeySet(id string) error {
+	key := fmt.Sprintf("%s/%s", e.jwtKeySetsDir, id)
+	return e.delete(key)
+}
+
+// GetJWTKeySets return jwt key sets in store
+func (e *EtcdStore) GetJWTKeySets() ([]*JWTKeySet, error) {
+	var values []*JWTKeySet
+	err := e.getList(e.jwtKeySetsDir, func(item *mvccpb.KeyValue) {
+		values = append(values, UnMarshalJWTKeySet(item.Value))
+	})
+
+	return values, err
+}
+
+// GetJWTKeySet return jwt key set in store
+func (e *EtcdStore) GetJWTKeySet(id string) (*JWTKeySet, error) {
+	key := fmt.Sprintf("%s/%s", e.jwtKeySetsDir, id)
+
+	var value *JWTKeySet
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalJWTKeySet(item.Value)
+		}
+	})
+
+	return value, err
+}
+
+// SaveIPSet save a ip set to store
+func (e *EtcdStore) SaveIPSet(ipSet *IPSet) error {
+	return e.UpdateIPSet(ipSet)
+}
+
+// UpdateIPSet update a ip set in store
+func (e *EtcdStore) UpdateIPSet(ipSet *IPSet) error {
+	key := fmt.Sprintf("%s/%s", e.ipSetsDir, ipSet.Name)
+	return e.put(key, string(ipSet.Marshal()))
+}
+
+// DeleteIPSet delete a ip set from store
+func (e *EtcdStore) DeleteIPSet(name string) error {
+	key := fmt.Sprintf("%s/%s", e.ipSetsDir, name)
+	return e.delete(key)
+}
+
+// GetIPSets return ip sets in store
+func (e *EtcdStore) GetIPSets() ([]*IPSet, error) {
+	var values []*IPSet
+	err := e.getList(e.ipSetsDir, func(item *mvccpb.KeyValue) {
+		values = append(values, UnMarshalIPSet(item.Value))
+	})
+
+	return values, err
+}
+
+// GetIPSet return ip set in store
+func (e *EtcdStore) GetIPSet(name string) (*IPSet, error) {
+	key := fmt.Sprintf("%s/%s", e.ipSetsDir, name)
+
+	var value *IPSet
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalIPSet(item.Value)
+		}
+	})
+
+	return value, err
+}
+
+// SaveBlockedIP save a blocked ip to store
+func (e *EtcdStore) SaveBlockedIP(blockedIP *BlockedIP) error {
+	return e.UpdateBlockedIP(blockedIP)
+}
+
+// UpdateBlockedIP update a blocked ip in store, the ttl is the time left before it expired
+func (e *EtcdStore) UpdateBlockedIP(blockedIP *BlockedIP) error {
+	key := fmt.Sprintf("%s/%s", e.blocklistDir, blockedIP.ID)
+	if blockedIP.ExpireAt <= 0 {
+		return e.put(key, string(blockedIP.Marshal()))
+	}
+
+	ttl := blockedIP.ExpireAt - time.Now().Unix()
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return e.putTTL(key, string(blockedIP.Marshal()), ttl)
+}
+
+// DeleteBlockedIP delete a blocked ip from store
+func (e *EtcdStore) DeleteBlockedIP(id string) error {
+	key := fmt.Sprintf("%s/%s", e.blocklistDir, id)
+	return e.delete(key)
+}
+
+// GetBlockedIPs return blocked ips in store
+func (e *EtcdStore) GetBlockedIPs() ([]*BlockedIP, error) {
+	var values []*BlockedIP
+	err := e.getList(e.blocklistDir, func(item *mvccpb.KeyValue) {
+		values = append(values, UnMarshalBlockedIP(item.Value))
+	})
+
+	return values, err
+}
+
+// GetBlockedIP return blocked ip in store
+func (e *EtcdStore) GetBlockedIP(id string) (*BlockedIP, error) {
+	key := fmt.Sprintf("%s/%s", e.blocklistDir, id)
+
+	var value *BlockedIP
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalBlockedIP(item.Value)
+		}
+	})
+
+	return value, err
+}
+
+// SaveVHost save a virtual host to store
+func (e *EtcdStore) SaveVHost(vhost *VHost) error {
+	return e.UpdateVHost(vhost)
+}
+
+// UpdateVHost update a virtual host in store
+func (e *EtcdStore) UpdateVHost(vhost *VHost) error {
+	key := fmt.Sprintf("%s/%s", e.vhostsDir, vhost.Name)
+	return e.put(key, string(vhost.Marshal()))
+}
+
+// DeleteVHost delete a virtual host from store
+func (e *EtcdStore) DeleteVHost(name string) error {
+	key := fmt.Sprintf("%s/%s", e.vhostsDir, name)
+	return e.delete(key)
+}
+
+// GetVHosts return virtual hosts in store
+func (e *EtcdStore) GetVHosts() ([]*VHost, error) {
+	var values []*VHost
+	err := e.getList(e.vhostsDir, func(item *mvccpb.KeyValue) {
+		values = append(values, UnMarshalVHost(item.Value))
+	})
+
+	return values, err
+}
+
+// GetVHost return virtual host in store
+func (e *EtcdStore) GetVHost(name string) (*VHost, error) {
+	key := fmt.Sprintf("%s/%s", e.vhostsDir, name)
+
+	var value *VHost
+	err := e.getList(key, func(item *mvccpb.KeyValue) {
+		// get with prefix, skip the keys with the same prefix
+		if string(item.Key) == key {
+			value = UnMarshalVHost(item.Value)
+		}
+	})
+
+	return value, err
+}
+
 // Clean clean data in store
 func (e *EtcdStore) Clean() error {
 	_, err := e.txn().Then(clientv3.OpDelete(e.prefix, clientv3.WithPrefix())).Commit()
@@ -369,7 +680,7 @@ func (e *EtcdStore) Clean() error {
 func (e *EtcdStore) Watch(evtCh chan *Evt, stopCh chan bool) error {
 	e.evtCh = evtCh
 
-	log.Infof("meta: etcd watch at: <%s>",
+	log.Infof("meta: etcd watch at: <%s/>",
 		e.prefix)
 
 	e.doWatch()
@@ -383,7 +694,8 @@ func (e EtcdStore) doWatch() {
 
 	ctx := e.cli.Ctx()
 	for {
-		rch := watcher.Watch(ctx, e.prefix, clientv3.WithPrefix())
+		// the counters are read on demand, they are not under the watched prefix
+		rch := watcher.Watch(ctx, e.prefix+"/", clientv3.WithPrefix())
 		for wresp := range rch {
 			if wresp.Canceled {
 				return
@@ -415,6 +727,18 @@ func (e EtcdStore) doWatch() {
 					evtSrc = EventSrcAPI
 				} else if strings.HasPrefix(key, e.routingsDir) {
 					evtSrc = EventSrcRouting
+				} else if strings.HasPrefix(key, e.quotasDir) {
+					evtSrc = EventSrcQuota
+				} else if strings.HasPrefix(key, e.consumersDir) {
+					evtSrc = EventSrcConsumer
+				} else if strings.HasPrefix(key, e.jwtKeySetsDir) {
+					evtSrc = EventSrcJWTKeySet
+				} else if strings.HasPrefix(key, e.ipSetsDir) {
+					evtSrc = EventSrcIPSet
+				} else if strings.HasPrefix(key, e.blocklistDir) {
+					evtSrc = EventSrcBlockedIP
+				} else if strings.HasPrefix(key, e.vhostsDir) {
+					evtSrc = EventSrcVHost
 				} else {
 					continue
 				}
@@ -495,12 +819,84 @@ func (e *EtcdStore) doWatchWithRouting(evtType EvtType, kv *mvccpb.KeyValue) *Ev
 	}
 }
 
+func (e *EtcdStore) doWatchWithQuota(evtType EvtType, kv *mvccpb.KeyValue) *Evt {
+	quota := UnMarshalQuota([]byte(kv.Value))
+
+	return &Evt{
+		Src:   EventSrcQuota,
+		Type:  evtType,
+		Key:   strings.Replace(string(kv.Key), fmt.Sprintf("%s/", e.quotasDir), "", 1),
+		Value: quota,
+	}
+}
+
+func (e *EtcdStore) doWatchWithConsumer(evtType EvtType, kv *mvccpb.KeyValue) *Evt {
+	consumer := UnMarshalConsumer([]byte(kv.Value))
+
+	return &Evt{
+		Src:   EventSrcConsumer,
+		Type:  evtType,
+		Key:   strings.Replace(string(kv.Key), fmt.Sprintf("%s/", e.consumersDir), "", 1),
+		Value: consumer,
+	}
+}
+
+func (e *EtcdStore) doWatchWithJWTKeySet(evtType EvtType, kv *mvccpb.KeyValue) *Evt {
+	keySet := UnMarshalJWTKeySet([]byte(kv.Value))
+
+	return &Evt{
+		Src:   EventSrcJWTKeySet,
+		Type:  evtType,
+		Key:   strings.Replace(string(kv.Key), fmt.Sprintf("%s/", e.jwtKeySetsDir), "", 1),
+		Value: keySet,
+	}
+}
+
+func (e *EtcdStore) doWatchWithIPSet(evtType EvtType, kv *mvccpb.KeyValue) *Evt {
+	ipSet := UnMarshalIPSet([]byte(kv.Value))
+
+	return &Evt{
+		Src:   EventSrcIPSet,
+		Type:  evtType,
+		Key:   strings.Replace(string(kv.Key), fmt.Sprintf("%s/", e.ipSetsDir), "", 1),
+		Value: ipSet,
+	}
+}
+
+func (e *EtcdStore) doWatchWithBlockedIP(evtType EvtType, kv *mvccpb.KeyValue) *Evt {
+	blockedIP := UnMarshalBlockedIP([]byte(kv.Value))
+
+	return &Evt{
+		Src:   EventSrcBlockedIP,
+		Type:  evtType,
+		Key:   strings.Replace(string(kv.Key), fmt.Sprintf("%s/", e.blocklistDir), "", 1),
+		Value: blockedIP,
+	}
+}
+
+func (e *EtcdStore) doWatchWithVHost(evtType EvtType, kv *mvccpb.KeyValue) *Evt {
+	vhost := UnMarshalVHost([]byte(kv.Value))
+
+	return &Evt{
+		Src:   EventSrcVHost,
+		Type:  evtType,
+		Key:   strings.Replace(string(kv.Key), fmt.Sprintf("%s/", e.vhostsDir), "", 1),
+		Value: vhost,
+	}
+}
+
 func (e *EtcdStore) init() {
 	e.watchMethodMapping[EventSrcBind] = e.doWatchWithBind
 	e.watchMethodMapping[EventSrcServer] = e.doWatchWithServer
 	e.watchMethodMapping[EventSrcCluster] = e.doWatchWithCluster
 	e.watchMethodMapping[EventSrcAPI] = e.doWatchWithAPI
 	e.watchMethodMapping[EventSrcRouting] = e.doWatchWithRouting
+	e.watchMethodMapping[EventSrcQuota] = e.doWatchWithQuota
+	e.watchMethodMapping[EventSrcConsumer] = e.doWatchWithConsumer
+	e.watchMethodMapping[EventSrcJWTKeySet] = e.doWatchWithJWTKeySet
+	e.watchMethodMapping[EventSrcIPSet] = e.doWatchWithIPSet
+	e.watchMethodMapping[EventSrcBlockedIP] = e.doWatchWithBlockedIP
+	e.watchMethodMapping[EventSrcVHost] = e.doWatchWithVHost
 }
 
 func (e *EtcdStore) put(key, value string) error {
@@ -509,6 +905,16 @@ func (e *EtcdStore) put(key, value string) error {
 }
 
 func (e *EtcdStore) putTTL(key, value string, ttl int64) error {
+	leaseID, err := e.grant(ttl)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.txn().Then(clientv3.OpPut(key, value, clientv3.WithLease(leaseID))).Commit()
+	return err
+}
+
+func (e *EtcdStore) grant(ttl int64) (clientv3.LeaseID, error) {
 	lessor := clientv3.NewLease(e.cli)
 	defer lessor.Close()
 
@@ -517,11 +923,10 @@ func (e *EtcdStore) putTTL(key, value string, ttl int64) error {
 	cancel()
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = e.txn().Then(clientv3.OpPut(key, value, clientv3.WithLease(leaseResp.ID))).Commit()
-	return err
+	return leaseResp.ID, nil
 }
 
 func (e *EtcdStore) delete(key string) error {
@@ -545,21 +950,12 @@ func (e *EtcdStore) getList(key string, fn func(*mvccpb.KeyValue)) error {
 	return nil
 }
 
-func getAPIKey(apiURL, method string) string {
+// getAPIKey the key of the api without vhost is not changed, for compatibility
+func getAPIKey(vhost, apiURL, method string) string {
 	key := fmt.Sprintf("%s-%s", apiURL, method)
-	return base64.RawURLEncoding.EncodeToString([]byte(key))
-}
-
-func parseAPIKey(key string) (url string, method string) {
-	raw := decodeAPIKey(key)
-	splits := strings.SplitN(raw, "-", 2)
-	url = splits[0]
-	method = splits[1]
-
-	return url, method
-}
+	if vhost != "" {
+		key = fmt.Sprintf("%s@%s", key, vhost)
+	}
 
-func decodeAPIKey(key string) string {
-	raw, _ := base64.RawURLEncoding.DecodeString(key)
-	return string(raw)
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
 }
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/fagongzi/log"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	wildcardDomainPrefix = "*."
+)
+
+// VHost a virtual host, a group of domains owning a set of apis.
+// The apis without vhost belong to the default vhost, it serves the requests whose host matches no vhost.
+type VHost struct {
+	// Name the apis reference the vhost by name
+	Name string `json:"name"`
+	// Domains exact domains like api.example.com or wildcard domains like *.example.com,
+	// a wildcard domain matches any subdomain, but not the domain itself
+	Domains []string `json:"domains"`
+	Desc    string   `json:"desc,omitempty"`
+}
+
+// UnMarshalVHost unmarshal
+func UnMarshalVHost(data []byte) *VHost {
+	v := &VHost{}
+	json.Unmarshal(data, v)
+
+	return v
+}
+
+// UnMarshalVHostFromReader unmarshal from reader
+func UnMarshalVHostFromReader(r io.Reader) (*VHost, error) {
+	v := &VHost{}
+
+	decoder := json.NewDecoder(r)
+	err := decoder.Decode(v)
+
+	return v, err
+}
+
+// Marshal marshal
+func (h *VHost) Marshal() []byte {
+	v, _ := json.Marshal(h)
+	return v
+}
+
+// Check check config
+func (h *VHost) Check() error {
+	if h.Name == "" {
+		return fmt.Errorf("missing vhost name")
+	}
+
+	err := checkVHostName(h.Name)
+	if err != nil {
+		return err
+	}
+
+	if len(h.Domains) == 0 {
+		return fmt.Errorf("missing vhost domains")
+	}
+
+	for _, domain := range h.Domains {
+		value := strings.TrimPrefix(domain, wildcardDomainPrefix)
+		if value == "" || strings.ContainsAny(value, "*/:") {
+			return fmt.Errorf("invalid vhost domain: %s", domain)
+		}
+	}
+
+	return nil
+}
+
+// checkVHostName the name is a part of the keys of the apis, like /users-GET@shop
+func checkVHostName(name string) error {
+	if strings.ContainsAny(name, "@/") {
+		return fmt.Errorf("invalid vhost name: %s, '@' and '/' are not allowed", name)
+	}
+
+	return nil
+}
+
+// hostRouter select the vhost by the request host, then select the api of the vhost by the path and method
+type hostRouter struct {
+	exact     map[string]*apiRouter
+	wildcards []*wildcardRouter // longest suffix first
+	defaults  *apiRouter
+}
+
+type wildcardRouter struct {
+	suffix string // like .example.com
+	router *apiRouter
+}
+
+func newHostRouter(vhosts map[string]*VHost, apis map[string]*API) *hostRouter {
+	grouped := make(map[string]map[string]*API)
+	for key, api := range apis {
+		if _, ok := grouped[api.VHost]; !ok {
+			grouped[api.VHost] = make(map[string]*API)
+		}
+		grouped[api.VHost][key] = api
+	}
+
+	r := &hostRouter{
+		exact:    make(map[string]*apiRouter),
+		defaults: newAPIRouter(grouped[""]),
+	}
+
+	// sort the vhosts, so the conflict domains are resolved in the same way on all the proxies
+	names := make([]string, 0, len(vhosts))
+	for name := range vhosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		router := newAPIRouter(grouped[name])
+
+		for _, domain := range vhosts[name].Domains {
+			domain = strings.ToLower(domain)
+
+			if strings.HasPrefix(domain, wildcardDomainPrefix) {
+				r.wildcards = append(r.wildcards, &wildcardRouter{
+					suffix: domain[1:],
+					router: router,
+				})
+				continue
+			}
+
+			if _, ok := r.exact[domain]; ok {
+				log.Warnf("meta: domain <%s> of vhost <%s> is used by another vhost, ignored",
+					domain,
+					name)
+				continue
+			}
+			r.exact[domain] = router
+		}
+	}
+
+	sort.SliceStable(r.wildcards, func(i, j int) bool {
+		return len(r.wildcards[i].suffix) > len(r.wildcards[j].suffix)
+	})
+
+	return r
+}
+
+// find returns the api matches the request host, path and method and the path params of the api,
+// returns nil if no api matches
+func (r *hostRouter) find(req *fasthttp.Request, method string) (*API, PathParams) {
+	return r.route(req.Host()).find(req, method)
+}
+
+func (r *hostRouter) route(host []byte) *apiRouter {
+	domain := strings.ToLower(string(host))
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		domain = h
+	}
+
+	if router, ok := r.exact[domain]; ok {
+		return router
+	}
+
+	for _, w := range r.wildcards {
+		if strings.HasSuffix(domain, w.suffix) {
+			return w.router
+		}
+	}
+
+	return r.defaults
+}
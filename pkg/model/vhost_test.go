@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestMatchesVHost(t *testing.T) {
+	vhosts := map[string]*VHost{
+		"shop": &VHost{Name: "shop", Domains: []string{"shop.example.com", "*.shop.example.com"}},
+		"all":  &VHost{Name: "all", Domains: []string{"*.example.com"}},
+	}
+
+	apis := make(map[string]*API)
+	for _, api := range []*API{
+		newRouterTestAPI("/users/{id}", "GET"),
+		newRouterTestAPI("/items/{id}", "GET"),
+		newRouterTestAPI("/", "GET"),
+	} {
+		apis[api.key()] = api
+	}
+
+	shop := newRouterTestAPI("/items/{id}", "GET")
+	shop.VHost = "shop"
+	apis[shop.key()] = shop
+
+	all := newRouterTestAPI("/users/{id}", "GET")
+	all.VHost = "all"
+	apis[all.key()] = all
+
+	router := newHostRouter(vhosts, apis)
+
+	cases := []struct {
+		host  string
+		uri   string
+		vhost string
+		found bool
+	}{
+		{"shop.example.com", "/items/1", "shop", true},
+		{"SHOP.example.com:8080", "/items/1", "shop", true},
+		{"a.shop.example.com", "/items/1", "shop", true},
+		{"shop.example.com", "/users/1", "", false},
+		{"a.example.com", "/users/1", "all", true},
+		{"example.com", "/users/1", "", true},
+		{"127.0.0.1:8080", "/items/1", "", true},
+	}
+
+	for _, c := range cases {
+		req := &fasthttp.Request{}
+		req.SetRequestURI(c.uri)
+		req.SetHost(c.host)
+
+		api, _ := router.find(req, "GET")
+		if !c.found {
+			if nil != api {
+				t.Errorf("<%s%s> expect no api, but <%+v>", c.host, c.uri, api)
+			}
+			continue
+		}
+
+		if nil == api || api.VHost != c.vhost {
+			t.Errorf("<%s%s> expect vhost <%s>, but <%+v>", c.host, c.uri, c.vhost, api)
+		}
+	}
+}
+
+func TestParseVHost(t *testing.T) {
+	for _, vhost := range []*VHost{
+		&VHost{Name: "a"},
+		&VHost{Domains: []string{"a.com"}},
+		&VHost{Name: "a", Domains: []string{"*"}},
+		&VHost{Name: "a", Domains: []string{"a.*.com"}},
+		&VHost{Name: "a", Domains: []string{"a.com:80"}},
+	} {
+		if vhost.Check() == nil {
+			t.Errorf("<%+v> expect error", vhost)
+		}
+	}
+}
+
+func TestVHostCheck(t *testing.T) {
+	cases := []struct {
+		vhost *VHost
+		ok    bool
+	}{
+		{&VHost{Name: "shop", Domains: []string{"shop.example.com", "*.shop.example.com"}}, true},
+		{&VHost{Name: "shop@a", Domains: []string{"shop.example.com"}}, false},
+		{&VHost{Name: "shop/a", Domains: []string{"shop.example.com"}}, false},
+		{&VHost{Name: "shop"}, false},
+		{&VHost{Name: "shop", Domains: []string{"*"}}, false},
+	}
+
+	for _, c := range cases {
+		if err := c.vhost.Check(); (err == nil) != c.ok {
+			t.Errorf("%+v: expect ok %v, but %+v", c.vhost, c.ok, err)
+		}
+	}
+
+	if err := (&API{VHost: "shop@a"}).Check(); err == nil {
+		t.Error("expect check error of the invalid vhost name of the api")
+	}
+}
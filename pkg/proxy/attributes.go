@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// attributes the attributes of a request, they are shared by all the filters and all the nodes of the request
+type attributes struct {
+	sync.RWMutex
+	values map[string]interface{}
+}
+
+func newAttributes() *attributes {
+	return &attributes{
+		values: make(map[string]interface{}),
+	}
+}
+
+func (attrs *attributes) set(key string, value interface{}) {
+	attrs.Lock()
+	if nil == value {
+		delete(attrs.values, key)
+	} else {
+		attrs.values[key] = value
+	}
+	attrs.Unlock()
+}
+
+func (attrs *attributes) get(key string) (interface{}, bool) {
+	attrs.RLock()
+	value, ok := attrs.values[key]
+	attrs.RUnlock()
+
+	return value, ok
+}
+
+func (attrs *attributes) copy() map[string]interface{} {
+	attrs.RLock()
+	values := make(map[string]interface{}, len(attrs.values))
+	for key, value := range attrs.values {
+		values[key] = value
+	}
+	attrs.RUnlock()
+
+	return values
+}
+
+func (attrs *attributes) getString(key string) string {
+	value, ok := attrs.get(key)
+	if !ok {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+func (attrs *attributes) getInt(key string) int {
+	value, ok := attrs.get(key)
+	if !ok {
+		return 0
+	}
+
+	switch v := value.(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		i, _ := strconv.Atoi(v)
+		return i
+	}
+
+	return 0
+}
+
+func (attrs *attributes) getBool(key string) bool {
+	value, ok := attrs.get(key)
+	if !ok {
+		return false
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	}
+
+	return false
+}
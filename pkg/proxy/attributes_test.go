@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func TestAttributesGetters(t *testing.T) {
+	attrs := newAttributes()
+	attrs.set("string", "abc")
+	attrs.set("bytes", []byte("abc"))
+	attrs.set("int", 10)
+	attrs.set("int64", int64(10))
+	attrs.set("float", float64(10))
+	attrs.set("intString", "10")
+	attrs.set("bool", true)
+	attrs.set("boolString", "true")
+	attrs.set("slice", []string{"a", "b"})
+
+	stringCases := map[string]string{
+		"string":  "abc",
+		"bytes":   "abc",
+		"int":     "10",
+		"bool":    "true",
+		"slice":   "[a b]",
+		"missing": "",
+	}
+	for key, expect := range stringCases {
+		if value := attrs.getString(key); value != expect {
+			t.Errorf("%s: expect string <%s>, but <%s>", key, expect, value)
+		}
+	}
+
+	intCases := map[string]int{
+		"int":       10,
+		"int64":     10,
+		"float":     10,
+		"intString": 10,
+		"string":    0,
+		"bool":      0,
+		"missing":   0,
+	}
+	for key, expect := range intCases {
+		if value := attrs.getInt(key); value != expect {
+			t.Errorf("%s: expect int %d, but %d", key, expect, value)
+		}
+	}
+
+	boolCases := map[string]bool{
+		"bool":       true,
+		"boolString": true,
+		"string":     false,
+		"int":        false,
+		"missing":    false,
+	}
+	for key, expect := range boolCases {
+		if value := attrs.getBool(key); value != expect {
+			t.Errorf("%s: expect bool %v, but %v", key, expect, value)
+		}
+	}
+}
+
+func TestAttributesSetAndCopy(t *testing.T) {
+	attrs := newAttributes()
+	attrs.set("a", 1)
+	attrs.set("b", 2)
+
+	values := attrs.copy()
+	values["c"] = 3
+	if _, ok := attrs.get("c"); ok {
+		t.Errorf("expect the copy not changes the attributes")
+	}
+
+	attrs.set("a", nil)
+	if _, ok := attrs.get("a"); ok {
+		t.Errorf("expect the nil value removes the attribute")
+	}
+
+	if len(attrs.copy()) != 1 {
+		t.Errorf("expect 1 attribute, but %+v", attrs.copy())
+	}
+}
+
+func TestPublishRouteResults(t *testing.T) {
+	api := &model.API{URL: "/users"}
+	c := &requestContext{attrs: newAttributes(), api: api}
+	c.publishRouteResults([]*model.RouteResult{
+		{API: api, Node: &model.Node{ClusterName: "c1"}, Svr: &model.Server{Addr: "127.0.0.1:8080"}},
+		{API: api, Node: &model.Node{ClusterName: "c2"}},
+	})
+
+	if value := c.GetStringAttr(filter.AttrAPI); value != "/users" {
+		t.Errorf("expect api </users>, but <%s>", value)
+	}
+
+	if value := c.GetStringAttr(filter.AttrClusters); value != "[c1 c2]" {
+		t.Errorf("expect clusters [c1 c2], but %s", value)
+	}
+
+	if value := c.GetStringAttr(filter.AttrServers); value != "[127.0.0.1:8080 ]" {
+		t.Errorf("expect servers [127.0.0.1:8080 ], but %s", value)
+	}
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/fagongzi/log"
+	"github.com/fagongzi/util/task"
+)
+
+const (
+	// maxPendingBans the max bans waiting to be saved to the store
+	maxPendingBans = 1024
+)
+
+// autoBanner count the error responses of every client ip in a fixed window,
+// ban the ip if the count exceeds the threshold. The counts are local to the proxy,
+// but the bans are shared by all proxies through the global blocklist.
+// The bans take effect on this proxy at once, they are saved to the store in background.
+type autoBanner struct {
+	sync.Mutex
+
+	cnf      *conf.AutoBan
+	rt       *model.RouteTable
+	window   time.Duration
+	duration time.Duration
+	statuses map[int]bool
+	counters map[string]*banCounter
+	bans     chan *model.BlockedIP // waiting to be saved to the store
+}
+
+type banCounter struct {
+	resetAt time.Time
+	count   int
+}
+
+func newAutoBanner(cnf *conf.AutoBan, rt *model.RouteTable, taskRunner *task.Runner) (*autoBanner, error) {
+	if cnf.Threshold <= 0 || cnf.Window <= 0 || cnf.Duration <= 0 {
+		return nil, fmt.Errorf("auto ban threshold, window and duration must be positive: %+v", cnf)
+	}
+
+	b := &autoBanner{
+		cnf:      cnf,
+		rt:       rt,
+		window:   time.Duration(cnf.Window) * time.Second,
+		duration: time.Duration(cnf.Duration) * time.Second,
+		statuses: make(map[int]bool),
+		counters: make(map[string]*banCounter),
+		bans:     make(chan *model.BlockedIP, maxPendingBans),
+	}
+
+	for _, status := range cnf.Statuses {
+		b.statuses[status] = true
+	}
+
+	timer := time.NewTicker(b.window)
+	taskRunner.RunCancelableTask(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+				b.clean(time.Now())
+			}
+		}
+	})
+
+	taskRunner.RunCancelableTask(func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case blockedIP := <-b.bans:
+				b.save(blockedIP)
+			}
+		}
+	})
+
+	return b, nil
+}
+
+func (b *autoBanner) matches(status int) bool {
+	if len(b.statuses) == 0 {
+		return status >= 400 && status < 500
+	}
+
+	return b.statuses[status]
+}
+
+// record count the response, ban the ip if the count exceeds the threshold
+func (b *autoBanner) record(ip string, status int) {
+	if !b.matches(status) {
+		return
+	}
+
+	now := time.Now()
+
+	b.Lock()
+	c, ok := b.counters[ip]
+	if !ok || !now.Before(c.resetAt) {
+		c = &banCounter{
+			resetAt: now.Add(b.window),
+		}
+		b.counters[ip] = c
+	}
+
+	c.count++
+	exceeded := c.count > b.cnf.Threshold
+	if exceeded {
+		delete(b.counters, ip)
+	}
+	b.Unlock()
+
+	if !exceeded {
+		return
+	}
+
+	log.Warnf("proxy: client <%s> banned for <%s>, error responses exceeds <%d> in <%s>",
+		ip,
+		b.duration,
+		b.cnf.Threshold,
+		b.window)
+
+	blockedIP, err := b.rt.BanIP(ip, fmt.Sprintf("more than %d error responses in %s", b.cnf.Threshold, b.window), b.duration)
+	if err != nil {
+		log.Errorf("proxy: ban client <%s> failed, errors:\n%+v",
+			ip,
+			err)
+		return
+	}
+
+	select {
+	case b.bans <- blockedIP:
+	default:
+		log.Warnf("proxy: too many bans waiting to be saved, ban of client <%s> only takes effect on this proxy",
+			ip)
+	}
+}
+
+// save save the ban to the store, so all the proxies receive it
+func (b *autoBanner) save(blockedIP *model.BlockedIP) {
+	err := b.rt.SaveBlockedIP(blockedIP)
+	if err != nil {
+		log.Errorf("proxy: save ban of client <%s> failed, errors:\n%+v",
+			blockedIP.IP,
+			err)
+	}
+}
+
+// clean remove the expired counters
+func (b *autoBanner) clean(now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	for ip, c := range b.counters {
+		if !now.Before(c.resetAt) {
+			delete(b.counters, ip)
+		}
+	}
+}
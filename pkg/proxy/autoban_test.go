@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestAutoBanner(cnf *conf.AutoBan) *autoBanner {
+	b := &autoBanner{
+		cnf:      cnf,
+		rt:       model.NewRouteTable(nil, nil, nil),
+		window:   time.Duration(cnf.Window) * time.Second,
+		duration: time.Duration(cnf.Duration) * time.Second,
+		statuses: make(map[int]bool),
+		counters: make(map[string]*banCounter),
+		bans:     make(chan *model.BlockedIP, 1),
+	}
+
+	for _, status := range cnf.Statuses {
+		b.statuses[status] = true
+	}
+
+	return b
+}
+
+func TestAutoBannerRecord(t *testing.T) {
+	b := newTestAutoBanner(&conf.AutoBan{Threshold: 2, Window: 60, Duration: 60})
+
+	for i := 0; i < 2; i++ {
+		b.record("10.0.0.1", fasthttp.StatusUnauthorized)
+	}
+	b.record("10.0.0.1", fasthttp.StatusOK)
+	b.record("10.0.0.2", fasthttp.StatusNotFound)
+
+	if b.rt.IsBlocked("10.0.0.1") || len(b.bans) != 0 {
+		t.Fatal("expect not banned before the threshold exceeded")
+	}
+
+	b.record("10.0.0.1", fasthttp.StatusForbidden)
+	if !b.rt.IsBlocked("10.0.0.1") {
+		t.Error("expect banned at once after the threshold exceeded")
+	}
+
+	if b.rt.IsBlocked("10.0.0.2") {
+		t.Error("expect other ip not banned")
+	}
+
+	// the ban is saved in background
+	select {
+	case blockedIP := <-b.bans:
+		if blockedIP.IP != "10.0.0.1" || !blockedIP.Auto {
+			t.Errorf("unexpected ban: %+v", blockedIP)
+		}
+	default:
+		t.Error("expect the ban waiting to be saved")
+	}
+
+	// the counter is reset after banned
+	if _, ok := b.counters["10.0.0.1"]; ok {
+		t.Error("expect the counter removed")
+	}
+}
+
+func TestAutoBannerStatuses(t *testing.T) {
+	b := newTestAutoBanner(&conf.AutoBan{Threshold: 1, Window: 60, Duration: 60, Statuses: []int{fasthttp.StatusTooManyRequests}})
+
+	for i := 0; i < 3; i++ {
+		b.record("10.0.0.1", fasthttp.StatusUnauthorized)
+	}
+
+	if b.rt.IsBlocked("10.0.0.1") {
+		t.Error("expect the statuses not in the config not counted")
+	}
+
+	for i := 0; i < 2; i++ {
+		b.record("10.0.0.1", fasthttp.StatusTooManyRequests)
+	}
+
+	if !b.rt.IsBlocked("10.0.0.1") {
+		t.Error("expect banned by the statuses in the config")
+	}
+}
+
+func TestAutoBannerClean(t *testing.T) {
+	b := newTestAutoBanner(&conf.AutoBan{Threshold: 10, Window: 60, Duration: 60})
+	b.record("10.0.0.1", fasthttp.StatusUnauthorized)
+
+	b.clean(time.Now().Add(time.Minute * 2))
+	if len(b.counters) != 0 {
+		t.Error("expect the expired counters removed")
+	}
+}
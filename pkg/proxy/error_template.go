@@ -0,0 +1,302 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/fagongzi/log"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasttemplate"
+)
+
+const (
+	// ErrorTypeNoRoute no api matches the request
+	ErrorTypeNoRoute = "no_route"
+	// ErrorTypeBlocked the client ip is blocked, by the blocklist, the blacklist or the whitelist
+	ErrorTypeBlocked = "blocked"
+	// ErrorTypeRateLimited the request is limited by the max qps or the rate limits
+	ErrorTypeRateLimited = "rate_limited"
+	// ErrorTypeQuotaExceeded the quota of the consumer is exhausted
+	ErrorTypeQuotaExceeded = "quota_exceeded"
+	// ErrorTypeCircuitOpen the circuit breaker rejected the request
+	ErrorTypeCircuitOpen = "circuit_open"
+	// ErrorTypeValidationFailed the request validation failed
+	ErrorTypeValidationFailed = "validation_failed"
+	// ErrorTypeUnauthorized a filter rejected the request with 401
+	ErrorTypeUnauthorized = "unauthorized"
+	// ErrorTypeForbidden a filter rejected the request with 403
+	ErrorTypeForbidden = "forbidden"
+	// ErrorTypeBackendUnavailable the backend servers are unavailable
+	ErrorTypeBackendUnavailable = "backend_unavailable"
+	// ErrorTypeBackendFailed the backend server responded a error status code without a body
+	ErrorTypeBackendFailed = "backend_failed"
+	// ErrorTypeFilterUnavailable the sidecar of a remote filter is unavailable
+	ErrorTypeFilterUnavailable = "filter_unavailable"
+	// ErrorTypeScriptRejected the script of the api rejected the request
+	ErrorTypeScriptRejected = "script_rejected"
+	// ErrorTypeRemoteRejected the sidecar of a remote filter rejected the request
+	ErrorTypeRemoteRejected = "remote_rejected"
+	// ErrorTypeRejected the other errors
+	ErrorTypeRejected = "rejected"
+
+	defaultRequestIDHeader    = "X-Request-Id"
+	defaultErrorContentType   = "application/json; charset=utf-8"
+	maxRequestIDLength        = 128
+	errorTemplateStartTag     = "{{"
+	errorTemplateEndTag       = "}}"
+	errorTemplateStatusSuffix = "xx"
+	errorTemplateMatchAll     = "*"
+)
+
+// errorMessages the messages of the error types, the errors may have internal details like the addresses
+// of the backend servers, so they are not responded to the clients
+var errorMessages = map[string]string{
+	ErrorTypeNoRoute:            "No api matches the request",
+	ErrorTypeBlocked:            "The client is blocked",
+	ErrorTypeRateLimited:        "Too many requests",
+	ErrorTypeQuotaExceeded:      "The quota is exceeded",
+	ErrorTypeCircuitOpen:        "The service is unavailable",
+	ErrorTypeValidationFailed:   "The request is invalid",
+	ErrorTypeUnauthorized:       "Unauthorized",
+	ErrorTypeForbidden:          "Forbidden",
+	ErrorTypeBackendUnavailable: "The service is unavailable",
+	ErrorTypeBackendFailed:      "The service failed",
+	ErrorTypeFilterUnavailable:  "The service is unavailable",
+	ErrorTypeScriptRejected:     "The request is rejected",
+	ErrorTypeRemoteRejected:     "The request is rejected",
+	ErrorTypeRejected:           "The request is rejected",
+}
+
+// backendError the backend server is unavailable
+type backendError struct {
+	err error
+}
+
+func (e *backendError) Error() string {
+	return e.err.Error()
+}
+
+// errorTemplate a parsed error template
+type errorTemplate struct {
+	*conf.ErrorTemplate
+	body *fasttemplate.Template
+	json bool
+}
+
+func parseErrorTemplates(templates []*conf.ErrorTemplate, owner string) []*errorTemplate {
+	var values []*errorTemplate
+	for _, t := range templates {
+		body, err := fasttemplate.NewTemplate(t.Body, errorTemplateStartTag, errorTemplateEndTag)
+		if err != nil {
+			log.Warnf("proxy: error template <%s> of <%s> is invalid and ignored, errors:\n%+v",
+				t.Match,
+				owner,
+				err)
+			continue
+		}
+
+		value := &errorTemplate{
+			ErrorTemplate: t,
+			body:          body,
+		}
+		value.json = strings.Contains(value.contentType(), "json")
+		values = append(values, value)
+	}
+
+	return values
+}
+
+func (t *errorTemplate) contentType() string {
+	if t.ContentType == "" {
+		return defaultErrorContentType
+	}
+
+	return t.ContentType
+}
+
+// score returns the priority of the matched template, the error type > the status code > the status class > *,
+// returns -1 if not matched
+func (t *errorTemplate) score(errType string, statusCode int) int {
+	status := strconv.Itoa(statusCode)
+
+	switch {
+	case t.Match == errType:
+		return 3
+	case t.Match == status:
+		return 2
+	case len(t.Match) == 3 && strings.HasSuffix(t.Match, errorTemplateStatusSuffix) && t.Match[0] == status[0]:
+		return 1
+	case t.Match == errorTemplateMatchAll:
+		return 0
+	}
+
+	return -1
+}
+
+func selectErrorTemplate(templates []*errorTemplate, errType string, statusCode int) *errorTemplate {
+	var selected *errorTemplate
+	max := -1
+	for _, t := range templates {
+		if score := t.score(errType, statusCode); score > max {
+			selected = t
+			max = score
+		}
+	}
+
+	return selected
+}
+
+// renderError render the error response by the templates of the api or the global templates.
+// The body of the rejections, like the script rejected with a body, is not changed, and the default bodies
+// of the filters, like the violations of the validation, are written by PreResponse if no template matches.
+func (p *Proxy) renderError(c *requestContext) {
+	if nil == c.err {
+		return
+	}
+
+	ctx := c.originCtx
+	if len(ctx.Response.Body()) > 0 {
+		return
+	}
+	errType := getErrorType(c.err, ctx.Response.StatusCode())
+
+	t := selectErrorTemplate(p.getErrorTemplates(c.api), errType, ctx.Response.StatusCode())
+	if nil == t {
+		t = selectErrorTemplate(p.errorTemplates, errType, ctx.Response.StatusCode())
+	}
+
+	if nil == t {
+		return
+	}
+
+	statusCode := ctx.Response.StatusCode()
+	if t.StatusCode > 0 {
+		statusCode = t.StatusCode
+	}
+
+	code := t.Code
+	if code == "" {
+		code = errType
+	}
+
+	body := t.body.ExecuteFuncString(func(w io.Writer, tag string) (int, error) {
+		var value string
+		switch strings.TrimSpace(tag) {
+		case "requestId":
+			value = c.requestID
+		case "code":
+			value = code
+		case "type":
+			value = errType
+		case "status":
+			value = strconv.Itoa(statusCode)
+		case "message":
+			value = errorMessages[errType]
+		}
+
+		if t.json {
+			value = escapeJSONString(value)
+		} else {
+			value = html.EscapeString(value)
+		}
+
+		return io.WriteString(w, value)
+	})
+
+	ctx.SetStatusCode(statusCode)
+	ctx.Response.Header.SetContentType(t.contentType())
+	ctx.Response.SetBodyString(body)
+}
+
+func getErrorType(err error, statusCode int) string {
+	switch err {
+	case ErrAPINotFound:
+		return ErrorTypeNoRoute
+	case ErrIPBlocked, ErrBlacklist, ErrWhitelist:
+		return ErrorTypeBlocked
+	case ErrTraffixLimited, ErrAPITraffixLimited:
+		return ErrorTypeRateLimited
+	case ErrCircuitClose, ErrCircuitHalfLimited:
+		return ErrorTypeCircuitOpen
+	case ErrValidationFailure:
+		return ErrorTypeValidationFailed
+	case ErrNoServer:
+		return ErrorTypeBackendUnavailable
+	case ErrBackendFailed:
+		return ErrorTypeBackendFailed
+	case ErrRemoteFilterUnavailable:
+		return ErrorTypeFilterUnavailable
+	}
+
+	switch err.(type) {
+	case *model.QuotaExceededError:
+		return ErrorTypeQuotaExceeded
+	case *validationError:
+		return ErrorTypeValidationFailed
+	case *backendError:
+		return ErrorTypeBackendUnavailable
+	}
+
+	switch statusCode {
+	case fasthttp.StatusUnauthorized:
+		return ErrorTypeUnauthorized
+	case fasthttp.StatusForbidden:
+		return ErrorTypeForbidden
+	}
+
+	// the other rejections of the script and the remote filters
+	if _, ok := err.(*scriptRejectedError); ok || err == model.ErrScriptRejected {
+		return ErrorTypeScriptRejected
+	}
+
+	if _, ok := err.(*remoteRejectedError); ok {
+		return ErrorTypeRemoteRejected
+	}
+
+	return ErrorTypeRejected
+}
+
+func escapeJSONString(value string) string {
+	data, _ := json.Marshal(value)
+	return string(data[1 : len(data)-1])
+}
+
+// getRequestID returns the request id of the client if it's valid, otherwise generates a new one
+// and sets it to the request, so the backends receive the same id
+func getRequestID(ctx *fasthttp.RequestCtx, header string) string {
+	id := ctx.Request.Header.Peek(header)
+	if validRequestID(id) {
+		return string(id)
+	}
+
+	data := make([]byte, 16)
+	rand.Read(data)
+	value := hex.EncodeToString(data)
+	ctx.Request.Header.Set(header, value)
+	return value
+}
+
+// validRequestID the id of the client is returned to the client by the error templates,
+// so only the letters, digits, '.', '_' and '-' are allowed
+func validRequestID(id []byte) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, b := range id {
+		switch {
+		case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9', b == '.', b == '_', b == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestGetErrorType(t *testing.T) {
+	cases := []struct {
+		err        error
+		statusCode int
+		expect     string
+	}{
+		{ErrAPINotFound, fasthttp.StatusNotFound, ErrorTypeNoRoute},
+		{ErrIPBlocked, fasthttp.StatusForbidden, ErrorTypeBlocked},
+		{ErrWhitelist, fasthttp.StatusForbidden, ErrorTypeBlocked},
+		{ErrAPITraffixLimited, fasthttp.StatusTooManyRequests, ErrorTypeRateLimited},
+		{ErrCircuitClose, fasthttp.StatusServiceUnavailable, ErrorTypeCircuitOpen},
+		{ErrValidationFailure, fasthttp.StatusBadRequest, ErrorTypeValidationFailed},
+		{ErrNoServer, fasthttp.StatusServiceUnavailable, ErrorTypeBackendUnavailable},
+		{ErrBackendFailed, fasthttp.StatusInternalServerError, ErrorTypeBackendFailed},
+		{&backendError{err: errors.New("dial tcp 10.0.0.1:8080")}, fasthttp.StatusBadGateway, ErrorTypeBackendUnavailable},
+		{&model.QuotaExceededError{}, fasthttp.StatusTooManyRequests, ErrorTypeQuotaExceeded},
+		{ErrRemoteFilterUnavailable, fasthttp.StatusServiceUnavailable, ErrorTypeFilterUnavailable},
+		{&remoteRejectedError{reason: "missing token"}, fasthttp.StatusUnauthorized, ErrorTypeUnauthorized},
+		{&remoteRejectedError{}, fasthttp.StatusTooManyRequests, ErrorTypeRemoteRejected},
+		{model.ErrScriptRejected, fasthttp.StatusForbidden, ErrorTypeForbidden},
+		{model.ErrScriptRejected, fasthttp.StatusBadRequest, ErrorTypeScriptRejected},
+		{errors.New("other"), fasthttp.StatusUnauthorized, ErrorTypeUnauthorized},
+		{errors.New("other"), fasthttp.StatusBadRequest, ErrorTypeRejected},
+	}
+
+	for i, c := range cases {
+		if value := getErrorType(c.err, c.statusCode); value != c.expect {
+			t.Errorf("case %d: expect error type <%s>, but <%s>", i, c.expect, value)
+		}
+	}
+}
+
+func TestSelectErrorTemplate(t *testing.T) {
+	templates := parseErrorTemplates([]*conf.ErrorTemplate{
+		{Match: "*", Body: "all"},
+		{Match: "4xx", Body: "4xx"},
+		{Match: "429", Body: "429"},
+		{Match: ErrorTypeRateLimited, Body: "rate limited"},
+	}, "test")
+
+	cases := []struct {
+		errType    string
+		statusCode int
+		expect     string
+	}{
+		{ErrorTypeRateLimited, fasthttp.StatusTooManyRequests, "rate limited"},
+		{ErrorTypeQuotaExceeded, fasthttp.StatusTooManyRequests, "429"},
+		{ErrorTypeNoRoute, fasthttp.StatusNotFound, "4xx"},
+		{ErrorTypeBackendUnavailable, fasthttp.StatusBadGateway, "all"},
+	}
+
+	for i, c := range cases {
+		value := selectErrorTemplate(templates, c.errType, c.statusCode)
+		if nil == value || value.Body != c.expect {
+			t.Errorf("case %d: expect template <%s>, but <%+v>", i, c.expect, value)
+		}
+	}
+
+	if value := selectErrorTemplate(templates[1:3], ErrorTypeBackendUnavailable, fasthttp.StatusBadGateway); nil != value {
+		t.Errorf("expect no template, but <%+v>", value)
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	p := &Proxy{
+		errorTemplates: parseErrorTemplates([]*conf.ErrorTemplate{
+			{Match: "*", StatusCode: fasthttp.StatusServiceUnavailable, Body: `{"type":"{{type}}","message":"{{message}}","requestId":"{{requestId}}"}`},
+		}, "test"),
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.SetStatusCode(fasthttp.StatusBadGateway)
+	c := &requestContext{
+		originCtx: ctx,
+		requestID: "r1",
+		err:       &backendError{err: errors.New("dial tcp 10.0.0.1:8080: connection refused")},
+	}
+
+	p.renderError(c)
+	expect := `{"type":"backend_unavailable","message":"The service is unavailable","requestId":"r1"}`
+	if body := string(ctx.Response.Body()); body != expect {
+		t.Errorf("expect body <%s>, but <%s>", expect, body)
+	}
+
+	if ctx.Response.StatusCode() != fasthttp.StatusServiceUnavailable {
+		t.Errorf("expect status code 503, but %d", ctx.Response.StatusCode())
+	}
+
+	// the body written by the filters is not changed
+	ctx = &fasthttp.RequestCtx{}
+	ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	ctx.SetBodyString(`{"violations":[]}`)
+	c = &requestContext{originCtx: ctx, err: ErrValidationFailure}
+
+	p.renderError(c)
+	if body := string(ctx.Response.Body()); body != `{"violations":[]}` || ctx.Response.StatusCode() != fasthttp.StatusBadRequest {
+		t.Errorf("expect the body of the filter, but %d <%s>", ctx.Response.StatusCode(), body)
+	}
+}
+
+func TestGetRequestID(t *testing.T) {
+	cases := []struct {
+		id    string
+		valid bool
+	}{
+		{"0f8c3e7a-9b2d.4c1e_8f6a", true},
+		{"", false},
+		{"<script>alert(1)</script>", false},
+		{"a b", false},
+		{strings.Repeat("a", maxRequestIDLength), true},
+		{strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, c := range cases {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.Set(defaultRequestIDHeader, c.id)
+
+		id := getRequestID(ctx, defaultRequestIDHeader)
+		if (id == c.id) != c.valid || len(id) == 0 {
+			t.Errorf("%s: expect valid %v, but <%s>", c.id, c.valid, id)
+		}
+
+		if value := string(ctx.Request.Header.Peek(defaultRequestIDHeader)); value != id {
+			t.Errorf("%s: expect the id <%s> sent to the backends, but <%s>", c.id, id, value)
+		}
+	}
+}
+
+func TestRenderErrorEscaped(t *testing.T) {
+	p := &Proxy{
+		errorTemplates: parseErrorTemplates([]*conf.ErrorTemplate{
+			{Match: "*", ContentType: "text/html", Body: `<p>{{requestId}}</p>`},
+		}, "test"),
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.SetStatusCode(fasthttp.StatusForbidden)
+	c := &requestContext{originCtx: ctx, requestID: "<b>", err: ErrBlacklist}
+
+	p.renderError(c)
+	if body := string(ctx.Response.Body()); body != `<p>&lt;b&gt;</p>` {
+		t.Errorf("expect the value html escaped, but <%s>", body)
+	}
+}
+
+func TestRenderErrorBeforeFilterBodies(t *testing.T) {
+	p := &Proxy{
+		errorTemplates: parseErrorTemplates([]*conf.ErrorTemplate{
+			{Match: ErrorTypeQuotaExceeded, Body: `{"code":"{{code}}"}`},
+			{Match: ErrorTypeValidationFailed, Body: `{"code":"{{code}}"}`},
+		}, "test"),
+	}
+
+	cases := []struct {
+		err        error
+		statusCode int
+		f          filter.Filter
+		expect     string
+	}{
+		{&model.QuotaExceededError{Message: "quota exceeded"}, fasthttp.StatusTooManyRequests, newQuotaFilter(), `{"code":"quota_exceeded"}`},
+		{&validationError{}, fasthttp.StatusBadRequest, newValidationFilter(), `{"code":"validation_failed"}`},
+	}
+
+	for _, c := range cases {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.SetStatusCode(c.statusCode)
+		rc := &requestContext{originCtx: ctx, attrs: newAttributes(), err: c.err}
+
+		p.renderError(rc)
+		c.f.(filter.PhaseFilter).PreResponse(rc)
+		if body := string(ctx.Response.Body()); body != c.expect {
+			t.Errorf("%s: expect the body of the template <%s>, but <%s>", c.f.Name(), c.expect, body)
+		}
+	}
+}
@@ -29,13 +29,31 @@ const (
 	FilterAnalysis = "ANALYSIS"
 	// FilterRateLimiting limit filter
 	FilterRateLimiting = "RATE-LIMITING"
+	// FilterKeyAuth api key authentication filter
+	FilterKeyAuth = "KEY-AUTH"
+	// FilterJWT jwt validation filter
+	FilterJWT = "JWT"
+	// FilterExtAuth external authorization filter
+	FilterExtAuth = "EXT-AUTH"
+	// FilterSignature request signature filter
+	FilterSignature = "SIGNATURE"
+	// FilterCORS cors filter
+	FilterCORS = "CORS"
+	// FilterQuota consumer quota filter
+	FilterQuota = "QUOTA"
 	// FilterCircuitBreake circuit breake filter
 	FilterCircuitBreake = "CIRCUIT-BREAKE"
 	// FilterValidation validation request filter
 	FilterValidation = "VALIDATION"
+	// FilterScript per api script filter
+	FilterScript = "SCRIPT"
 )
 
 func newFilter(filterSpec *conf.FilterSpec) (filter.Filter, error) {
+	if nil != filterSpec.Remote {
+		return newRemoteFilter(filterSpec)
+	}
+
 	if filterSpec.External {
 		return newExternalFilter(filterSpec)
 	}
@@ -57,10 +75,24 @@ func newFilter(filterSpec *conf.FilterSpec) (filter.Filter, error) {
 		return newWhiteListFilter(), nil
 	case FilterRateLimiting:
 		return newRateLimitingFilter(), nil
+	case FilterKeyAuth:
+		return newKeyAuthFilter(), nil
+	case FilterJWT:
+		return newJWTFilter(), nil
+	case FilterExtAuth:
+		return newExtAuthFilter(), nil
+	case FilterSignature:
+		return newSignatureFilter(), nil
+	case FilterCORS:
+		return newCORSFilter(), nil
+	case FilterQuota:
+		return newQuotaFilter(), nil
 	case FilterCircuitBreake:
 		return newCircuitBreakeFilter(), nil
 	case FilterValidation:
 		return newValidationFilter(), nil
+	case FilterScript:
+		return newScriptFilter(), nil
 	default:
 		return nil, ErrUnknownFilter
 	}
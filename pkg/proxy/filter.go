@@ -12,10 +12,10 @@ import (
 	"github.com/valyala/fasthttp"
 )
 
-func (f *Proxy) doPreFilters(c filter.Context) (filterName string, statusCode int, err error) {
-	for iter := f.filters.Front(); iter != nil; iter = iter.Next() {
-		f, _ := iter.Value.(filter.Filter)
+func (f *Proxy) doPreFilters(c *proxyContext) (filterName string, statusCode int, err error) {
+	for _, f := range f.getFilters(c.result.API) {
 		filterName = f.Name()
+		c.filterConfig = f.config
 
 		statusCode, err = f.Pre(c)
 		if nil != err {
@@ -26,11 +26,13 @@ func (f *Proxy) doPreFilters(c filter.Context) (filterName string, statusCode in
 	return "", http.StatusOK, nil
 }
 
-func (f *Proxy) doPostFilters(c filter.Context) (filterName string, statusCode int, err error) {
-	for iter := f.filters.Back(); iter != nil; iter = iter.Prev() {
-		f, _ := iter.Value.(filter.Filter)
+func (f *Proxy) doPostFilters(c *proxyContext) (filterName string, statusCode int, err error) {
+	filters := f.getFilters(c.result.API)
+	for i := len(filters) - 1; i >= 0; i-- {
+		filterName = filters[i].Name()
+		c.filterConfig = filters[i].config
 
-		statusCode, err = f.Post(c)
+		statusCode, err = filters[i].Post(c)
 		if nil != err {
 			return filterName, statusCode, err
 		}
@@ -39,11 +41,64 @@ func (f *Proxy) doPostFilters(c filter.Context) (filterName string, statusCode i
 	return "", http.StatusOK, nil
 }
 
-func (f *Proxy) doPostErrFilters(c filter.Context) {
-	for iter := f.filters.Back(); iter != nil; iter = iter.Prev() {
-		f, _ := iter.Value.(filter.Filter)
+func (f *Proxy) doPostErrFilters(c *proxyContext) {
+	filters := f.getFilters(c.result.API)
+	for i := len(filters) - 1; i >= 0; i-- {
+		c.filterConfig = filters[i].config
 
-		f.PostErr(c)
+		filters[i].PostErr(c)
+	}
+}
+
+// doPreRoutingFilters only the global filters run before routing
+func (f *Proxy) doPreRoutingFilters(c *requestContext) (filterName string, statusCode int, err error) {
+	for _, f := range f.filters {
+		pf, ok := f.Filter.(filter.PhaseFilter)
+		if !ok {
+			continue
+		}
+
+		filterName = f.Name()
+		c.filterConfig = f.config
+
+		statusCode, err = pf.PreRouting(c)
+		if nil != err {
+			return filterName, statusCode, err
+		}
+	}
+
+	return "", http.StatusOK, nil
+}
+
+func (f *Proxy) doPreResponseFilters(c *requestContext) {
+	filters := f.getFilters(c.api)
+	for i := len(filters) - 1; i >= 0; i-- {
+		pf, ok := filters[i].Filter.(filter.PhaseFilter)
+		if !ok {
+			continue
+		}
+
+		c.filterConfig = filters[i].config
+
+		statusCode, err := pf.PreResponse(c)
+		if nil != err {
+			log.Warnf("proxy: call pre response filter failed, filter=<%s> errors:\n%+v",
+				filters[i].Name(),
+				err)
+
+			c.setError(err, statusCode)
+			return
+		}
+	}
+}
+
+func (f *Proxy) doLogFilters(c *requestContext) {
+	filters := f.getFilters(c.api)
+	for i := len(filters) - 1; i >= 0; i-- {
+		if pf, ok := filters[i].Filter.(filter.PhaseFilter); ok {
+			c.filterConfig = filters[i].config
+			pf.Log(c)
+		}
 	}
 }
 
@@ -52,21 +107,33 @@ const (
 	TimerPrefix = "Circuit-"
 )
 
+// the keys of the checks run once a request
+const (
+	onceKeyRateLimit = "rateLimit"
+	onceKeyQuota     = "quota"
+	onceKeyExtAuth   = "extAuth"
+	onceKeySignature = "signature"
+)
+
+// proxyContext the context of a node of the request
 type proxyContext struct {
-	startAt   int64
-	endAt     int64
-	result    *model.RouteResult
-	outerReq  *fasthttp.Request
-	originCtx *fasthttp.RequestCtx
-	rt        *model.RouteTable
+	*requestContext
+
+	startAt  int64
+	endAt    int64
+	result   *model.RouteResult
+	outerReq *fasthttp.Request
+	rt       *model.RouteTable
+
+	filterConfig map[string]string // config of the executing filter
 }
 
-func newContext(rt *model.RouteTable, originCtx *fasthttp.RequestCtx, outerReq *fasthttp.Request, result *model.RouteResult) filter.Context {
+func newContext(rc *requestContext, outerReq *fasthttp.Request, result *model.RouteResult) *proxyContext {
 	return &proxyContext{
-		result:    result,
-		originCtx: originCtx,
-		outerReq:  outerReq,
-		rt:        rt,
+		requestContext: rc,
+		result:         result,
+		outerReq:       outerReq,
+		rt:             rc.proxy.routeTable,
 	}
 }
 
@@ -102,24 +169,210 @@ func (c *proxyContext) NeedMerge() bool {
 	return c.result.Merge
 }
 
-func (c *proxyContext) GetOriginRequestCtx() *fasthttp.RequestCtx {
-	return c.originCtx
+func (c *proxyContext) GetClusterName() string {
+	return c.result.Node.ClusterName
+}
+
+func (c *proxyContext) GetNodeName() string {
+	return c.result.Node.AttrName
+}
+
+func (c *proxyContext) GetFilterConfig(key string) string {
+	return c.filterConfig[key]
+}
+
+func (c *proxyContext) GetFilterConfigs() map[string]string {
+	return copyFilterConfig(c.filterConfig)
 }
 
 func (c *proxyContext) GetMaxQPS() int {
 	return c.result.Svr.MaxQPS
 }
 
+// rateLimitResult the result of the rate limit policies, checked once a request
+type rateLimitResult struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	retryAfter time.Duration
+}
+
+func (c *proxyContext) CheckRateLimit(ip string) (bool, int, int, time.Duration) {
+	value := c.once(onceKeyRateLimit, func() interface{} {
+		allowed, limit, remaining, retryAfter := c.result.API.RateLimitCheck(&c.originCtx.Request, ip, c.getJWTClaims())
+		return &rateLimitResult{
+			allowed:    allowed,
+			limit:      limit,
+			remaining:  remaining,
+			retryAfter: retryAfter,
+		}
+	}).(*rateLimitResult)
+
+	return value.allowed, value.limit, value.remaining, value.retryAfter
+}
+
+func (c *proxyContext) GetRateLimitRemaining(ip string) (int, int) {
+	return c.result.API.RateLimitRemaining(&c.originCtx.Request, ip, c.getJWTClaims())
+}
+
+// getJWTClaims returns the claims of the jwt verified by the JWT filter, nil if not verified
+func (c *proxyContext) getJWTClaims() map[string]interface{} {
+	value, ok := c.GetAttr(filter.AttrJWTClaims)
+	if !ok {
+		return nil
+	}
+
+	claims, _ := value.(map[string]interface{})
+	return claims
+}
+
+func (c *proxyContext) CheckQuota(ip string) error {
+	err, _ := c.once(onceKeyQuota, func() interface{} {
+		// the consumer authenticated by the filters before, like KEY-AUTH, SIGNATURE and JWT
+		consumer := c.GetConsumer()
+		if consumer == "" {
+			consumer = c.GetStringAttr(filter.AttrJWTSubject)
+		}
+
+		return c.rt.CheckQuota(c.result.API, consumer, &c.originCtx.Request, ip, c.getJWTClaims())
+	}).(error)
+
+	return err
+}
+
+// AuthenticateByKey returns the consumer of the api key, if the request is already authenticated
+// by the other filters, the consumer is only checked. The api key is removed from the request.
+func (c *proxyContext) AuthenticateByKey() (string, error) {
+	api := c.result.API
+	if nil != api.Consumers {
+		defer api.Consumers.StripKey(c.GetProxyOuterRequest())
+	}
+
+	if id := c.GetConsumer(); id != "" {
+		return id, c.rt.AllowConsumer(api, id)
+	}
+
+	consumer, err := c.rt.AuthenticateByKey(api, c.GetProxyOuterRequest())
+	if nil == consumer {
+		return "", err
+	}
+
+	return consumer.ID, err
+}
+
+func (c *proxyContext) VerifyJWT() (map[string]string, error) {
+	claims, headers, err := c.rt.VerifyJWT(c.result.API, c.GetProxyOuterRequest())
+	if nil == err && nil != claims {
+		c.SetAttr(filter.AttrJWTClaims, claims)
+		if sub, ok := claims["sub"].(string); ok {
+			c.SetAttr(filter.AttrJWTSubject, sub)
+		}
+	}
+
+	return headers, err
+}
+
+// extAuthResult the decision of the auth server, asked once a request
+type extAuthResult struct {
+	statusCode int
+	headers    map[string]string
+	err        error
+}
+
+func (c *proxyContext) ExtAuth() (int, map[string]string, error) {
+	value := c.once(onceKeyExtAuth, func() interface{} {
+		statusCode, headers, err := c.rt.ExtAuth(c.result.API, &c.originCtx.Request, c.proxy.doRequest)
+		if nil != c.result.API.ExtAuth {
+			c.SetAttr(filter.AttrExtAuthStatus, statusCode)
+		}
+
+		return &extAuthResult{
+			statusCode: statusCode,
+			headers:    headers,
+			err:        err,
+		}
+	}).(*extAuthResult)
+
+	return value.statusCode, value.headers, value.err
+}
+
+// signatureResult the result of the signature verification, verified once a request
+type signatureResult struct {
+	consumer string
+	err      error
+}
+
+func (c *proxyContext) VerifySignature() (string, error) {
+	value := c.once(onceKeySignature, func() interface{} {
+		// the signature is signed with the request of the client, not rewritten by the nodes
+		consumer, err := c.rt.VerifySignature(c.result.API, &c.originCtx.Request, time.Now())
+		return &signatureResult{
+			consumer: consumer,
+			err:      err,
+		}
+	}).(*signatureResult)
+
+	return value.consumer, value.err
+}
+
 func (c *proxyContext) ValidateProxyOuterRequest() bool {
-	return c.result.Node.Validate(c.GetProxyOuterRequest())
+	return len(c.GetValidationViolations()) == 0
+}
+
+func (c *proxyContext) GetValidationViolations() []filter.Violation {
+	violations := c.result.API.Validate(c.result.Node, c.GetProxyOuterRequest(), c.result.Params)
+
+	var values []filter.Violation
+	for _, violation := range violations {
+		values = append(values, filter.Violation{
+			Field:  violation.Field,
+			Reason: violation.Reason,
+		})
+	}
+
+	return values
+}
+
+// scriptRejectedError the script of a node rejected the request in merge mode, with the response of the node
+type scriptRejectedError struct {
+	res *fasthttp.Response
+}
+
+func (e *scriptRejectedError) Error() string {
+	return model.ErrScriptRejected.Error()
+}
+
+func (e *scriptRejectedError) writeResponse(res *fasthttp.Response) {
+	e.res.CopyTo(res)
+}
+
+func (c *proxyContext) RunScript(phase string) (int, error) {
+	var res *fasthttp.Response
+	if phase == model.ScriptPhasePost {
+		res = c.GetProxyResponse()
+	}
+
+	// the nodes run concurrently in merge mode, the script of a node changes the response of its own,
+	// it's written to the client if the node is rejected
+	origin := &c.originCtx.Response
+	if c.NeedMerge() {
+		origin = &fasthttp.Response{}
+	}
+
+	statusCode, err := c.result.API.RunScript(phase, c.GetProxyOuterRequest(), c.result.Params, c.GetClientIP(), res, origin, c)
+	if err == model.ErrScriptRejected && c.NeedMerge() {
+		return statusCode, &scriptRejectedError{res: origin}
+	}
+
+	return statusCode, err
 }
 
 func (c *proxyContext) InBlacklist(ip string) bool {
-	return c.result.API.AccessCheckBlacklist(ip)
+	return c.rt.AccessCheckBlacklist(c.result.API, ip)
 }
 
 func (c *proxyContext) InWhitelist(ip string) bool {
-	return c.result.API.AccessCheckWhitelist(ip)
+	return c.rt.AccessCheckWhitelist(c.result.API, ip)
 }
 
 func (c *proxyContext) IsCircuitOpen() bool {
@@ -1,14 +1,20 @@
 package proxy
 
 import (
+	"bytes"
+	"strings"
 	"time"
 
 	"github.com/fagongzi/gateway/pkg/filter"
 	"github.com/fagongzi/log"
 )
 
+const (
+	accessAttrs = "attrs"
+)
+
 // AccessFilter record the http access log
-// log format: $remoteip "$method $path" $code "$agent" $svr $cost
+// log format: $remoteip "$method $path" $code "$agent" $svr $cost $consumer [$attr=$value ...]
 type AccessFilter struct {
 	filter.BaseFilter
 }
@@ -26,14 +32,49 @@ func (f AccessFilter) Name() string {
 func (f AccessFilter) Post(c filter.Context) (statusCode int, err error) {
 	cost := (c.GetStartAt() - c.GetEndAt())
 
-	log.Infof("filter: %s %s \"%s\" %d \"%s\" %s %s",
-		GetRealClientIP(c.GetOriginRequestCtx()),
+	consumer := c.GetConsumer()
+	if consumer == "" {
+		consumer = "-"
+	}
+
+	log.Infof("filter: %s %s \"%s\" %d \"%s\" %s %s %s%s",
+		c.GetClientIP(),
 		c.GetOriginRequestCtx().Method(),
 		c.GetProxyOuterRequest().RequestURI(),
 		c.GetProxyResponse().StatusCode(),
 		c.GetOriginRequestCtx().UserAgent(),
 		c.GetProxyServerAddr(),
-		time.Duration(cost))
+		time.Duration(cost),
+		consumer,
+		formatAccessAttrs(c))
 
 	return f.BaseFilter.Post(c)
 }
+
+// formatAccessAttrs format the attributes listed by the config attrs, like jwt.sub,rateLimit.remaining
+func formatAccessAttrs(c filter.Context) string {
+	value := c.GetFilterConfig(accessAttrs)
+	if value == "" {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	for _, key := range strings.Split(value, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		attr := c.GetStringAttr(key)
+		if attr == "" {
+			attr = "-"
+		}
+
+		buf.WriteString(" ")
+		buf.WriteString(key)
+		buf.WriteString("=")
+		buf.WriteString(attr)
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"strings"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/fagongzi/log"
+)
+
+// chainFilter a filter of the chain with the config
+type chainFilter struct {
+	filter.Filter
+	config map[string]string
+}
+
+// filterChain the filters of a api, it's rebuilt if the api is changed
+type filterChain struct {
+	api            *model.API
+	filters        []*chainFilter
+	errorTemplates []*errorTemplate
+	corsEnabled    bool
+}
+
+func (p *Proxy) initFilters() {
+	p.filterInstances = make(map[string]filter.Filter)
+	p.filterChains = make(map[*model.API]*filterChain)
+
+	for _, spec := range p.cnf.Filers {
+		f, err := newFilter(spec)
+		if nil != err {
+			log.Fatalf("bootstrap: init filter failed, filter=<%+v> errors:\n%+v",
+				spec,
+				err)
+		}
+
+		log.Infof("bootstrap: filter added, filter=<%+v>", spec)
+		p.filters = append(p.filters, &chainFilter{
+			Filter: f,
+			config: spec.Config,
+		})
+		p.filterInstances[strings.ToUpper(f.Name())] = f
+
+		if f.Name() == FilterCORS {
+			p.corsEnabled = true
+		}
+	}
+}
+
+// getFilters returns the filter chain of the api
+func (p *Proxy) getFilters(api *model.API) []*chainFilter {
+	if nil == api || len(api.Filters) == 0 {
+		return p.filters
+	}
+
+	return p.getChain(api).filters
+}
+
+// getErrorTemplates returns the error templates of the api
+func (p *Proxy) getErrorTemplates(api *model.API) []*errorTemplate {
+	if nil == api || len(api.ErrorTemplates) == 0 {
+		return nil
+	}
+
+	return p.getChain(api).errorTemplates
+}
+
+func (p *Proxy) getChain(api *model.API) *filterChain {
+	p.chainLock.RLock()
+	chain, ok := p.filterChains[api]
+	p.chainLock.RUnlock()
+	if ok {
+		return chain
+	}
+
+	p.chainLock.Lock()
+	defer p.chainLock.Unlock()
+
+	// the replaced apis are removed, the chains are built with the latest apis
+	for value := range p.filterChains {
+		if p.routeTable.GetAPI(value.VHost, value.URL, value.Method) != value {
+			delete(p.filterChains, value)
+		}
+	}
+
+	chain = &filterChain{
+		api:            api,
+		filters:        p.buildFilters(api),
+		errorTemplates: parseErrorTemplates(api.ErrorTemplates, api.URL),
+	}
+	chain.corsEnabled = hasFilter(chain.filters, FilterCORS)
+	p.filterChains[api] = chain
+
+	return chain
+}
+
+// isCORSEnabled returns true if the CORS filter is in the filter chain of the api
+func (p *Proxy) isCORSEnabled(api *model.API) bool {
+	if nil == api || len(api.Filters) == 0 {
+		return p.corsEnabled
+	}
+
+	return p.getChain(api).corsEnabled
+}
+
+// buildFilters the global filters come first in the global order, a global filter listed by the api
+// keeps it's position, and the listed config overrides the global config.
+// Then the listed filters not in the global filters in the listed order.
+// If the api has ordered filters, all the listed filters run in the listed order after the global filters not listed.
+func (p *Proxy) buildFilters(api *model.API) []*chainFilter {
+	listed := make(map[string]*model.APIFilter)
+	for _, value := range api.Filters {
+		listed[strings.ToUpper(value.Name)] = value
+	}
+
+	var filters []*chainFilter
+	for _, f := range p.filters {
+		value, ok := listed[strings.ToUpper(f.Name())]
+		if !ok {
+			filters = append(filters, f)
+			continue
+		}
+
+		if value.Disabled || api.OrderedFilters {
+			continue
+		}
+
+		filters = append(filters, &chainFilter{
+			Filter: f.Filter,
+			config: mergeFilterConfig(f.config, value.Config),
+		})
+	}
+
+	for _, value := range api.Filters {
+		if value.Disabled {
+			continue
+		}
+
+		if global := p.getGlobalFilter(value.Name); nil != global {
+			if api.OrderedFilters {
+				filters = append(filters, &chainFilter{
+					Filter: global.Filter,
+					config: mergeFilterConfig(global.config, value.Config),
+				})
+			}
+			continue
+		}
+
+		f, err := p.getFilterInstance(value.Name)
+		if nil != err {
+			log.Errorf("proxy: filter <%s> of api <%s-%s> is ignored, errors:\n%+v",
+				value.Name,
+				api.Method,
+				api.URL,
+				err)
+			continue
+		}
+
+		filters = append(filters, &chainFilter{
+			Filter: f,
+			config: value.Config,
+		})
+	}
+
+	return filters
+}
+
+func hasFilter(filters []*chainFilter, name string) bool {
+	for _, f := range filters {
+		if f.Name() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getFilterInstance the filters are shared by the chains, the builtin filters not in the global chain are created on demand
+func (p *Proxy) getFilterInstance(name string) (filter.Filter, error) {
+	name = strings.ToUpper(name)
+	if f, ok := p.filterInstances[name]; ok {
+		return f, nil
+	}
+
+	f, err := newFilter(&conf.FilterSpec{Name: name})
+	if nil != err {
+		return nil, err
+	}
+
+	p.filterInstances[name] = f
+	return f, nil
+}
+
+func (p *Proxy) getGlobalFilter(name string) *chainFilter {
+	name = strings.ToUpper(name)
+	for _, f := range p.filters {
+		if strings.ToUpper(f.Name()) == name {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func copyFilterConfig(config map[string]string) map[string]string {
+	value := make(map[string]string, len(config))
+	for key, v := range config {
+		value[key] = v
+	}
+
+	return value
+}
+
+func mergeFilterConfig(global, api map[string]string) map[string]string {
+	if len(api) == 0 {
+		return global
+	}
+
+	config := make(map[string]string, len(global)+len(api))
+	for key, value := range global {
+		config[key] = value
+	}
+
+	for key, value := range api {
+		config[key] = value
+	}
+
+	return config
+}
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+func newTestFilterProxy(names ...string) *Proxy {
+	cnf := &conf.Conf{}
+	for _, name := range names {
+		cnf.Filers = append(cnf.Filers, &conf.FilterSpec{
+			Name:   name,
+			Config: map[string]string{"global": name, "key": "global"},
+		})
+	}
+
+	p := &Proxy{cnf: cnf}
+	p.initFilters()
+	return p
+}
+
+func getFilterNames(filters []*chainFilter) []string {
+	var names []string
+	for _, f := range filters {
+		names = append(names, f.Name())
+	}
+
+	return names
+}
+
+func TestBuildFilters(t *testing.T) {
+	p := newTestFilterProxy(FilterWhiteList, FilterBlackList, FilterCORS, FilterHeader)
+
+	cases := []struct {
+		filters []*model.APIFilter
+		ordered bool
+		expect  []string
+	}{
+		{
+			filters: []*model.APIFilter{{Name: FilterHeader}, {Name: FilterWhiteList}},
+			expect:  []string{FilterWhiteList, FilterBlackList, FilterCORS, FilterHeader},
+		},
+		{
+			filters: []*model.APIFilter{{Name: "cors", Disabled: true}},
+			expect:  []string{FilterWhiteList, FilterBlackList, FilterHeader},
+		},
+		{
+			filters: []*model.APIFilter{{Name: FilterQuota}, {Name: FilterBlackList}, {Name: FilterJWT}},
+			expect:  []string{FilterWhiteList, FilterBlackList, FilterCORS, FilterHeader, FilterQuota, FilterJWT},
+		},
+		{
+			filters: []*model.APIFilter{{Name: FilterQuota, Disabled: true}, {Name: FilterWhiteList, Disabled: true}},
+			expect:  []string{FilterBlackList, FilterCORS, FilterHeader},
+		},
+		{
+			filters: []*model.APIFilter{{Name: FilterHeader}, {Name: FilterJWT}, {Name: FilterWhiteList}},
+			ordered: true,
+			expect:  []string{FilterBlackList, FilterCORS, FilterHeader, FilterJWT, FilterWhiteList},
+		},
+		{
+			filters: []*model.APIFilter{{Name: FilterCORS, Disabled: true}, {Name: FilterQuota}, {Name: FilterBlackList}},
+			ordered: true,
+			expect:  []string{FilterWhiteList, FilterHeader, FilterQuota, FilterBlackList},
+		},
+	}
+
+	for i, c := range cases {
+		names := getFilterNames(p.buildFilters(&model.API{Filters: c.filters, OrderedFilters: c.ordered}))
+		if len(names) != len(c.expect) {
+			t.Errorf("case %d: expect filters %+v, but %+v", i, c.expect, names)
+			continue
+		}
+
+		for j := range names {
+			if names[j] != c.expect[j] {
+				t.Errorf("case %d: expect filters %+v, but %+v", i, c.expect, names)
+				break
+			}
+		}
+	}
+}
+
+func TestBuildFiltersConfig(t *testing.T) {
+	p := newTestFilterProxy(FilterWhiteList, FilterHeader)
+
+	filters := p.buildFilters(&model.API{
+		Filters: []*model.APIFilter{
+			{Name: FilterHeader, Config: map[string]string{"key": "api"}},
+			{Name: FilterQuota, Config: map[string]string{"key": "quota"}},
+		},
+	})
+
+	if len(filters) != 3 {
+		t.Fatalf("expect 3 filters, but %d", len(filters))
+	}
+
+	if filters[0].config["key"] != "global" {
+		t.Errorf("expect global config of the not listed filter, but %+v", filters[0].config)
+	}
+
+	if filters[1].config["key"] != "api" || filters[1].config["global"] != FilterHeader {
+		t.Errorf("expect merged config of the listed global filter, but %+v", filters[1].config)
+	}
+
+	if filters[2].config["key"] != "quota" || len(filters[2].config) != 1 {
+		t.Errorf("expect listed config of the not global filter, but %+v", filters[2].config)
+	}
+
+	filters = p.buildFilters(&model.API{
+		OrderedFilters: true,
+		Filters: []*model.APIFilter{
+			{Name: FilterHeader, Config: map[string]string{"key": "api"}},
+			{Name: FilterWhiteList},
+		},
+	})
+
+	if len(filters) != 2 || filters[0].config["key"] != "api" || filters[0].config["global"] != FilterHeader ||
+		filters[1].config["key"] != "global" {
+		t.Errorf("expect merged config of the ordered filters, but %+v", getFilterNames(filters))
+	}
+
+	if p.filters[1].config["key"] != "global" {
+		t.Errorf("expect global config not changed, but %+v", p.filters[1].config)
+	}
+}
+
+func TestCORSEnabled(t *testing.T) {
+	p := newTestFilterProxy(FilterHeader)
+	if p.corsEnabled {
+		t.Errorf("expect cors disabled globally")
+	}
+
+	enabled := hasFilter(p.buildFilters(&model.API{
+		Filters: []*model.APIFilter{{Name: "cors"}},
+	}), FilterCORS)
+	if !enabled {
+		t.Errorf("expect cors enabled by the api")
+	}
+
+	p = newTestFilterProxy(FilterCORS)
+	if !p.corsEnabled {
+		t.Errorf("expect cors enabled globally")
+	}
+
+	enabled = hasFilter(p.buildFilters(&model.API{
+		Filters: []*model.APIFilter{{Name: FilterCORS, Disabled: true}},
+	}), FilterCORS)
+	if enabled {
+		t.Errorf("expect cors disabled by the api")
+	}
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/valyala/fasthttp"
+)
+
+// CORSFilter add the cors headers to the response of the cross-origin request,
+// the error responses included, so the clients can read the errors.
+// The preflight requests are answered by proxy before dispatch.
+type CORSFilter struct {
+	filter.BaseFilter
+}
+
+func newCORSFilter() filter.Filter {
+	return &CORSFilter{}
+}
+
+// Name return name of this filter
+func (f CORSFilter) Name() string {
+	return FilterCORS
+}
+
+// PreResponse execute before the response is written to the client
+func (f CORSFilter) PreResponse(c filter.RequestContext) (statusCode int, err error) {
+	for name, value := range c.GetCORSHeaders() {
+		c.GetOriginRequestCtx().Response.Header.Set(name, value)
+	}
+
+	return fasthttp.StatusOK, nil
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCORSFilterPreResponse(t *testing.T) {
+	api := &model.API{
+		URL:    "/api/users",
+		Method: "GET",
+		CORS: &model.CORS{
+			AllowOrigins: []string{"https://*.example.com"},
+		},
+	}
+	api.Parse()
+
+	cases := []struct {
+		api    *model.API
+		origin string
+		err    error
+		expect string
+	}{
+		{api: api, origin: "https://a.example.com", expect: "https://a.example.com"},
+		{api: api, origin: "https://a.example.com", err: ErrNoServer, expect: "https://a.example.com"},
+		{api: api, origin: "https://a.other.com", expect: ""},
+		{api: nil, origin: "https://a.example.com", err: ErrAPINotFound, expect: ""},
+	}
+
+	f := newCORSFilter().(*CORSFilter)
+	for i, c := range cases {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Request.Header.Set("Origin", c.origin)
+		if nil != c.err {
+			ctx.SetStatusCode(fasthttp.StatusBadGateway)
+		}
+
+		rc := &requestContext{api: c.api, originCtx: ctx, err: c.err}
+		if _, err := f.PreResponse(rc); err != nil {
+			t.Errorf("case %d: expect no error, but %+v", i, err)
+		}
+
+		value := string(ctx.Response.Header.Peek("Access-Control-Allow-Origin"))
+		if value != c.expect {
+			t.Errorf("case %d: expect allow origin <%s>, but <%s>", i, c.expect, value)
+		}
+	}
+}
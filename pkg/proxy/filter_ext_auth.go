@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"github.com/fagongzi/gateway/pkg/filter"
+)
+
+// ExtAuthFilter ask the external auth server whether the request is allowed
+type ExtAuthFilter struct {
+	filter.BaseFilter
+}
+
+func newExtAuthFilter() filter.Filter {
+	return &ExtAuthFilter{}
+}
+
+// Name return name of this filter
+func (f ExtAuthFilter) Name() string {
+	return FilterExtAuth
+}
+
+// Pre execute before proxy
+func (f ExtAuthFilter) Pre(c filter.Context) (statusCode int, err error) {
+	statusCode, headers, err := c.ExtAuth()
+	if nil != err {
+		return statusCode, err
+	}
+
+	for name, value := range headers {
+		// the headers of auth response are only set by gateway
+		if value == "" {
+			c.GetProxyOuterRequest().Header.Del(name)
+		} else {
+			c.GetProxyOuterRequest().Header.Set(name, value)
+		}
+	}
+
+	return f.BaseFilter.Pre(c)
+}
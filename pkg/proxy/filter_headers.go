@@ -54,3 +54,33 @@ func (f HeadersFilter) Post(c filter.Context) (statusCode int, err error) {
 
 	return f.BaseFilter.Post(c)
 }
+
+// setResponseHeader set a header to the client response.
+// The header is set to both proxy response and origin response,
+// so it's kept no matter the HeadersFilter copy the proxy response headers before or after.
+// The nodes run concurrently in merge mode, the origin response is not changed, proxy merges the headers of the nodes.
+func setResponseHeader(c filter.Context, name, value string) {
+	c.GetProxyResponse().Header.Set(name, value)
+	if !c.NeedMerge() {
+		c.GetOriginRequestCtx().Response.Header.Set(name, value)
+	}
+}
+
+// addResponseHeader add a value of the header to the client response like setResponseHeader
+func addResponseHeader(c filter.Context, name, value string) {
+	c.GetProxyResponse().Header.Add(name, value)
+	if !c.NeedMerge() {
+		c.GetOriginRequestCtx().Response.Header.Add(name, value)
+	}
+}
+
+// delResponseHeader remove a header from the client response like setResponseHeader
+func delResponseHeader(c filter.Context, name string) {
+	if nil != c.GetProxyResponse() {
+		c.GetProxyResponse().Header.Del(name)
+	}
+
+	if !c.NeedMerge() {
+		c.GetOriginRequestCtx().Response.Header.Del(name)
+	}
+}
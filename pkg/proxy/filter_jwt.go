@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+const (
+	headerWWWAuthenticate = "WWW-Authenticate"
+	jwtChallenge          = "Bearer"
+)
+
+// JWTFilter verify the bearer jwt, and forward the claims to the backend server
+type JWTFilter struct {
+	filter.BaseFilter
+}
+
+func newJWTFilter() filter.Filter {
+	return &JWTFilter{}
+}
+
+// Name return name of this filter
+func (f JWTFilter) Name() string {
+	return FilterJWT
+}
+
+// Pre execute before proxy
+func (f JWTFilter) Pre(c filter.Context) (statusCode int, err error) {
+	headers, err := c.VerifyJWT()
+	if err == model.ErrJWTForbidden {
+		return http.StatusForbidden, err
+	} else if nil != err {
+		// the nodes run concurrently in merge mode, the header is set by PreResponse once a request
+		c.SetAttr(filter.AttrJWTChallenge, jwtChallenge)
+		return http.StatusUnauthorized, err
+	}
+
+	for name, value := range headers {
+		// the headers of claims are only set by gateway
+		if value == "" {
+			c.GetProxyOuterRequest().Header.Del(name)
+		} else {
+			c.GetProxyOuterRequest().Header.Set(name, value)
+		}
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// PreResponse set the challenge of the rejected request
+func (f JWTFilter) PreResponse(c filter.RequestContext) (statusCode int, err error) {
+	res := &c.GetOriginRequestCtx().Response
+	if challenge := c.GetStringAttr(filter.AttrJWTChallenge); challenge != "" && res.StatusCode() == http.StatusUnauthorized {
+		res.Header.Set(headerWWWAuthenticate, challenge)
+	}
+
+	return f.BaseFilter.PreResponse(c)
+}
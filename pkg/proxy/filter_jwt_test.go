@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/valyala/fasthttp"
+)
+
+func TestJWTPreResponse(t *testing.T) {
+	f := newJWTFilter().(filter.PhaseFilter)
+
+	c := &requestContext{originCtx: &fasthttp.RequestCtx{}, attrs: newAttributes()}
+	c.SetAttr(filter.AttrJWTChallenge, jwtChallenge)
+	c.originCtx.SetStatusCode(fasthttp.StatusUnauthorized)
+
+	f.PreResponse(c)
+	if value := string(c.originCtx.Response.Header.Peek(headerWWWAuthenticate)); value != jwtChallenge {
+		t.Errorf("expect the challenge, but <%s>", value)
+	}
+
+	// the request is rejected by the other node or filter
+	c = &requestContext{originCtx: &fasthttp.RequestCtx{}, attrs: newAttributes()}
+	c.SetAttr(filter.AttrJWTChallenge, jwtChallenge)
+	c.originCtx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+
+	f.PreResponse(c)
+	if value := c.originCtx.Response.Header.Peek(headerWWWAuthenticate); len(value) > 0 {
+		t.Errorf("expect no challenge, but <%s>", value)
+	}
+}
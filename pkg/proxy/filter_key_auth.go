@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// KeyAuthFilter authenticate the consumer by the api key,
+// and forward the consumer identity to the backend server
+type KeyAuthFilter struct {
+	filter.BaseFilter
+}
+
+func newKeyAuthFilter() filter.Filter {
+	return &KeyAuthFilter{}
+}
+
+// Name return name of this filter
+func (f KeyAuthFilter) Name() string {
+	return FilterKeyAuth
+}
+
+// Pre execute before proxy
+func (f KeyAuthFilter) Pre(c filter.Context) (statusCode int, err error) {
+	// the consumer header is only set by gateway
+	c.GetProxyOuterRequest().Header.Del(model.ConsumerHeader)
+
+	// the consumer authenticated by other filter, e.g. SIGNATURE, is checked too
+	consumer, err := c.AuthenticateByKey()
+	if err == model.ErrConsumerForbidden {
+		return http.StatusForbidden, err
+	} else if nil != err {
+		return http.StatusUnauthorized, err
+	}
+
+	if consumer != "" {
+		c.SetConsumer(consumer)
+	}
+
+	if consumer := c.GetConsumer(); consumer != "" {
+		c.GetProxyOuterRequest().Header.Set(model.ConsumerHeader, consumer)
+	}
+
+	return f.BaseFilter.Pre(c)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestKeyAuthContext(rt *model.RouteTable, api *model.API, uri string) *proxyContext {
+	outerReq := &fasthttp.Request{}
+	outerReq.SetRequestURI(uri)
+
+	return &proxyContext{
+		requestContext: &requestContext{
+			originCtx: &fasthttp.RequestCtx{},
+			attrs:     newAttributes(),
+			api:       api,
+		},
+		outerReq: outerReq,
+		rt:       rt,
+		result:   &model.RouteResult{API: api},
+	}
+}
+
+func TestKeyAuthFilterPre(t *testing.T) {
+	partner := &model.Consumer{ID: "a"}
+	key, _ := partner.NewKey()
+
+	rt := model.NewRouteTable(nil, nil, nil)
+	rt.UpdateConsumer(partner)
+	rt.UpdateConsumer(&model.Consumer{ID: "b"})
+
+	api := &model.API{Consumers: &model.ConsumerControl{IDs: []string{"a"}}}
+	f := newKeyAuthFilter()
+
+	c := newTestKeyAuthContext(rt, api, "/users?apikey="+key)
+	c.GetProxyOuterRequest().Header.Set(model.ConsumerHeader, "b")
+	if code, err := f.Pre(c); err != nil || code != http.StatusOK {
+		t.Fatalf("expect allowed, but %d %+v", code, err)
+	}
+
+	if c.GetConsumer() != "a" || string(c.GetProxyOuterRequest().Header.Peek(model.ConsumerHeader)) != "a" {
+		t.Errorf("expect consumer a forwarded, but %s", c.GetProxyOuterRequest().Header.Peek(model.ConsumerHeader))
+	}
+
+	if string(c.GetProxyOuterRequest().RequestURI()) != "/users" {
+		t.Errorf("expect the api key stripped, but %s", c.GetProxyOuterRequest().RequestURI())
+	}
+
+	// authenticated by the other filter, but not allowed to call the api
+	c = newTestKeyAuthContext(rt, api, "/users")
+	c.SetConsumer("b")
+	if code, err := f.Pre(c); err != model.ErrConsumerForbidden || code != http.StatusForbidden {
+		t.Errorf("expect consumer b forbidden, but %d %+v", code, err)
+	}
+
+	c = newTestKeyAuthContext(rt, api, "/users?apikey=invalid")
+	if code, err := f.Pre(c); err != model.ErrInvalidAPIKey || code != http.StatusUnauthorized {
+		t.Errorf("expect invalid key, but %d %+v", code, err)
+	}
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+const (
+	quotaContentType = "application/json; charset=utf-8"
+)
+
+// QuotaFilter QuotaFilter
+type QuotaFilter struct {
+	filter.BaseFilter
+}
+
+func newQuotaFilter() filter.Filter {
+	return &QuotaFilter{}
+}
+
+// Name return name of this filter
+func (f QuotaFilter) Name() string {
+	return FilterQuota
+}
+
+// Pre execute before proxy, the nodes run concurrently in merge mode, so the body is written by PreResponse
+func (f QuotaFilter) Pre(c filter.Context) (statusCode int, err error) {
+	err = c.CheckQuota(c.GetClientIP())
+	if nil != err {
+		c.RecordMetricsForReject()
+		return http.StatusTooManyRequests, err
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// PreResponse write the quota of the rejected request, if the body is not written by the error templates
+func (f QuotaFilter) PreResponse(c filter.RequestContext) (statusCode int, err error) {
+	quotaErr, ok := c.GetError().(*model.QuotaExceededError)
+	res := &c.GetOriginRequestCtx().Response
+	if ok && len(res.Body()) == 0 {
+		body, _ := json.Marshal(quotaErr)
+		res.Header.SetContentType(quotaContentType)
+		res.SetBody(body)
+	}
+
+	return f.BaseFilter.PreResponse(c)
+}
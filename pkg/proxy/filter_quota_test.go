@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func TestQuotaPreResponse(t *testing.T) {
+	f := newQuotaFilter().(filter.PhaseFilter)
+
+	c := &requestContext{
+		originCtx: &fasthttp.RequestCtx{},
+		attrs:     newAttributes(),
+		err:       &model.QuotaExceededError{Message: "quota exceeded", Consumer: "c1", Limit: 10},
+	}
+
+	f.PreResponse(c)
+	if body := string(c.originCtx.Response.Body()); body != `{"error":"quota exceeded","consumer":"c1","group":"","period":"","limit":10,"resetAt":0}` {
+		t.Errorf("expect the quota in body, but <%s>", body)
+	}
+
+	// the body of the error template is not changed
+	c.originCtx.Response.SetBodyString("template")
+	f.PreResponse(c)
+	if body := string(c.originCtx.Response.Body()); body != "template" {
+		t.Errorf("expect the body of the error template, but <%s>", body)
+	}
+
+	c = &requestContext{originCtx: &fasthttp.RequestCtx{}, attrs: newAttributes(), err: ErrAPINotFound}
+	f.PreResponse(c)
+	if len(c.originCtx.Response.Body()) > 0 {
+		t.Errorf("expect no body of the other errors, but <%s>", c.originCtx.Response.Body())
+	}
+}
@@ -3,14 +3,28 @@ package proxy
 import (
 	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/fagongzi/gateway/pkg/filter"
 	"github.com/fagongzi/log"
 )
 
+const (
+	// rateLimitingMaxQPS config of the filter, it overrides the max qps of the server
+	rateLimitingMaxQPS = "maxQPS"
+)
+
+const (
+	headerRateLimitLimit     = "X-RateLimit-Limit"
+	headerRateLimitRemaining = "X-RateLimit-Remaining"
+	headerRetryAfter         = "Retry-After"
+)
+
 var (
 	// ErrTraffixLimited traffic limit
 	ErrTraffixLimited = errors.New("traffic limit")
+	// ErrAPITraffixLimited api traffic limit by rate limit policy
+	ErrAPITraffixLimited = errors.New("api traffic limit")
 )
 
 // RateLimitingFilter RateLimitingFilter
@@ -30,12 +44,62 @@ func (f RateLimitingFilter) Name() string {
 // Pre execute before proxy
 func (f RateLimitingFilter) Pre(c filter.Context) (statusCode int, err error) {
 	requestCounts := c.GetRecentlyRequestCount(1)
+	maxQPS := getMaxQPS(c)
 
-	if requestCounts >= c.GetMaxQPS() {
-		log.Warnf("filter: qps: %d, last 1 secs: %d", c.GetMaxQPS(), requestCounts)
+	if requestCounts >= maxQPS {
+		log.Warnf("filter: qps: %d, last 1 secs: %d", maxQPS, requestCounts)
 		c.RecordMetricsForReject()
 		return http.StatusServiceUnavailable, ErrTraffixLimited
 	}
 
+	// the nodes run concurrently in merge mode, the headers are set by PreResponse once a request
+	allowed, limit, remaining, retryAfter := c.CheckRateLimit(c.GetClientIP())
+	if limit > 0 {
+		c.SetAttr(filter.AttrRateLimitLimit, limit)
+		c.SetAttr(filter.AttrRateLimitRemaining, remaining)
+	}
+
+	if !allowed {
+		// round up, at least 1 second
+		secs := int((retryAfter.Nanoseconds()-1)/1e9) + 1
+		c.SetAttr(filter.AttrRateLimitRetryAfter, secs)
+		c.RecordMetricsForReject()
+		return http.StatusTooManyRequests, ErrAPITraffixLimited
+	}
+
 	return f.BaseFilter.Pre(c)
 }
+
+// Post execute after proxy
+func (f RateLimitingFilter) Post(c filter.Context) (statusCode int, err error) {
+	limit, remaining := c.GetRateLimitRemaining(c.GetClientIP())
+	if limit > 0 {
+		setResponseHeader(c, headerRateLimitLimit, strconv.Itoa(limit))
+		setResponseHeader(c, headerRateLimitRemaining, strconv.Itoa(remaining))
+	}
+
+	return f.BaseFilter.Post(c)
+}
+
+// PreResponse set the rate limit headers if they are not set by Post, like the request is rejected
+func (f RateLimitingFilter) PreResponse(c filter.RequestContext) (statusCode int, err error) {
+	header := &c.GetOriginRequestCtx().Response.Header
+	if limit := c.GetIntAttr(filter.AttrRateLimitLimit); limit > 0 && len(header.Peek(headerRateLimitLimit)) == 0 {
+		header.Set(headerRateLimitLimit, strconv.Itoa(limit))
+		header.Set(headerRateLimitRemaining, strconv.Itoa(c.GetIntAttr(filter.AttrRateLimitRemaining)))
+	}
+
+	if secs := c.GetIntAttr(filter.AttrRateLimitRetryAfter); secs > 0 {
+		header.Set(headerRetryAfter, strconv.Itoa(secs))
+	}
+
+	return f.BaseFilter.PreResponse(c)
+}
+
+func getMaxQPS(c filter.Context) int {
+	if value, err := strconv.Atoi(c.GetFilterConfig(rateLimitingMaxQPS)); err == nil && value > 0 {
+		return value
+	}
+
+	return c.GetMaxQPS()
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/valyala/fasthttp"
+)
+
+func TestRateLimitingPreResponse(t *testing.T) {
+	f := newRateLimitingFilter().(filter.PhaseFilter)
+
+	c := &requestContext{originCtx: &fasthttp.RequestCtx{}, attrs: newAttributes()}
+	c.SetAttr(filter.AttrRateLimitLimit, 10)
+	c.SetAttr(filter.AttrRateLimitRemaining, 0)
+	c.SetAttr(filter.AttrRateLimitRetryAfter, 3)
+
+	f.PreResponse(c)
+
+	header := &c.originCtx.Response.Header
+	if string(header.Peek(headerRateLimitLimit)) != "10" || string(header.Peek(headerRateLimitRemaining)) != "0" ||
+		string(header.Peek(headerRetryAfter)) != "3" {
+		t.Errorf("expect the rate limit headers, but %s", header.String())
+	}
+
+	// the headers set by the post filter are not changed
+	c = &requestContext{originCtx: &fasthttp.RequestCtx{}, attrs: newAttributes()}
+	c.SetAttr(filter.AttrRateLimitLimit, 10)
+	c.SetAttr(filter.AttrRateLimitRemaining, 5)
+	c.originCtx.Response.Header.Set(headerRateLimitLimit, "10")
+	c.originCtx.Response.Header.Set(headerRateLimitRemaining, "4")
+
+	f.PreResponse(c)
+
+	header = &c.originCtx.Response.Header
+	if string(header.Peek(headerRateLimitRemaining)) != "4" || len(header.Peek(headerRetryAfter)) > 0 {
+		t.Errorf("expect the headers of the post filter kept, but %s", header.String())
+	}
+}
@@ -0,0 +1,442 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/filter/sidecar"
+	"github.com/fagongzi/log"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	remoteUnixAddrPrefix   = "unix:"
+	defaultRemoteTimeout   = 1000 // ms
+	remoteJSONContentType  = "application/json"
+	remoteSidecarHostValue = "sidecar"
+)
+
+var (
+	// ErrRemoteFilterUnavailable the sidecar of the remote filter is unavailable
+	ErrRemoteFilterUnavailable = errors.New("Remote filter unavailable")
+)
+
+// remoteRejectedError the sidecar rejected the request, the reason is logged
+type remoteRejectedError struct {
+	reason      string
+	headers     map[string][]string
+	body        []byte
+	contentType string
+}
+
+func (e *remoteRejectedError) Error() string {
+	if e.reason == "" {
+		return "Remote filter rejected"
+	}
+
+	return e.reason
+}
+
+func (e *remoteRejectedError) writeResponse(res *fasthttp.Response) {
+	setHeaders(&res.Header, e.headers)
+
+	if len(e.body) > 0 {
+		if e.contentType != "" {
+			res.Header.SetContentType(e.contentType)
+		}
+		res.SetBody(e.body)
+	}
+}
+
+// RemoteFilter a filter runs in a sidecar process, the phases are called over http
+type RemoteFilter struct {
+	filter.BaseFilter
+
+	name     string
+	spec     *conf.RemoteFilterSpec
+	timeout  time.Duration
+	phases   map[string]bool
+	client   *fasthttp.HostClient
+	unixPath string
+}
+
+func newRemoteFilter(filterSpec *conf.FilterSpec) (filter.Filter, error) {
+	spec := filterSpec.Remote
+	if filterSpec.Name == "" {
+		return nil, fmt.Errorf("missing remote filter name")
+	}
+
+	if spec.Addr == "" {
+		return nil, fmt.Errorf("missing remote filter addr: %s", filterSpec.Name)
+	}
+
+	f := &RemoteFilter{
+		name:    strings.ToUpper(filterSpec.Name),
+		spec:    spec,
+		timeout: time.Duration(spec.Timeout) * time.Millisecond,
+		phases:  make(map[string]bool),
+	}
+
+	if spec.Timeout <= 0 {
+		f.timeout = time.Duration(defaultRemoteTimeout) * time.Millisecond
+	}
+
+	// the phases of the request are called only if they are listed, the sidecars of the old protocol don't support them
+	if len(spec.Phases) == 0 {
+		f.phases[sidecar.PhasePre] = true
+		f.phases[sidecar.PhasePost] = true
+		f.phases[sidecar.PhasePostErr] = true
+	}
+
+	for _, phase := range spec.Phases {
+		switch phase {
+		case sidecar.PhasePre, sidecar.PhasePost, sidecar.PhasePostErr,
+			sidecar.PhasePreRouting, sidecar.PhasePreResponse, sidecar.PhaseLog:
+			f.phases[phase] = true
+		default:
+			return nil, fmt.Errorf("invalid remote filter phase: %s", phase)
+		}
+	}
+
+	f.client = &fasthttp.HostClient{
+		Addr: spec.Addr,
+	}
+
+	if strings.HasPrefix(spec.Addr, remoteUnixAddrPrefix) {
+		f.unixPath = strings.TrimPrefix(spec.Addr, remoteUnixAddrPrefix)
+		f.client.Addr = remoteSidecarHostValue
+		f.client.Dial = func(addr string) (net.Conn, error) {
+			return net.DialTimeout("unix", f.unixPath, f.timeout)
+		}
+	}
+
+	return f, nil
+}
+
+// Name return name of this filter
+func (f *RemoteFilter) Name() string {
+	return f.name
+}
+
+// PreRouting execute before the api is selected
+func (f *RemoteFilter) PreRouting(c filter.RequestContext) (statusCode int, err error) {
+	if !f.phases[sidecar.PhasePreRouting] {
+		return f.BaseFilter.PreRouting(c)
+	}
+
+	ctx := c.GetOriginRequestCtx()
+	res, err := f.call(f.newRequest(c, sidecar.PhasePreRouting, &ctx.Request, nil))
+	if nil != err {
+		return f.unavailable(err)
+	}
+
+	if !res.Allowed() {
+		return f.reject(c, res)
+	}
+
+	setHeaders(&ctx.Request.Header, res.RequestHeaders)
+
+	f.setAttrs(c, res)
+	return f.BaseFilter.PreRouting(c)
+}
+
+// Pre execute before proxy
+func (f *RemoteFilter) Pre(c filter.Context) (statusCode int, err error) {
+	if !f.phases[sidecar.PhasePre] {
+		return f.BaseFilter.Pre(c)
+	}
+
+	res, err := f.call(f.newNodeRequest(c, sidecar.PhasePre))
+	if nil != err {
+		return f.nodeUnavailable(c, err)
+	}
+
+	if !res.Allowed() {
+		c.RecordMetricsForReject()
+		return f.reject(c, res)
+	}
+
+	setHeaders(&c.GetProxyOuterRequest().Header, res.RequestHeaders)
+
+	f.setAttrs(c, res)
+	return f.BaseFilter.Pre(c)
+}
+
+// Post execute after proxy
+func (f *RemoteFilter) Post(c filter.Context) (statusCode int, err error) {
+	if !f.phases[sidecar.PhasePost] {
+		return f.BaseFilter.Post(c)
+	}
+
+	res, err := f.call(f.newNodeRequest(c, sidecar.PhasePost))
+	if nil != err {
+		return f.nodeUnavailable(c, err)
+	}
+
+	if !res.Allowed() {
+		c.RecordMetricsForReject()
+		return f.reject(c, res)
+	}
+
+	f.setResponseHeaders(c, res)
+	f.setAttrs(c, res)
+	return f.BaseFilter.Post(c)
+}
+
+// PostErr execute proxy has errors, the result of the sidecar is ignored
+func (f *RemoteFilter) PostErr(c filter.Context) {
+	if !f.phases[sidecar.PhasePostErr] {
+		return
+	}
+
+	_, err := f.call(f.newNodeRequest(c, sidecar.PhasePostErr))
+	if nil != err {
+		log.Warnf("filter: call remote filter <%s> failed, phase=<%s> errors:\n%+v",
+			f.name,
+			sidecar.PhasePostErr,
+			err)
+	}
+}
+
+// PreResponse execute before the response is written to the client
+func (f *RemoteFilter) PreResponse(c filter.RequestContext) (statusCode int, err error) {
+	if !f.phases[sidecar.PhasePreResponse] {
+		return f.BaseFilter.PreResponse(c)
+	}
+
+	ctx := c.GetOriginRequestCtx()
+	res, err := f.call(f.newRequest(c, sidecar.PhasePreResponse, &ctx.Request, &ctx.Response))
+	if nil != err {
+		return f.unavailable(err)
+	}
+
+	if !res.Allowed() {
+		return f.reject(c, res)
+	}
+
+	setHeaders(&ctx.Response.Header, res.ResponseHeaders)
+
+	f.setAttrs(c, res)
+	return f.BaseFilter.PreResponse(c)
+}
+
+// Log execute at last with the final response, the result of the sidecar is ignored
+func (f *RemoteFilter) Log(c filter.RequestContext) {
+	if !f.phases[sidecar.PhaseLog] {
+		return
+	}
+
+	ctx := c.GetOriginRequestCtx()
+	_, err := f.call(f.newRequest(c, sidecar.PhaseLog, &ctx.Request, &ctx.Response))
+	if nil != err {
+		log.Warnf("filter: call remote filter <%s> failed, phase=<%s> errors:\n%+v",
+			f.name,
+			sidecar.PhaseLog,
+			err)
+	}
+}
+
+func (f *RemoteFilter) call(value *sidecar.Request) (*sidecar.Response, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(http.MethodPost)
+	req.SetRequestURI(sidecar.Path(value.Phase))
+	req.SetHost(f.client.Addr)
+	req.Header.SetContentType(remoteJSONContentType)
+	req.SetBody(body)
+
+	err = f.client.DoTimeout(req, resp, f.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode() != fasthttp.StatusOK {
+		return nil, fmt.Errorf("sidecar returns %d: %s", resp.StatusCode(), resp.Body())
+	}
+
+	result := &sidecar.Response{}
+	err = json.Unmarshal(resp.Body(), result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// newNodeRequest the request of the node phases, with the request to the backend server and the response of it
+func (f *RemoteFilter) newNodeRequest(c filter.Context, phase string) *sidecar.Request {
+	var res *fasthttp.Response
+	if phase != sidecar.PhasePre {
+		res = c.GetProxyResponse()
+	}
+
+	req := f.newRequest(c, phase, c.GetProxyOuterRequest(), res)
+	req.Cluster = c.GetClusterName()
+	req.Node = c.GetNodeName()
+	return req
+}
+
+func (f *RemoteFilter) newRequest(c filter.RequestContext, phase string, httpReq *fasthttp.Request, res *fasthttp.Response) *sidecar.Request {
+	req := &sidecar.Request{
+		Filter:    f.name,
+		Phase:     phase,
+		RequestID: c.GetRequestID(),
+		ClientIP:  c.GetClientIP(),
+		Consumer:  c.GetConsumer(),
+		API:       c.GetAPIName(),
+		Attrs:     make(map[string]string),
+		Config:    c.GetFilterConfigs(),
+		Method:    string(httpReq.Header.Method()),
+		OriginURI: string(c.GetOriginRequestCtx().RequestURI()),
+		URI:       string(httpReq.RequestURI()),
+		Headers:   make(map[string][]string),
+	}
+
+	for key := range c.GetAttrs() {
+		req.Attrs[key] = c.GetStringAttr(key)
+	}
+
+	httpReq.Header.VisitAll(func(key, value []byte) {
+		name := string(key)
+		req.Headers[name] = append(req.Headers[name], string(value))
+	})
+
+	if f.spec.SendBody {
+		req.Body = httpReq.Body()
+	}
+
+	if nil != res {
+		req.Response = &sidecar.HTTPResponse{
+			StatusCode: res.StatusCode(),
+			Headers:    make(map[string][]string),
+		}
+
+		res.Header.VisitAll(func(key, value []byte) {
+			name := string(key)
+			req.Response.Headers[name] = append(req.Response.Headers[name], string(value))
+		})
+
+		if f.spec.SendBody {
+			req.Response.Body = res.Body()
+		}
+	}
+
+	return req
+}
+
+func (f *RemoteFilter) unavailable(err error) (int, error) {
+	log.Warnf("filter: call remote filter <%s> failed, failOpen=<%v> errors:\n%+v",
+		f.name,
+		f.spec.FailOpen,
+		err)
+
+	if f.spec.FailOpen {
+		return fasthttp.StatusOK, nil
+	}
+
+	return fasthttp.StatusServiceUnavailable, ErrRemoteFilterUnavailable
+}
+
+func (f *RemoteFilter) nodeUnavailable(c filter.Context, err error) (int, error) {
+	statusCode, err := f.unavailable(err)
+	if nil != err {
+		c.RecordMetricsForReject()
+	}
+
+	return statusCode, err
+}
+
+// reject the response of the sidecar is written to the client once by the proxy, the nodes run concurrently in merge mode
+func (f *RemoteFilter) reject(c filter.RequestContext, res *sidecar.Response) (int, error) {
+	statusCode := res.StatusCode
+	if statusCode < fasthttp.StatusBadRequest || statusCode > 599 {
+		log.Warnf("filter: remote filter <%s> rejects with a invalid status code <%d>, use %d",
+			f.name,
+			statusCode,
+			fasthttp.StatusInternalServerError)
+		statusCode = fasthttp.StatusInternalServerError
+	}
+
+	return statusCode, &remoteRejectedError{
+		reason:      res.Reason,
+		headers:     res.ResponseHeaders,
+		body:        res.Body,
+		contentType: res.ContentType,
+	}
+}
+
+// setAttrs the consumer already set by the other filters, like KEY-AUTH, JWT and SIGNATURE, is not overwritten,
+// and the attributes published by the builtin filters can't be set by the sidecar
+func (f *RemoteFilter) setAttrs(c filter.RequestContext, res *sidecar.Response) {
+	if res.Consumer != "" {
+		if consumer := c.GetConsumer(); consumer == "" {
+			c.SetConsumer(res.Consumer)
+		} else if consumer != res.Consumer {
+			log.Warnf("filter: remote filter <%s> sets consumer <%s>, ignored, the consumer is already <%s>",
+				f.name,
+				res.Consumer,
+				consumer)
+		}
+	}
+
+	for key, value := range res.Attrs {
+		if filter.IsReservedAttr(key) {
+			log.Warnf("filter: remote filter <%s> sets the reserved attr <%s>, ignored",
+				f.name,
+				key)
+			continue
+		}
+
+		c.SetAttr(key, value)
+	}
+}
+
+func (f *RemoteFilter) setResponseHeaders(c filter.Context, res *sidecar.Response) {
+	for name, values := range res.ResponseHeaders {
+		delResponseHeader(c, name)
+		for i, value := range values {
+			if i == 0 {
+				setResponseHeader(c, name, value)
+			} else {
+				addResponseHeader(c, name, value)
+			}
+		}
+	}
+}
+
+// headerWriter the request header or the response header
+type headerWriter interface {
+	Del(key string)
+	Set(key, value string)
+	Add(key, value string)
+}
+
+// setHeaders the values of the sidecar replace the old values, a empty list removes the header.
+// The first value is set, because fasthttp doesn't add the special headers like Content-Type.
+func setHeaders(header headerWriter, headers map[string][]string) {
+	for name, values := range headers {
+		header.Del(name)
+		for i, value := range values {
+			if i == 0 {
+				header.Set(name, value)
+			} else {
+				header.Add(name, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/filter/sidecar"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+type testRemotePlugin struct {
+	sidecar.BasePlugin
+
+	requests chan *sidecar.Request
+}
+
+func (p *testRemotePlugin) Pre(req *sidecar.Request) *sidecar.Response {
+	p.requests <- req
+
+	switch req.Header("X-Token") {
+	case "redirect":
+		return sidecar.Reject(http.StatusFound, "redirect")
+	case "invalid":
+		return sidecar.Reject(1000, "invalid")
+	}
+
+	if req.Header("X-Token") == "" {
+		return &sidecar.Response{
+			StatusCode:  http.StatusUnauthorized,
+			Reason:      "missing token",
+			Body:        []byte(`{"error":"missing token"}`),
+			ContentType: "application/json",
+		}
+	}
+
+	return &sidecar.Response{
+		RequestHeaders: map[string][]string{"X-User": {req.Config["user"]}, "X-Token": {}, "X-Role": {"a", "b"}},
+		Consumer:       "u1",
+		Attrs:          map[string]string{"tenant": "t1", filter.AttrJWTSubject: "admin"},
+	}
+}
+
+func (p *testRemotePlugin) PreRouting(req *sidecar.Request) *sidecar.Response {
+	p.requests <- req
+
+	return &sidecar.Response{
+		RequestHeaders: map[string][]string{"X-Tenant": {"t1"}},
+		Attrs:          map[string]string{"tenant": "t1"},
+	}
+}
+
+func (p *testRemotePlugin) PreResponse(req *sidecar.Request) *sidecar.Response {
+	p.requests <- req
+
+	if req.Response.StatusCode == http.StatusBadGateway {
+		return &sidecar.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Body:       []byte("retry later"),
+		}
+	}
+
+	return &sidecar.Response{
+		ResponseHeaders: map[string][]string{"X-Checked": {"true", "again"}},
+	}
+}
+
+func (p *testRemotePlugin) Log(req *sidecar.Request) {
+	p.requests <- req
+}
+
+// testRemoteContext the metrics of the route table are not used by the test
+type testRemoteContext struct {
+	*proxyContext
+	rejected int
+}
+
+func (c *testRemoteContext) RecordMetricsForReject() {
+	c.rejected++
+}
+
+func newTestRemoteFilter(t *testing.T, addr string, failOpen bool, phases ...string) *RemoteFilter {
+	f, err := newRemoteFilter(&conf.FilterSpec{
+		Name: "my-auth",
+		Remote: &conf.RemoteFilterSpec{
+			Addr:     addr,
+			Timeout:  500,
+			FailOpen: failOpen,
+			Phases:   phases,
+		},
+	})
+	if err != nil {
+		t.Fatalf("expect no error, but %+v", err)
+	}
+
+	return f.(*RemoteFilter)
+}
+
+func newTestRemoteContext(token string) *testRemoteContext {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/api/users/1?a=b")
+
+	outerReq := &fasthttp.Request{}
+	outerReq.SetRequestURI("/users/1?a=b")
+	if token != "" {
+		outerReq.Header.Set("X-Token", token)
+	}
+	outerReq.Header.Add("X-Forwarded-For", "10.0.0.1")
+	outerReq.Header.Add("X-Forwarded-For", "10.0.0.2")
+
+	api := &model.API{Name: "get-user", URL: "/api/users/{id}", Method: "GET"}
+	rc := &requestContext{
+		originCtx: ctx,
+		attrs:     newAttributes(),
+		requestID: "r1",
+		api:       api,
+	}
+
+	return &testRemoteContext{
+		proxyContext: &proxyContext{
+			requestContext: rc,
+			outerReq:       outerReq,
+			result: &model.RouteResult{
+				API:  api,
+				Node: &model.Node{ClusterName: "users"},
+			},
+			filterConfig: map[string]string{"user": "admin"},
+		},
+	}
+}
+
+func TestRemoteFilterPre(t *testing.T) {
+	l, err := sidecar.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expect no error, but %+v", err)
+	}
+	defer l.Close()
+
+	plugin := &testRemotePlugin{requests: make(chan *sidecar.Request, 10)}
+	go http.Serve(l, sidecar.Handler(plugin))
+
+	f := newTestRemoteFilter(t, l.Addr().String(), false)
+
+	c := newTestRemoteContext("t1")
+	statusCode, err := f.Pre(c)
+	if err != nil || statusCode != fasthttp.StatusOK {
+		t.Fatalf("expect allowed, but %d %+v", statusCode, err)
+	}
+
+	req := <-plugin.requests
+	if req.Filter != "MY-AUTH" || req.Phase != sidecar.PhasePre || req.RequestID != "r1" || req.API != "get-user" || req.Cluster != "users" {
+		t.Errorf("expect the request info, but %+v", req)
+	}
+
+	if req.OriginURI != "/api/users/1?a=b" || req.URI != "/users/1?a=b" {
+		t.Errorf("expect origin uri and rewritten uri, but <%s> <%s>", req.OriginURI, req.URI)
+	}
+
+	if req.Config["user"] != "admin" {
+		t.Errorf("expect filter config, but %+v", req.Config)
+	}
+
+	if values := req.Headers["X-Forwarded-For"]; len(values) != 2 || values[0] != "10.0.0.1" || values[1] != "10.0.0.2" {
+		t.Errorf("expect the repeated headers, but %+v", req.Headers)
+	}
+
+	if value := string(c.GetProxyOuterRequest().Header.Peek("X-User")); value != "admin" {
+		t.Errorf("expect X-User header admin, but <%s>", value)
+	}
+
+	if value := c.GetProxyOuterRequest().Header.Peek("X-Token"); len(value) > 0 {
+		t.Errorf("expect X-Token header removed, but <%s>", value)
+	}
+
+	var roles []string
+	c.GetProxyOuterRequest().Header.VisitAll(func(key, value []byte) {
+		if string(key) == "X-Role" {
+			roles = append(roles, string(value))
+		}
+	})
+	if len(roles) != 2 || roles[0] != "a" || roles[1] != "b" {
+		t.Errorf("expect the repeated X-Role headers, but %+v", roles)
+	}
+
+	if c.GetConsumer() != "u1" || c.GetStringAttr("tenant") != "t1" {
+		t.Errorf("expect consumer and attrs set, but %+v", c.GetAttrs())
+	}
+
+	if c.GetStringAttr(filter.AttrJWTSubject) != "" {
+		t.Errorf("expect the reserved attr ignored, but %+v", c.GetAttrs())
+	}
+
+	c = newTestRemoteContext("")
+	statusCode, err = f.Pre(c)
+	if err == nil || err.Error() != "missing token" || statusCode != fasthttp.StatusUnauthorized {
+		t.Errorf("expect rejected with 401, but %d %+v", statusCode, err)
+	}
+	<-plugin.requests
+
+	if body := c.GetOriginRequestCtx().Response.Body(); len(body) > 0 || c.rejected != 1 {
+		t.Errorf("expect the body not written by the node and metrics, but <%s> %d", body, c.rejected)
+	}
+
+	c.setError(err, statusCode)
+	if body := string(c.GetOriginRequestCtx().Response.Body()); body != `{"error":"missing token"}` ||
+		string(c.GetOriginRequestCtx().Response.Header.ContentType()) != "application/json" {
+		t.Errorf("expect reject body, but <%s>", body)
+	}
+}
+
+func TestRemoteFilterRejectStatus(t *testing.T) {
+	l, err := sidecar.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expect no error, but %+v", err)
+	}
+	defer l.Close()
+
+	plugin := &testRemotePlugin{requests: make(chan *sidecar.Request, 10)}
+	go http.Serve(l, sidecar.Handler(plugin))
+
+	f := newTestRemoteFilter(t, l.Addr().String(), false)
+
+	for _, token := range []string{"redirect", "invalid"} {
+		statusCode, err := f.Pre(newTestRemoteContext(token))
+		if err == nil || statusCode != fasthttp.StatusInternalServerError {
+			t.Errorf("%s: expect rejected with 500, but %d %+v", token, statusCode, err)
+		}
+		<-plugin.requests
+	}
+}
+
+func TestRemoteFilterConsumerNotOverwritten(t *testing.T) {
+	l, err := sidecar.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expect no error, but %+v", err)
+	}
+	defer l.Close()
+
+	plugin := &testRemotePlugin{requests: make(chan *sidecar.Request, 10)}
+	go http.Serve(l, sidecar.Handler(plugin))
+
+	f := newTestRemoteFilter(t, l.Addr().String(), false)
+
+	c := newTestRemoteContext("t1")
+	c.SetConsumer("key-auth-user")
+	statusCode, err := f.Pre(c)
+	if err != nil || statusCode != fasthttp.StatusOK {
+		t.Fatalf("expect allowed, but %d %+v", statusCode, err)
+	}
+	<-plugin.requests
+
+	if c.GetConsumer() != "key-auth-user" || c.GetStringAttr("tenant") != "t1" {
+		t.Errorf("expect the consumer kept and attrs set, but %+v", c.GetAttrs())
+	}
+}
+
+func TestRemoteFilterUnavailable(t *testing.T) {
+	l, err := sidecar.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expect no error, but %+v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	c := newTestRemoteContext("t1")
+	statusCode, err := newTestRemoteFilter(t, addr, false).Pre(c)
+	if err != ErrRemoteFilterUnavailable || statusCode != fasthttp.StatusServiceUnavailable || c.rejected != 1 {
+		t.Errorf("expect unavailable, but %d %+v", statusCode, err)
+	}
+
+	c = newTestRemoteContext("t1")
+	statusCode, err = newTestRemoteFilter(t, addr, true).Pre(c)
+	if err != nil || statusCode != fasthttp.StatusOK {
+		t.Errorf("expect allowed by fail open, but %d %+v", statusCode, err)
+	}
+}
+
+func TestRemoteFilterRequestPhases(t *testing.T) {
+	l, err := sidecar.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expect no error, but %+v", err)
+	}
+	defer l.Close()
+
+	plugin := &testRemotePlugin{requests: make(chan *sidecar.Request, 10)}
+	go http.Serve(l, sidecar.Handler(plugin))
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/api/users/1")
+	c := &requestContext{
+		originCtx:    ctx,
+		attrs:        newAttributes(),
+		filterConfig: map[string]string{"user": "admin"},
+	}
+
+	// the phases of the request are not called by default
+	f := newTestRemoteFilter(t, l.Addr().String(), false)
+	f.PreRouting(c)
+	f.PreResponse(c)
+	f.Log(c)
+	if len(plugin.requests) != 0 {
+		t.Fatalf("expect no calls, but %d", len(plugin.requests))
+	}
+
+	f = newTestRemoteFilter(t, l.Addr().String(), false, sidecar.PhasePreRouting, sidecar.PhasePreResponse, sidecar.PhaseLog)
+	statusCode, err := f.PreRouting(c)
+	if err != nil || statusCode != fasthttp.StatusOK {
+		t.Fatalf("expect allowed, but %d %+v", statusCode, err)
+	}
+
+	req := <-plugin.requests
+	if req.Phase != sidecar.PhasePreRouting || req.URI != "/api/users/1" || req.Config["user"] != "admin" || nil != req.Response {
+		t.Errorf("expect pre routing request, but %+v", req)
+	}
+
+	if string(ctx.Request.Header.Peek("X-Tenant")) != "t1" || c.GetStringAttr("tenant") != "t1" {
+		t.Errorf("expect request header and attrs set, but %+v", c.GetAttrs())
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	statusCode, err = f.PreResponse(c)
+	if err != nil || statusCode != fasthttp.StatusOK {
+		t.Fatalf("expect allowed, but %d %+v", statusCode, err)
+	}
+
+	req = <-plugin.requests
+	if req.Phase != sidecar.PhasePreResponse || nil == req.Response || req.Response.StatusCode != fasthttp.StatusOK {
+		t.Errorf("expect pre response request, but %+v", req)
+	}
+
+	var checked []string
+	ctx.Response.Header.VisitAll(func(key, value []byte) {
+		if string(key) == "X-Checked" {
+			checked = append(checked, string(value))
+		}
+	})
+	if len(checked) != 2 || checked[0] != "true" || checked[1] != "again" {
+		t.Errorf("expect the repeated response headers set, but %+v", checked)
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusBadGateway)
+	statusCode, err = f.PreResponse(c)
+	if _, ok := err.(*remoteRejectedError); !ok || statusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("expect rejected, but %d %+v", statusCode, err)
+	}
+
+	c.setError(err, statusCode)
+	if string(ctx.Response.Body()) != "retry later" {
+		t.Errorf("expect reject body, but <%s>", ctx.Response.Body())
+	}
+	<-plugin.requests
+
+	f.Log(c)
+	req = <-plugin.requests
+	if req.Phase != sidecar.PhaseLog || req.Response.StatusCode != fasthttp.StatusServiceUnavailable {
+		t.Errorf("expect log request, but %+v", req)
+	}
+}
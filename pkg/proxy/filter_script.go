@@ -0,0 +1,41 @@
+package proxy
+
+import (
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// ScriptFilter run the scripts of the api
+type ScriptFilter struct {
+	filter.BaseFilter
+}
+
+func newScriptFilter() filter.Filter {
+	return &ScriptFilter{}
+}
+
+// Name return name of this filter
+func (f ScriptFilter) Name() string {
+	return FilterScript
+}
+
+// Pre execute before proxy
+func (f ScriptFilter) Pre(c filter.Context) (statusCode int, err error) {
+	statusCode, err = c.RunScript(model.ScriptPhasePre)
+	if nil != err {
+		c.RecordMetricsForReject()
+		return statusCode, err
+	}
+
+	return f.BaseFilter.Pre(c)
+}
+
+// Post execute after proxy
+func (f ScriptFilter) Post(c filter.Context) (statusCode int, err error) {
+	statusCode, err = c.RunScript(model.ScriptPhasePost)
+	if nil != err {
+		return statusCode, err
+	}
+
+	return f.BaseFilter.Post(c)
+}
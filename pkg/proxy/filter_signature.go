@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+)
+
+// SignatureFilter verify the HMAC signature of the request signed by the consumer secret,
+// and forward the consumer identity to the backend server
+type SignatureFilter struct {
+	filter.BaseFilter
+}
+
+func newSignatureFilter() filter.Filter {
+	return &SignatureFilter{}
+}
+
+// Name return name of this filter
+func (f SignatureFilter) Name() string {
+	return FilterSignature
+}
+
+// Pre execute before proxy
+func (f SignatureFilter) Pre(c filter.Context) (statusCode int, err error) {
+	// the consumer header is only set by gateway
+	c.GetProxyOuterRequest().Header.Del(model.ConsumerHeader)
+
+	consumer, err := c.VerifySignature()
+	if err == model.ErrConsumerForbidden {
+		return http.StatusForbidden, err
+	} else if err == model.ErrSignatureNoncesFull {
+		return http.StatusServiceUnavailable, err
+	} else if nil != err {
+		return http.StatusUnauthorized, err
+	}
+
+	if consumer != "" {
+		c.SetConsumer(consumer)
+	}
+
+	if consumer := c.GetConsumer(); consumer != "" {
+		c.GetProxyOuterRequest().Header.Set(model.ConsumerHeader, consumer)
+	}
+
+	return f.BaseFilter.Pre(c)
+}
@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+type testPhaseFilter struct {
+	filter.BaseFilter
+
+	name   string
+	reject string // the phase rejects the request
+	calls  *[]string
+}
+
+func (f *testPhaseFilter) Name() string {
+	return f.name
+}
+
+func (f *testPhaseFilter) record(c filter.RequestContext, phase string) (int, error) {
+	*f.calls = append(*f.calls, phase+":"+f.name+":"+c.GetFilterConfig("name"))
+	if f.reject == phase {
+		return fasthttp.StatusForbidden, errors.New(phase)
+	}
+
+	return fasthttp.StatusOK, nil
+}
+
+func (f *testPhaseFilter) PreRouting(c filter.RequestContext) (int, error) {
+	return f.record(c, "preRouting")
+}
+
+func (f *testPhaseFilter) PreResponse(c filter.RequestContext) (int, error) {
+	return f.record(c, "preResponse")
+}
+
+func (f *testPhaseFilter) Log(c filter.RequestContext) {
+	f.record(c, "log")
+}
+
+// testNodeFilter a filter only runs in the node phases
+type testNodeFilter struct {
+	name string
+}
+
+func (f *testNodeFilter) Name() string {
+	return f.name
+}
+
+func (f *testNodeFilter) Pre(c filter.Context) (int, error) {
+	return fasthttp.StatusOK, nil
+}
+
+func (f *testNodeFilter) Post(c filter.Context) (int, error) {
+	return fasthttp.StatusOK, nil
+}
+
+func (f *testNodeFilter) PostErr(c filter.Context) {
+
+}
+
+func newTestPhaseProxy(calls *[]string, reject map[string]string) *Proxy {
+	p := &Proxy{}
+	for _, name := range []string{"A", "B", "C"} {
+		p.filters = append(p.filters, &chainFilter{
+			Filter: &testPhaseFilter{name: name, reject: reject[name], calls: calls},
+			config: map[string]string{"name": name},
+		})
+	}
+
+	p.filters = append(p.filters, &chainFilter{Filter: &testNodeFilter{name: "D"}})
+	return p
+}
+
+func expectCalls(t *testing.T, calls []string, expect ...string) {
+	if len(calls) != len(expect) {
+		t.Errorf("expect calls %+v, but %+v", expect, calls)
+		return
+	}
+
+	for i := range calls {
+		if calls[i] != expect[i] {
+			t.Errorf("expect calls %+v, but %+v", expect, calls)
+			return
+		}
+	}
+}
+
+func TestPhaseFiltersOrder(t *testing.T) {
+	var calls []string
+	p := newTestPhaseProxy(&calls, nil)
+	c := &requestContext{originCtx: &fasthttp.RequestCtx{}}
+
+	name, _, err := p.doPreRoutingFilters(c)
+	if err != nil || name != "" {
+		t.Errorf("expect no error, but %s %+v", name, err)
+	}
+	expectCalls(t, calls, "preRouting:A:A", "preRouting:B:B", "preRouting:C:C")
+
+	calls = calls[:0]
+	p.doPreResponseFilters(c)
+	if nil != c.err {
+		t.Errorf("expect no error, but %+v", c.err)
+	}
+	expectCalls(t, calls, "preResponse:C:C", "preResponse:B:B", "preResponse:A:A")
+
+	calls = calls[:0]
+	p.doLogFilters(c)
+	expectCalls(t, calls, "log:C:C", "log:B:B", "log:A:A")
+}
+
+func TestPhaseFiltersRejected(t *testing.T) {
+	var calls []string
+	p := newTestPhaseProxy(&calls, map[string]string{"B": "preRouting", "C": "preResponse"})
+	c := &requestContext{originCtx: &fasthttp.RequestCtx{}}
+
+	name, statusCode, err := p.doPreRoutingFilters(c)
+	if err == nil || name != "B" || statusCode != fasthttp.StatusForbidden {
+		t.Errorf("expect rejected by B, but %s %d %+v", name, statusCode, err)
+	}
+	expectCalls(t, calls, "preRouting:A:A", "preRouting:B:B")
+
+	calls = calls[:0]
+	p.doPreResponseFilters(c)
+	if nil == c.err || c.originCtx.Response.StatusCode() != fasthttp.StatusForbidden {
+		t.Errorf("expect rejected by C, but %d %+v", c.originCtx.Response.StatusCode(), c.err)
+	}
+	expectCalls(t, calls, "preResponse:C:C")
+
+	calls = calls[:0]
+	p.doLogFilters(c)
+	expectCalls(t, calls, "log:C:C", "log:B:B", "log:A:A")
+}
+
+func TestRunScriptInMerge(t *testing.T) {
+	api := &model.API{
+		URL:    "/users",
+		Script: &model.APIScript{Pre: `res.setHeader("X-Node", "1"); reject(400, "rejected");`},
+	}
+	api.Parse()
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users")
+	c := &proxyContext{
+		requestContext: &requestContext{originCtx: ctx, attrs: newAttributes()},
+		outerReq:       &ctx.Request,
+		result:         &model.RouteResult{API: api, Node: &model.Node{}, Merge: true},
+	}
+
+	statusCode, err := c.RunScript(model.ScriptPhasePre)
+	if _, ok := err.(*scriptRejectedError); !ok || statusCode != fasthttp.StatusBadRequest {
+		t.Fatalf("expect rejected with 400, but %d %+v", statusCode, err)
+	}
+
+	if len(ctx.Response.Body()) > 0 || len(ctx.Response.Header.Peek("X-Node")) > 0 {
+		t.Errorf("expect the origin response not changed by the node, but <%s>", ctx.Response.String())
+	}
+
+	c.setError(err, statusCode)
+	if string(ctx.Response.Body()) != "rejected" || string(ctx.Response.Header.Peek("X-Node")) != "1" ||
+		ctx.Response.StatusCode() != fasthttp.StatusBadRequest {
+		t.Errorf("expect the response of the node written once, but <%s>", ctx.Response.String())
+	}
+
+	if getErrorType(err, statusCode) != ErrorTypeScriptRejected {
+		t.Errorf("expect the error type %s, but %s", ErrorTypeScriptRejected, getErrorType(err, statusCode))
+	}
+}
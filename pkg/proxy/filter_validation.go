@@ -1,12 +1,17 @@
 package proxy
 
 import (
+	"encoding/json"
 	"errors"
 
 	"github.com/fagongzi/gateway/pkg/filter"
 	"github.com/valyala/fasthttp"
 )
 
+const (
+	validationContentType = "application/json; charset=utf-8"
+)
+
 var (
 	// ErrValidationFailure validation failure
 	ErrValidationFailure = errors.New("request validation failure")
@@ -17,6 +22,21 @@ type ValidationFilter struct {
 	filter.BaseFilter
 }
 
+type validationResult struct {
+	Error      string             `json:"error"`
+	Violations []filter.Violation `json:"violations"`
+}
+
+// validationError the violations of the node, the nodes run concurrently in merge mode,
+// so the violations are written by PreResponse once a request
+type validationError struct {
+	violations []filter.Violation
+}
+
+func (e *validationError) Error() string {
+	return ErrValidationFailure.Error()
+}
+
 func newValidationFilter() filter.Filter {
 	return &ValidationFilter{}
 }
@@ -28,9 +48,28 @@ func (v ValidationFilter) Name() string {
 
 // Pre pre filter, before proxy reuqest
 func (v ValidationFilter) Pre(c filter.Context) (statusCode int, err error) {
-	if c.ValidateProxyOuterRequest() {
+	violations := c.GetValidationViolations()
+	if len(violations) == 0 {
 		return v.BaseFilter.Pre(c)
 	}
 
-	return fasthttp.StatusBadRequest, ErrValidationFailure
+	c.SetAttr(filter.AttrViolations, len(violations))
+	return fasthttp.StatusBadRequest, &validationError{violations: violations}
+}
+
+// PreResponse write the violations of the rejected request, if the body is not written by the error templates
+func (v ValidationFilter) PreResponse(c filter.RequestContext) (statusCode int, err error) {
+	validationErr, ok := c.GetError().(*validationError)
+	res := &c.GetOriginRequestCtx().Response
+	if ok && len(res.Body()) == 0 {
+		body, _ := json.Marshal(&validationResult{
+			Error:      ErrValidationFailure.Error(),
+			Violations: validationErr.violations,
+		})
+
+		res.Header.SetContentType(validationContentType)
+		res.SetBody(body)
+	}
+
+	return v.BaseFilter.PreResponse(c)
 }
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+func newTestValidationContext(value string) *proxyContext {
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Request.SetRequestURI("/users?abc=" + value)
+
+	outerReq := &fasthttp.Request{}
+	outerReq.SetRequestURI("/users?abc=" + value)
+
+	validation := &model.Validation{
+		Attr:     "abc",
+		Required: true,
+		Rules:    []*model.ValidationRule{{Type: model.Enum, Expression: "a,b"}},
+	}
+	validation.ParseValidation()
+
+	return &proxyContext{
+		requestContext: &requestContext{
+			originCtx: ctx,
+			attrs:     newAttributes(),
+		},
+		outerReq: outerReq,
+		result: &model.RouteResult{
+			API:  &model.API{URL: "/users"},
+			Node: &model.Node{Validations: []*model.Validation{validation}},
+		},
+	}
+}
+
+func TestValidateProxyOuterRequest(t *testing.T) {
+	c := newTestValidationContext("a")
+	if !c.ValidateProxyOuterRequest() || len(c.GetValidationViolations()) != 0 {
+		t.Errorf("expect valid, but %+v", c.GetValidationViolations())
+	}
+
+	c = newTestValidationContext("c")
+	violations := c.GetValidationViolations()
+	if c.ValidateProxyOuterRequest() || len(violations) != 1 || violations[0].Field != "query.abc" {
+		t.Errorf("expect invalid, but %+v", violations)
+	}
+}
+
+func TestValidationFilter(t *testing.T) {
+	f := newValidationFilter()
+
+	statusCode, err := f.Pre(newTestValidationContext("a"))
+	if err != nil || statusCode != fasthttp.StatusOK {
+		t.Errorf("expect allowed, but %d %+v", statusCode, err)
+	}
+
+	c := newTestValidationContext("c")
+	statusCode, err = f.Pre(c)
+	if _, ok := err.(*validationError); !ok || statusCode != fasthttp.StatusBadRequest {
+		t.Errorf("expect rejected with 400, but %d %+v", statusCode, err)
+	}
+
+	if len(c.GetOriginRequestCtx().Response.Body()) > 0 || c.GetIntAttr(filter.AttrViolations) != 1 {
+		t.Errorf("expect the body not written by the node, but <%s>", c.GetOriginRequestCtx().Response.Body())
+	}
+
+	c.err = err
+	f.(filter.PhaseFilter).PreResponse(c)
+	if body := string(c.GetOriginRequestCtx().Response.Body()); !strings.Contains(body, `"field":"query.abc"`) {
+		t.Errorf("expect the violations in body, but <%s>", body)
+	}
+
+	if getErrorType(err, statusCode) != ErrorTypeValidationFailed {
+		t.Errorf("expect the error type %s, but %s", ErrorTypeValidationFailed, getErrorType(err, statusCode))
+	}
+}
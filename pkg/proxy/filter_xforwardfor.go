@@ -1,10 +1,14 @@
 package proxy
 
 import (
+	"net"
+
 	"github.com/fagongzi/gateway/pkg/filter"
 )
 
 // XForwardForFilter XForwardForFilter
+// It appends the remote ip to the forwarded chain if the request is sent by a trusted proxy,
+// otherwise the forwarded chain sent by client is replaced by the remote ip.
 type XForwardForFilter struct {
 	filter.BaseFilter
 }
@@ -20,6 +24,33 @@ func (f XForwardForFilter) Name() string {
 
 // Pre execute before proxy
 func (f XForwardForFilter) Pre(c filter.Context) (statusCode int, err error) {
-	c.GetProxyOuterRequest().Header.Add("X-Forwarded-For", c.GetOriginRequestCtx().RemoteIP().String())
+	header := &c.GetProxyOuterRequest().Header
+	remote := c.GetOriginRequestCtx().RemoteIP()
+
+	if !c.FromTrustedProxy() {
+		header.Del(headerForwarded)
+		header.Set(headerXForwardFor, remote.String())
+		return f.BaseFilter.Pre(c)
+	}
+
+	if value := header.Peek(headerXForwardFor); len(value) > 0 {
+		header.Set(headerXForwardFor, string(value)+", "+remote.String())
+	} else {
+		header.Set(headerXForwardFor, remote.String())
+	}
+
+	if value := header.Peek(headerForwarded); len(value) > 0 {
+		header.Set(headerForwarded, string(value)+", "+forwardedNode(remote))
+	}
+
 	return f.BaseFilter.Pre(c)
 }
+
+// forwardedNode returns the for parameter of the Forwarded header, the ipv6 must be quoted
+func forwardedNode(ip net.IP) string {
+	if nil == ip.To4() {
+		return forwardedForPrefix + `"[` + ip.String() + `]"`
+	}
+
+	return forwardedForPrefix + ip.String()
+}
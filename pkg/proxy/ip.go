@@ -1,17 +1,127 @@
 package proxy
 
 import (
+	"bytes"
+	"net"
 	"strings"
 
+	"github.com/fagongzi/gateway/pkg/util"
 	"github.com/valyala/fasthttp"
 )
 
-// GetRealClientIP get read client ip
+const (
+	headerForwarded    = "Forwarded"
+	headerXForwardFor  = "X-Forwarded-For"
+	forwardedForPrefix = "for="
+)
+
+var (
+	untrustedResolver = &clientIPResolver{trusted: util.NewIPTrie()}
+)
+
+// GetRealClientIP get real client ip, no proxies are trusted, so the forwarded headers are ignored.
+// The proxy resolves the client ip by the trusted proxies, use filter.Context.GetClientIP in the filters.
 func GetRealClientIP(ctx *fasthttp.RequestCtx) string {
-	xforward := ctx.Request.Header.Peek("X-Forwarded-For")
-	if nil == xforward {
-		return strings.SplitN(ctx.RemoteAddr().String(), ":", 2)[0]
+	return untrustedResolver.resolve(ctx)
+}
+
+// clientIPResolver resolve the real client ip.
+// The forwarded headers are only trusted if they are added by the trusted proxies.
+type clientIPResolver struct {
+	trusted *util.IPTrie
+	count   int
+}
+
+func newClientIPResolver(trustedProxies []string) (*clientIPResolver, error) {
+	trusted := util.NewIPTrie()
+	for _, value := range trustedProxies {
+		err := trusted.Add(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &clientIPResolver{
+		trusted: trusted,
+		count:   len(trustedProxies),
+	}, nil
+}
+
+func (r *clientIPResolver) hasTrusted() bool {
+	return r.count > 0
+}
+
+func (r *clientIPResolver) isTrusted(ip net.IP) bool {
+	return r.trusted.Contains(ip)
+}
+
+// resolve walk the forwarded chain from right to left, skip the trusted proxies,
+// the first untrusted ip is the client ip.
+func (r *clientIPResolver) resolve(ctx *fasthttp.RequestCtx) string {
+	remote := ctx.RemoteIP()
+	if !r.isTrusted(remote) {
+		return remote.String()
+	}
+
+	chain := getForwardedChain(&ctx.Request.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := net.ParseIP(chain[i])
+		if nil == ip {
+			// the chain before is not trustable
+			break
+		}
+
+		if i == 0 || !r.isTrusted(ip) {
+			return ip.String()
+		}
+	}
+
+	return remote.String()
+}
+
+// getForwardedChain returns the ips of the Forwarded header, or the X-Forwarded-For header if absent
+func getForwardedChain(header *fasthttp.RequestHeader) []string {
+	if value := header.Peek(headerForwarded); len(value) > 0 {
+		return parseForwarded(string(value))
+	}
+
+	value := header.Peek(headerXForwardFor)
+	if len(value) == 0 {
+		return nil
+	}
+
+	var chain []string
+	for _, item := range bytes.Split(value, []byte(",")) {
+		chain = append(chain, string(bytes.TrimSpace(item)))
+	}
+
+	return chain
+}
+
+// parseForwarded parse the for parameters of the Forwarded header(RFC 7239), like
+// for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"
+func parseForwarded(value string) []string {
+	var chain []string
+	for _, element := range strings.Split(value, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			pair = strings.TrimSpace(pair)
+			if len(pair) <= len(forwardedForPrefix) || !strings.EqualFold(pair[:len(forwardedForPrefix)], forwardedForPrefix) {
+				continue
+			}
+
+			node := strings.Trim(pair[len(forwardedForPrefix):], `"`)
+			if strings.HasPrefix(node, "[") {
+				// ipv6 with optional port
+				if end := strings.Index(node, "]"); end > 0 {
+					node = node[1:end]
+				}
+			} else if host, _, err := net.SplitHostPort(node); err == nil {
+				node = host
+			}
+
+			chain = append(chain, node)
+		}
 	}
 
-	return strings.SplitN(string(xforward), ",", 2)[0]
+	return chain
 }
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func newTestIPContext(remote string, headers map[string]string) *fasthttp.RequestCtx {
+	req := fasthttp.AcquireRequest()
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(req, &net.TCPAddr{IP: net.ParseIP(remote), Port: 10000}, nil)
+	return ctx
+}
+
+func TestClientIPResolverResolve(t *testing.T) {
+	r, err := newClientIPResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("create resolver failed, errors:\n%+v", err)
+	}
+
+	cases := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		expect  string
+	}{
+		{"no header", "10.0.0.1", nil, "10.0.0.1"},
+		{"untrusted remote", "1.1.1.1", map[string]string{headerXForwardFor: "2.2.2.2"}, "1.1.1.1"},
+		{"spoofed left-most xff", "10.0.0.1", map[string]string{headerXForwardFor: "9.9.9.9, 3.3.3.3, 10.0.0.2"}, "3.3.3.3"},
+		{"all hops trusted", "10.0.0.1", map[string]string{headerXForwardFor: "192.168.1.1, 10.0.0.3"}, "192.168.1.1"},
+		{"malformed xff hop", "10.0.0.1", map[string]string{headerXForwardFor: "3.3.3.3, bad, 10.0.0.2"}, "10.0.0.1"},
+		{"forwarded", "10.0.0.1", map[string]string{headerForwarded: `for=3.3.3.3;proto=http, for="10.0.0.2:80"`}, "3.3.3.3"},
+		{"forwarded first", "10.0.0.1", map[string]string{headerForwarded: "for=3.3.3.3", headerXForwardFor: "4.4.4.4"}, "3.3.3.3"},
+		{"forwarded ipv6", "10.0.0.1", map[string]string{headerForwarded: `for="[2001:db8::17]:4711"`}, "2001:db8::17"},
+		{"malformed forwarded", "10.0.0.1", map[string]string{headerForwarded: "for=unknown"}, "10.0.0.1"},
+		{"forwarded without for", "10.0.0.1", map[string]string{headerForwarded: "proto=http;by=3.3.3.3"}, "10.0.0.1"},
+	}
+
+	for _, c := range cases {
+		ip := r.resolve(newTestIPContext(c.remote, c.headers))
+		if ip != c.expect {
+			t.Errorf("%s: expect <%s> but <%s>", c.name, c.expect, ip)
+		}
+	}
+}
+
+func TestGetRealClientIP(t *testing.T) {
+	ctx := newTestIPContext("1.1.1.1", map[string]string{headerXForwardFor: "2.2.2.2"})
+	if ip := GetRealClientIP(ctx); ip != "1.1.1.1" {
+		t.Errorf("expect the forwarded headers ignored, but <%s>", ip)
+	}
+}
+
+func TestParseForwarded(t *testing.T) {
+	cases := []struct {
+		value  string
+		expect []string
+	}{
+		{"for=192.0.2.60;proto=http;by=203.0.113.43", []string{"192.0.2.60"}},
+		{`For="[2001:db8:cafe::17]:4711", for=198.51.100.17:80`, []string{"2001:db8:cafe::17", "198.51.100.17"}},
+		{"for=", nil},
+		{"for", nil},
+		{";;,,", nil},
+		{`for="[2001:db8::1`, []string{"[2001:db8::1"}},
+	}
+
+	for _, c := range cases {
+		chain := parseForwarded(c.value)
+		if !reflect.DeepEqual(chain, c.expect) {
+			t.Errorf("%s: expect %+v but %+v", c.value, c.expect, chain)
+		}
+	}
+}
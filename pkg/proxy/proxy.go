@@ -1,7 +1,6 @@
 package proxy
 
 import (
-	"container/list"
 	"errors"
 	"net"
 	"net/http"
@@ -12,6 +11,7 @@ import (
 	"time"
 
 	"github.com/fagongzi/gateway/pkg/conf"
+	"github.com/fagongzi/gateway/pkg/filter"
 	"github.com/fagongzi/gateway/pkg/model"
 	"github.com/fagongzi/gateway/pkg/util"
 	"github.com/fagongzi/log"
@@ -24,8 +24,14 @@ var (
 	ErrPrefixRequestCancel = "request canceled"
 	// ErrNoServer no server
 	ErrNoServer = errors.New("has no server")
+	// ErrBackendFailed the backend server responded a error status code without a body
+	ErrBackendFailed = errors.New("backend server failed")
 	// ErrRewriteNotMatch rewrite not match request url
 	ErrRewriteNotMatch = errors.New("rewrite not match request url")
+	// ErrAPINotFound no api matches the request
+	ErrAPINotFound = errors.New("api not found")
+	// ErrIPBlocked the client ip is in the blocklist
+	ErrIPBlocked = errors.New("ip blocked")
 )
 
 var (
@@ -44,7 +50,6 @@ func NewProxy(cnf *conf.Conf) *Proxy {
 	p := &Proxy{
 		fastHTTPClients: make(map[string]*util.FastHTTPClient),
 		cnf:             cnf,
-		filters:         list.New(),
 		stopC:           make(chan struct{}),
 		taskRunner:      task.NewRunner(),
 	}
@@ -59,9 +64,17 @@ type Proxy struct {
 	sync.RWMutex
 
 	cnf             *conf.Conf
-	filters         *list.List
+	filters         []*chainFilter // the global filter chain
+	filterInstances map[string]filter.Filter
+	filterChains    map[*model.API]*filterChain
+	chainLock       sync.RWMutex
 	fastHTTPClients map[string]*util.FastHTTPClient
 	routeTable      *model.RouteTable
+	corsEnabled     bool
+	ipResolver      *clientIPResolver
+	autoBanner      *autoBanner
+	errorTemplates  []*errorTemplate // the global error templates
+	requestIDHeader string
 
 	rpcListener net.Listener
 
@@ -84,7 +97,7 @@ func (p *Proxy) Start() {
 	}
 
 	log.Infof("bootstrap: gateway proxy started at <%s>", p.cnf.Addr)
-	err = fasthttp.ListenAndServe(p.cnf.Addr, p.ReverseProxyHandler)
+	err = p.serve()
 	if err != nil {
 		log.Errorf("bootstrap: gateway proxy start failed, errors:\n%+v",
 			err)
@@ -92,6 +105,19 @@ func (p *Proxy) Start() {
 	}
 }
 
+func (p *Proxy) serve() error {
+	if !p.cnf.ProxyProtocol {
+		return fasthttp.ListenAndServe(p.cnf.Addr, p.ReverseProxyHandler)
+	}
+
+	ln, err := net.Listen("tcp4", p.cnf.Addr)
+	if err != nil {
+		return err
+	}
+
+	return fasthttp.Serve(newProxyProtocolListener(ln, p.ipResolver), p.ReverseProxyHandler)
+}
+
 // Stop stop the proxy
 func (p *Proxy) Stop() {
 	log.Infof("stop: start to stop gateway proxy")
@@ -173,13 +199,46 @@ func (p *Proxy) isStopped() bool {
 }
 
 func (p *Proxy) init() {
-	err := p.initRouteTable()
+	resolver, err := newClientIPResolver(p.cnf.TrustedProxies)
+	if err != nil {
+		log.Fatalf("bootstrap: init trusted proxies failed, errors:\n%+v",
+			err)
+	}
+	p.ipResolver = resolver
+
+	err = p.initRouteTable()
 	if err != nil {
 		log.Fatalf("bootstrap: init route table failed, errors:\n%+v",
 			err)
 	}
 
 	p.initFilters()
+	p.initAutoBan()
+	p.initErrorTemplates()
+}
+
+func (p *Proxy) initErrorTemplates() {
+	p.requestIDHeader = p.cnf.RequestIDHeader
+	if p.requestIDHeader == "" {
+		p.requestIDHeader = defaultRequestIDHeader
+	}
+
+	p.errorTemplates = parseErrorTemplates(p.cnf.ErrorTemplates, "global")
+}
+
+func (p *Proxy) initAutoBan() {
+	if nil == p.cnf.AutoBan {
+		return
+	}
+
+	banner, err := newAutoBanner(p.cnf.AutoBan, p.routeTable, p.taskRunner)
+	if err != nil {
+		log.Fatalf("bootstrap: init auto ban failed, errors:\n%+v",
+			err)
+	}
+
+	p.autoBanner = banner
+	log.Infof("bootstrap: auto ban enabled, rule=<%+v>", p.cnf.AutoBan)
 }
 
 func (p *Proxy) initRouteTable() error {
@@ -201,18 +260,8 @@ func (p *Proxy) initRouteTable() error {
 	return nil
 }
 
-func (p *Proxy) initFilters() {
-	for _, filter := range p.cnf.Filers {
-		f, err := newFilter(filter)
-		if nil != err {
-			log.Fatalf("bootstrap: init filter failed, filter=<%+v> errors:\n%+v",
-				filter,
-				err)
-		}
-
-		log.Infof("bootstrap: filter added, filter=<%+v>", filter)
-		p.filters.PushBack(f)
-	}
+func (p *Proxy) autoBan(clientIP string, ctx *fasthttp.RequestCtx) {
+	p.autoBanner.record(clientIP, ctx.Response.StatusCode())
 }
 
 // ReverseProxyHandler http reverse handler
@@ -222,13 +271,57 @@ func (p *Proxy) ReverseProxyHandler(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	results := p.routeTable.Select(&ctx.Request)
+	rc := newRequestContext(p, ctx)
+	defer p.doLogFilters(rc)
+
+	p.dispatch(rc)
+	p.renderError(rc)
+	p.doPreResponseFilters(rc)
+
+	// set after the pre response filters, the headers filter resets the response headers
+	ctx.Response.Header.Set(p.requestIDHeader, rc.requestID)
+}
+
+// dispatch dispatch the request to the nodes of the api, and write the responses of the nodes
+func (p *Proxy) dispatch(rc *requestContext) {
+	ctx := rc.originCtx
+	clientIP := rc.clientIP
+
+	if p.routeTable.IsBlocked(clientIP) {
+		rc.err = ErrIPBlocked
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		return
+	}
+
+	if nil != p.autoBanner {
+		defer p.autoBan(clientIP, ctx)
+	}
+
+	filterName, code, err := p.doPreRoutingFilters(rc)
+	if nil != err {
+		log.Warnf("proxy: call pre routing filter failed, filter=<%s> errors:\n%+v",
+			filterName,
+			err)
+
+		rc.setError(err, code)
+		return
+	}
+
+	// preflight requests are answered by proxy, not dispatched to backend servers
+	if model.IsPreflight(&ctx.Request) && p.doPreflight(ctx) {
+		return
+	}
+
+	results := p.routeTable.Select(&ctx.Request, clientIP)
 
 	if nil == results || len(results) == 0 {
+		rc.err = ErrAPINotFound
 		ctx.SetStatusCode(fasthttp.StatusNotFound)
 		return
 	}
 
+	rc.api = results[0].API
+	rc.publishRouteResults(results)
 	count := len(results)
 	merge := count > 1
 
@@ -240,30 +333,37 @@ func (p *Proxy) ReverseProxyHandler(ctx *fasthttp.RequestCtx) {
 			result.Merge = merge
 
 			go func(result *model.RouteResult) {
-				p.doProxy(ctx, wg, result)
+				p.doProxy(rc, wg, result)
 			}(result)
 		}
 
 		wg.Wait()
 	} else {
-		p.doProxy(ctx, nil, results[0])
+		p.doProxy(rc, nil, results[0])
 	}
 
 	for _, result := range results {
 		if result.Err != nil {
 			if result.API.Mock != nil {
-				result.API.RenderMock(ctx)
+				rc.SetAttr(filter.AttrMocked, true)
+				result.API.RenderMock(ctx, clientIP, result.Params)
 				result.Release()
 				return
 			}
 
-			ctx.SetStatusCode(result.Code)
+			rc.setError(result.Err, result.Code)
 			result.Release()
 			return
 		}
 
 		if !merge {
 			p.writeResult(ctx, result.Res)
+
+			// the body of the backend server is kept, the error templates only render the empty one
+			if result.Res.StatusCode() >= fasthttp.StatusInternalServerError && len(result.Res.Body()) == 0 {
+				rc.err = ErrBackendFailed
+			}
+
 			result.Release()
 			return
 		}
@@ -296,11 +396,32 @@ func (p *Proxy) ReverseProxyHandler(ctx *fasthttp.RequestCtx) {
 	ctx.WriteString("}")
 }
 
-func (p *Proxy) doProxy(ctx *fasthttp.RequestCtx, wg *sync.WaitGroup, result *model.RouteResult) {
+// doPreflight answer the preflight request if the CORS filter is in the filter chain of the api
+func (p *Proxy) doPreflight(ctx *fasthttp.RequestCtx) bool {
+	api, headers := p.routeTable.Preflight(&ctx.Request)
+	if nil == api || !p.isCORSEnabled(api) {
+		return false
+	}
+
+	if nil == headers {
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		return true
+	}
+
+	for name, value := range headers {
+		ctx.Response.Header.Set(name, value)
+	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+	return true
+}
+
+func (p *Proxy) doProxy(rc *requestContext, wg *sync.WaitGroup, result *model.RouteResult) {
 	if nil != wg {
 		defer wg.Done()
 	}
 
+	ctx := rc.originCtx
+
 	svr := result.Svr
 
 	if nil == svr {
@@ -335,7 +456,7 @@ func (p *Proxy) doProxy(ctx *fasthttp.RequestCtx, wg *sync.WaitGroup, result *mo
 		}
 	}
 
-	c := newContext(p.routeTable, ctx, outreq, result)
+	c := newContext(rc, outreq, result)
 
 	// pre filters
 	filterName, code, err := p.doPreFilters(c)
@@ -374,6 +495,10 @@ func (p *Proxy) doProxy(ctx *fasthttp.RequestCtx, wg *sync.WaitGroup, result *mo
 			p.doPostErrFilters(c)
 		}
 
+		if nil != err {
+			err = &backendError{err: err}
+		}
+
 		result.Err = err
 		result.Code = resCode
 		return
@@ -404,6 +529,10 @@ func (p *Proxy) writeResult(ctx *fasthttp.RequestCtx, res *fasthttp.Response) {
 	ctx.Write(res.Body())
 }
 
+func (p *Proxy) doRequest(req *fasthttp.Request, addr string) (*fasthttp.Response, error) {
+	return p.getClient(addr).Do(req, addr)
+}
+
 func (p *Proxy) getClient(addr string) *util.FastHTTPClient {
 	p.RLock()
 	c, ok := p.fastHTTPClients[addr]
@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fagongzi/log"
+)
+
+const (
+	proxyProtocolV1Prefix    = "PROXY "
+	proxyProtocolV1MaxLength = 107
+	proxyProtocolHeaderWait  = time.Second * 5
+)
+
+var (
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+var (
+	// ErrInvalidProxyProtocol the PROXY protocol header is invalid
+	ErrInvalidProxyProtocol = errors.New("invalid PROXY protocol header")
+)
+
+// proxyProtocolListener accept the connections with the PROXY protocol(v1 and v2) header.
+// If the trusted proxies are set, only the connections from the trusted proxies are accepted.
+type proxyProtocolListener struct {
+	net.Listener
+	resolver *clientIPResolver
+}
+
+func newProxyProtocolListener(ln net.Listener, resolver *clientIPResolver) net.Listener {
+	return &proxyProtocolListener{
+		Listener: ln,
+		resolver: resolver,
+	}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if l.resolver.hasTrusted() {
+			addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+			if !ok || !l.resolver.isTrusted(addr.IP) {
+				log.Warnf("proxy: PROXY protocol connection from untrusted addr <%s>, closed",
+					conn.RemoteAddr())
+				conn.Close()
+				continue
+			}
+		}
+
+		return &proxyProtocolConn{
+			Conn:   conn,
+			reader: bufio.NewReader(conn),
+		}, nil
+	}
+}
+
+// proxyProtocolConn the header is read at the first Read or RemoteAddr,
+// so the Accept is not blocked by the slow connections.
+type proxyProtocolConn struct {
+	net.Conn
+	reader *bufio.Reader
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(proxyProtocolHeaderWait))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	c.remoteAddr, c.err = readProxyProtocolHeader(c.reader)
+	if c.err != nil {
+		log.Warnf("proxy: read PROXY protocol header from <%s> failed, errors:\n%+v",
+			c.Conn.RemoteAddr(),
+			c.err)
+		c.Conn.Close()
+	}
+}
+
+// readProxyProtocolHeader returns the source addr of the header,
+// returns nil addr if the header has no address info, like the LOCAL command or the UNKNOWN protocol.
+func readProxyProtocolHeader(r *bufio.Reader) (net.Addr, error) {
+	sign, err := r.Peek(len(proxyProtocolV2Signature))
+	if err == nil && bytes.Equal(sign, proxyProtocolV2Signature) {
+		return readProxyProtocolV2(r)
+	}
+
+	prefix, err := r.Peek(len(proxyProtocolV1Prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	if string(prefix) != proxyProtocolV1Prefix {
+		return nil, ErrInvalidProxyProtocol
+	}
+
+	return readProxyProtocolV1(r)
+}
+
+// readProxyProtocolV1 parse the text header, like: PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func readProxyProtocolV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+
+		if len(line) >= proxyProtocolV1MaxLength {
+			return nil, ErrInvalidProxyProtocol
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyProtocol
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyProtocol
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.Atoi(fields[4])
+	if nil == ip || err != nil || port < 0 || port > 65535 {
+		return nil, ErrInvalidProxyProtocol
+	}
+
+	return &net.TCPAddr{IP: ip, Port: port}, nil
+}
+
+// readProxyProtocolV2 parse the binary header
+func readProxyProtocolV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	version := header[12] >> 4
+	command := header[12] & 0x0f
+	family := header[13]
+	length := int(binary.BigEndian.Uint16(header[14:16]))
+
+	if version != 2 || command > 1 {
+		return nil, fmt.Errorf("%s, version=<%d> command=<%d>", ErrInvalidProxyProtocol, version, command)
+	}
+
+	data := make([]byte, length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// LOCAL command, the connection is established by the proxy itself
+	if command == 0 {
+		return nil, nil
+	}
+
+	switch family {
+	case 0x11: // TCP over IPv4
+		if length < 12 {
+			return nil, ErrInvalidProxyProtocol
+		}
+
+		return &net.TCPAddr{
+			IP:   net.IP(data[0:4]),
+			Port: int(binary.BigEndian.Uint16(data[8:10])),
+		}, nil
+	case 0x21: // TCP over IPv6
+		if length < 36 {
+			return nil, ErrInvalidProxyProtocol
+		}
+
+		return &net.TCPAddr{
+			IP:   net.IP(data[0:16]),
+			Port: int(binary.BigEndian.Uint16(data[32:34])),
+		}, nil
+	}
+
+	// the unsupported family, use the addr of the connection
+	return nil, nil
+}
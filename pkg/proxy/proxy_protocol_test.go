@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestProxyProtocolV2(command, family byte, data []byte) []byte {
+	header := append([]byte{}, proxyProtocolV2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(data)))
+	return append(header, data...)
+}
+
+func TestReadProxyProtocolHeader(t *testing.T) {
+	v4 := make([]byte, 12)
+	copy(v4[0:4], net.ParseIP("1.2.3.4").To4())
+	copy(v4[4:8], net.ParseIP("5.6.7.8").To4())
+	binary.BigEndian.PutUint16(v4[8:10], 5000)
+	binary.BigEndian.PutUint16(v4[10:12], 80)
+
+	v6 := make([]byte, 36)
+	copy(v6[0:16], net.ParseIP("2001:db8::1"))
+	binary.BigEndian.PutUint16(v6[32:34], 6000)
+
+	cases := []struct {
+		name   string
+		header []byte
+		expect string
+		err    bool
+	}{
+		{"v1 tcp4", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"), "192.168.0.1:56324", false},
+		{"v1 tcp6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324", false},
+		{"v1 unknown", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 unknown with addrs", []byte("PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n"), "", false},
+		{"v1 overlong", []byte("PROXY TCP6 " + strings.Repeat("1", proxyProtocolV1MaxLength) + "\r\n"), "", true},
+		{"v1 without crlf", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n"), "", true},
+		{"v1 bad ip", []byte("PROXY TCP4 bad 192.168.0.11 56324 443\r\n"), "", true},
+		{"v1 bad port", []byte("PROXY TCP4 192.168.0.1 192.168.0.11 70000 443\r\n"), "", true},
+		{"v1 bad protocol", []byte("PROXY UDP4 192.168.0.1 192.168.0.11 56324 443\r\n"), "", true},
+		{"v1 truncated", []byte("PROXY TCP4 192.168.0.1"), "", true},
+		{"no header", []byte("GET / HTTP/1.1\r\n\r\n"), "", true},
+		{"v2 tcp4", newTestProxyProtocolV2(1, 0x11, v4), "1.2.3.4:5000", false},
+		{"v2 tcp6", newTestProxyProtocolV2(1, 0x21, v6), "[2001:db8::1]:6000", false},
+		{"v2 local", newTestProxyProtocolV2(0, 0x11, v4), "", false},
+		{"v2 local without addrs", newTestProxyProtocolV2(0, 0, nil), "", false},
+		{"v2 unsupported family", newTestProxyProtocolV2(1, 0x31, make([]byte, 216)), "", false},
+		{"v2 tcp4 short length", newTestProxyProtocolV2(1, 0x11, v4[:8]), "", true},
+		{"v2 tcp6 short length", newTestProxyProtocolV2(1, 0x21, v6[:20]), "", true},
+		{"v2 truncated data", newTestProxyProtocolV2(1, 0x11, v4)[:20], "", true},
+		{"v2 bad command", newTestProxyProtocolV2(2, 0x11, v4), "", true},
+	}
+
+	for _, c := range cases {
+		addr, err := readProxyProtocolHeader(bufio.NewReader(bytes.NewReader(c.header)))
+		if c.err {
+			if err == nil {
+				t.Errorf("%s: expect error but <%v>", c.name, addr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error:\n%+v", c.name, err)
+			continue
+		}
+
+		if c.expect == "" && addr != nil {
+			t.Errorf("%s: expect nil addr but <%s>", c.name, addr)
+		} else if c.expect != "" && (addr == nil || addr.String() != c.expect) {
+			t.Errorf("%s: expect <%s> but <%v>", c.name, c.expect, addr)
+		}
+	}
+}
+
+func TestProxyProtocolConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	conn := &proxyProtocolConn{Conn: server, reader: bufio.NewReader(server)}
+	go client.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET"))
+
+	if addr := conn.RemoteAddr().String(); addr != "192.168.0.1:56324" {
+		t.Errorf("expect the addr of the header but <%s>", addr)
+	}
+
+	data := make([]byte, 3)
+	_, err := io.ReadFull(conn, data)
+	if err != nil || string(data) != "GET" {
+		t.Errorf("expect the data after the header but <%s>, errors:\n%+v", data, err)
+	}
+}
+
+func TestProxyProtocolListenerUntrusted(t *testing.T) {
+	cases := []struct {
+		name     string
+		trusted  []string
+		accepted bool
+	}{
+		{"untrusted closed", []string{"10.0.0.0/8"}, false},
+		{"trusted accepted", []string{"127.0.0.1"}, true},
+		{"no trusted accepted", nil, true},
+	}
+
+	for _, c := range cases {
+		resolver, err := newClientIPResolver(c.trusted)
+		if err != nil {
+			t.Fatalf("%s: create resolver failed, errors:\n%+v", c.name, err)
+		}
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("%s: listen failed, errors:\n%+v", c.name, err)
+		}
+
+		accepted := make(chan net.Conn, 1)
+		go func() {
+			conn, err := newProxyProtocolListener(ln, resolver).Accept()
+			if err == nil {
+				accepted <- conn
+			}
+		}()
+
+		client, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatalf("%s: dial failed, errors:\n%+v", c.name, err)
+		}
+
+		client.SetReadDeadline(time.Now().Add(time.Millisecond * 200))
+		_, err = client.Read(make([]byte, 1))
+		closed := err == io.EOF
+
+		select {
+		case conn := <-accepted:
+			conn.Close()
+			if !c.accepted {
+				t.Errorf("%s: expect closed but accepted", c.name)
+			}
+		default:
+			if c.accepted {
+				t.Errorf("%s: expect accepted but not", c.name)
+			}
+		}
+
+		if closed == c.accepted {
+			t.Errorf("%s: expect closed <%v> but <%v>", c.name, !c.accepted, closed)
+		}
+
+		client.Close()
+		ln.Close()
+	}
+}
@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"sync"
+
+	"github.com/fagongzi/gateway/pkg/filter"
+	"github.com/fagongzi/gateway/pkg/model"
+	"github.com/valyala/fasthttp"
+)
+
+// requestContext the context of a request, it's shared by the contexts of the nodes
+type requestContext struct {
+	proxy     *Proxy
+	originCtx *fasthttp.RequestCtx
+	attrs     *attributes
+	clientIP  string
+	requestID string
+	api       *model.API // nil before the api is selected or if no api matches
+	err       error
+
+	filterConfig map[string]string // config of the executing filter of the request phases
+
+	onceLock sync.Mutex
+	onces    map[string]*onceValue
+}
+
+// rejectedError the error of a rejected request with the response to the client, like the script or the sidecar rejected the request.
+// The nodes run concurrently in merge mode, so the response is written to the client once after the nodes joined.
+type rejectedError interface {
+	error
+	writeResponse(res *fasthttp.Response)
+}
+
+// onceValue the value shared by the nodes of the request
+type onceValue struct {
+	sync.Once
+	value interface{}
+}
+
+func newRequestContext(p *Proxy, originCtx *fasthttp.RequestCtx) *requestContext {
+	return &requestContext{
+		proxy:     p,
+		originCtx: originCtx,
+		attrs:     newAttributes(),
+		clientIP:  p.ipResolver.resolve(originCtx),
+		requestID: getRequestID(originCtx, p.requestIDHeader),
+	}
+}
+
+// once calls fn once a request for the key, the nodes of the request share the returned value.
+// The checks of the api like rate limits and quota run once a request, no matter how many nodes the api has.
+func (c *requestContext) once(key string, fn func() interface{}) interface{} {
+	c.onceLock.Lock()
+	if nil == c.onces {
+		c.onces = make(map[string]*onceValue)
+	}
+
+	v, ok := c.onces[key]
+	if !ok {
+		v = &onceValue{}
+		c.onces[key] = v
+	}
+	c.onceLock.Unlock()
+
+	v.Do(func() {
+		v.value = fn()
+	})
+
+	return v.value
+}
+
+// setError set the error and the status code of the request, the response of the rejected error is written
+func (c *requestContext) setError(err error, statusCode int) {
+	c.err = err
+	if rejected, ok := err.(rejectedError); ok {
+		rejected.writeResponse(&c.originCtx.Response)
+	}
+	c.originCtx.SetStatusCode(statusCode)
+}
+
+func (c *requestContext) GetOriginRequestCtx() *fasthttp.RequestCtx {
+	return c.originCtx
+}
+
+func (c *requestContext) GetClientIP() string {
+	return c.clientIP
+}
+
+func (c *requestContext) GetRequestID() string {
+	return c.requestID
+}
+
+func (c *requestContext) FromTrustedProxy() bool {
+	return c.proxy.ipResolver.isTrusted(c.originCtx.RemoteIP())
+}
+
+func (c *requestContext) GetAPIName() string {
+	if nil == c.api {
+		return ""
+	}
+
+	if c.api.Name != "" {
+		return c.api.Name
+	}
+
+	return c.api.URL
+}
+
+// publishRouteResults publish the api and the nodes of the request to the attributes
+func (c *requestContext) publishRouteResults(results []*model.RouteResult) {
+	clusters := make([]string, 0, len(results))
+	servers := make([]string, 0, len(results))
+	for _, result := range results {
+		clusters = append(clusters, result.Node.ClusterName)
+
+		if nil != result.Svr {
+			servers = append(servers, result.Svr.Addr)
+		} else {
+			servers = append(servers, "")
+		}
+	}
+
+	c.SetAttr(filter.AttrAPI, c.GetAPIName())
+	c.SetAttr(filter.AttrClusters, clusters)
+	c.SetAttr(filter.AttrServers, servers)
+}
+
+func (c *requestContext) GetError() error {
+	return c.err
+}
+
+func (c *requestContext) SetAttr(key string, value interface{}) {
+	c.attrs.set(key, value)
+}
+
+func (c *requestContext) GetAttr(key string) (interface{}, bool) {
+	return c.attrs.get(key)
+}
+
+func (c *requestContext) GetStringAttr(key string) string {
+	return c.attrs.getString(key)
+}
+
+func (c *requestContext) GetIntAttr(key string) int {
+	return c.attrs.getInt(key)
+}
+
+func (c *requestContext) GetBoolAttr(key string) bool {
+	return c.attrs.getBool(key)
+}
+
+func (c *requestContext) GetAttrs() map[string]interface{} {
+	return c.attrs.copy()
+}
+
+func (c *requestContext) SetConsumer(consumer string) {
+	c.SetAttr(filter.AttrConsumer, consumer)
+}
+
+func (c *requestContext) GetConsumer() string {
+	return c.GetStringAttr(filter.AttrConsumer)
+}
+
+func (c *requestContext) GetFilterConfig(key string) string {
+	return c.filterConfig[key]
+}
+
+func (c *requestContext) GetFilterConfigs() map[string]string {
+	return copyFilterConfig(c.filterConfig)
+}
+
+func (c *requestContext) GetCORSHeaders() map[string]string {
+	if nil == c.api {
+		return nil
+	}
+
+	return c.api.GetCORSHeaders(&c.originCtx.Request)
+}
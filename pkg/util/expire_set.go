@@ -0,0 +1,86 @@
+package util
+
+import (
+	"container/heap"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrKeyExists the key already exists and not expired
+	ErrKeyExists = errors.New("Key exists")
+	// ErrSetFull the set reached the max size and no key expired
+	ErrSetFull = errors.New("Set is full")
+)
+
+// ExpireSet a set of keys with a max size, the key is removed after it expired
+type ExpireSet struct {
+	sync.Mutex
+
+	maxSize int
+	keys    map[string]time.Time
+	queue   expireQueue // ordered by the expire time
+}
+
+type expireKey struct {
+	key      string
+	expireAt time.Time
+}
+
+// expireQueue a min heap of the keys by the expire time
+type expireQueue []*expireKey
+
+func (q expireQueue) Len() int           { return len(q) }
+func (q expireQueue) Less(i, j int) bool { return q[i].expireAt.Before(q[j].expireAt) }
+func (q expireQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *expireQueue) Push(x interface{}) {
+	*q = append(*q, x.(*expireKey))
+}
+
+func (q *expireQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	value := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return value
+}
+
+// NewExpireSet create a ExpireSet, the set never has more than maxSize keys
+func NewExpireSet(maxSize int) *ExpireSet {
+	return &ExpireSet{
+		maxSize: maxSize,
+		keys:    make(map[string]time.Time),
+	}
+}
+
+// Add add the key to the set, returns ErrKeyExists if the key already exists and not expired,
+// and ErrSetFull if the set has maxSize keys not expired
+func (s *ExpireSet) Add(key string, expireAt time.Time, now time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.expire(now)
+
+	if _, ok := s.keys[key]; ok {
+		return ErrKeyExists
+	}
+
+	if len(s.keys) >= s.maxSize {
+		return ErrSetFull
+	}
+
+	s.keys[key] = expireAt
+	heap.Push(&s.queue, &expireKey{key: key, expireAt: expireAt})
+	return nil
+}
+
+// expire remove the expired keys, only the expired keys at the head of the queue are visited
+func (s *ExpireSet) expire(now time.Time) {
+	for len(s.queue) > 0 && !now.Before(s.queue[0].expireAt) {
+		value := heap.Pop(&s.queue).(*expireKey)
+		delete(s.keys, value.key)
+	}
+}
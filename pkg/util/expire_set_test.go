@@ -0,0 +1,91 @@
+package util
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpireSet(t *testing.T) {
+	now := time.Now()
+	s := NewExpireSet(2)
+
+	if err := s.Add("a", now.Add(time.Second), now); err != nil {
+		t.Errorf("expect a added, but %+v", err)
+	}
+
+	if err := s.Add("a", now.Add(time.Second), now); err != ErrKeyExists {
+		t.Errorf("expect a exists, but %+v", err)
+	}
+
+	if err := s.Add("a", now.Add(time.Minute), now.Add(time.Second)); err != nil {
+		t.Errorf("expect a added again after expired, but %+v", err)
+	}
+
+	s.Add("b", now.Add(time.Second), now)
+
+	// the expired keys are removed
+	now = now.Add(time.Second * 2)
+	if err := s.Add("c", now.Add(time.Second), now); err != nil {
+		t.Errorf("expect c added, but %+v", err)
+	}
+
+	if len(s.keys) != 2 || len(s.queue) != 2 {
+		t.Errorf("expect b removed, but %d keys", len(s.keys))
+	}
+
+	if err := s.Add("a", now.Add(time.Second), now); err != ErrKeyExists {
+		t.Errorf("expect a not expired, but %+v", err)
+	}
+}
+
+func TestExpireSetFull(t *testing.T) {
+	now := time.Now()
+	s := NewExpireSet(100)
+
+	for i := 0; i < 100; i++ {
+		if err := s.Add(fmt.Sprintf("k%d", i), now.Add(time.Duration(100-i)*time.Second), now); err != nil {
+			t.Fatalf("expect k%d added, but %+v", i, err)
+		}
+	}
+
+	// the set is full, the keys are not added until some of them expired
+	if err := s.Add("x", now.Add(time.Minute), now); err != ErrSetFull {
+		t.Errorf("expect set full, but %+v", err)
+	}
+
+	if len(s.keys) != 100 || len(s.queue) != 100 {
+		t.Errorf("expect 100 keys, but %d", len(s.keys))
+	}
+
+	// k99 and k98 expired
+	now = now.Add(2 * time.Second)
+	if err := s.Add("x", now.Add(time.Minute), now); err != nil {
+		t.Errorf("expect x added, but %+v", err)
+	}
+
+	if err := s.Add("y", now.Add(time.Minute), now); err != nil {
+		t.Errorf("expect y added, but %+v", err)
+	}
+
+	if err := s.Add("z", now.Add(time.Minute), now); err != ErrSetFull {
+		t.Errorf("expect set full, but %+v", err)
+	}
+
+	if _, ok := s.keys["k97"]; !ok {
+		t.Errorf("expect k97 not expired")
+	}
+}
+
+func BenchmarkExpireSetFull(b *testing.B) {
+	now := time.Now()
+	s := NewExpireSet(102400)
+	for i := 0; i < 102400; i++ {
+		s.Add(fmt.Sprintf("k%d", i), now.Add(time.Hour), now)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Add("x", now.Add(time.Hour), now)
+	}
+}
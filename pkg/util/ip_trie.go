@@ -0,0 +1,162 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// IPTrie a binary prefix tree of ip ranges, support IPv4 and IPv6
+type IPTrie struct {
+	v4 *ipTrieNode
+	v6 *ipTrieNode
+}
+
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	terminal bool
+}
+
+// NewIPTrie create a empty IPTrie
+func NewIPTrie() *IPTrie {
+	return &IPTrie{
+		v4: &ipTrieNode{},
+		v6: &ipTrieNode{},
+	}
+}
+
+// Add add a ip range to the trie. The value can be a CIDR(10.0.0.0/8, fd00::/8),
+// a single ip(127.0.0.1, ::1), or a ipv4 with tail wildcards(127.0.*, *).
+func (t *IPTrie) Add(value string) error {
+	ipNet, err := ParseIPRange(value)
+	if err != nil {
+		return err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	ip, root := t.root(ipNet.IP)
+
+	// a ipv4-mapped ipv6 range(::ffff:10.0.0.0/104) is added to the ipv4 tree
+	if bits == 8*net.IPv6len && len(ip) == net.IPv4len {
+		if ones < 8*(net.IPv6len-net.IPv4len) {
+			return fmt.Errorf("invalid ip range: %s", value)
+		}
+		ones -= 8 * (net.IPv6len - net.IPv4len)
+	}
+
+	node := root
+	for i := 0; i < ones && !node.terminal; i++ {
+		bit := ipBit(ip, i)
+		if nil == node.children[bit] {
+			node.children[bit] = &ipTrieNode{}
+		}
+		node = node.children[bit]
+	}
+
+	// a shorter prefix already contains the range
+	if node.terminal {
+		return nil
+	}
+
+	node.terminal = true
+	node.children[0] = nil
+	node.children[1] = nil
+	return nil
+}
+
+// Contains returns true if the ip is in any range of the trie
+func (t *IPTrie) Contains(ip net.IP) bool {
+	if nil == ip {
+		return false
+	}
+
+	ip, node := t.root(ip)
+	for i := 0; nil != node; i++ {
+		if node.terminal {
+			return true
+		}
+
+		if i >= len(ip)*8 {
+			return false
+		}
+
+		node = node.children[ipBit(ip, i)]
+	}
+
+	return false
+}
+
+// ContainsString returns true if the ip is in any range of the trie
+func (t *IPTrie) ContainsString(ip string) bool {
+	return t.Contains(net.ParseIP(ip))
+}
+
+func (t *IPTrie) root(ip net.IP) (net.IP, *ipTrieNode) {
+	if v4 := ip.To4(); nil != v4 {
+		return v4, t.v4
+	}
+
+	return ip.To16(), t.v6
+}
+
+func ipBit(ip net.IP, index int) byte {
+	return (ip[index/8] >> uint(7-index%8)) & 1
+}
+
+// ParseIPRange parse a CIDR, a single ip or a ipv4 with tail wildcards to a ip range
+func ParseIPRange(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+
+	if strings.Contains(value, "/") {
+		_, ipNet, err := net.ParseCIDR(value)
+		return ipNet, err
+	}
+
+	if strings.Contains(value, "*") {
+		return parseWildcard(value)
+	}
+
+	ip := net.ParseIP(value)
+	if nil == ip {
+		return nil, fmt.Errorf("invalid ip: %s", value)
+	}
+
+	if v4 := ip.To4(); nil != v4 {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// parseWildcard parse the ipv4 like 127.0.*, 127.0.0.*, only the tail octets can be wildcard
+func parseWildcard(value string) (*net.IPNet, error) {
+	octets := strings.Split(value, ".")
+	if len(octets) > 4 {
+		return nil, fmt.Errorf("invalid ip: %s", value)
+	}
+
+	ip := make(net.IP, 4)
+	ones := 0
+	wildcard := false
+	for index, octet := range octets {
+		if octet == "*" {
+			wildcard = true
+			continue
+		}
+
+		v, err := strconv.Atoi(octet)
+		if wildcard || err != nil || v < 0 || v > 255 {
+			return nil, fmt.Errorf("invalid ip: %s, only the tail octets can be wildcard", value)
+		}
+
+		ip[index] = byte(v)
+		ones += 8
+	}
+
+	if !wildcard && len(octets) != 4 {
+		return nil, fmt.Errorf("invalid ip: %s", value)
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 32)}, nil
+}
@@ -0,0 +1,71 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestIPTrie(t *testing.T) {
+	trie := NewIPTrie()
+	for _, value := range []string{"10.0.0.0/8", "192.168.1.1", "127.0.*", "fd00::/8", "::1"} {
+		if err := trie.Add(value); err != nil {
+			t.Fatalf("add %s failed: %+v", value, err)
+		}
+	}
+
+	cases := map[string]bool{
+		"10.1.2.3":        true,
+		"11.0.0.1":        false,
+		"192.168.1.1":     true,
+		"192.168.1.2":     false,
+		"127.0.10.1":      true,
+		"127.1.0.1":       false,
+		"fd12::1":         true,
+		"fe80::1":         false,
+		"::1":             true,
+		"::ffff:10.0.0.1": true,
+		"invalid":         false,
+	}
+
+	for ip, expect := range cases {
+		if trie.ContainsString(ip) != expect {
+			t.Errorf("%s expect %v", ip, expect)
+		}
+	}
+}
+
+func TestIPTrieAddInvalid(t *testing.T) {
+	trie := NewIPTrie()
+	for _, value := range []string{"127.*.0.1", "1.2.3", "10.0.0.0/33", "abc", "256.*"} {
+		if err := trie.Add(value); err == nil {
+			t.Errorf("%s expect error", value)
+		}
+	}
+}
+
+func TestIPTrieAnyIP(t *testing.T) {
+	trie := NewIPTrie()
+	trie.Add("*")
+
+	if !trie.ContainsString("8.8.8.8") {
+		t.Error("expect * contains all ipv4")
+	}
+}
+
+func TestIPTrieIPv4MappedRange(t *testing.T) {
+	trie := NewIPTrie()
+	if err := trie.Add("::ffff:10.0.0.0/104"); err != nil {
+		t.Fatalf("add failed: %+v", err)
+	}
+
+	cases := map[string]bool{
+		"10.1.2.3":        true,
+		"::ffff:10.0.0.1": true,
+		"11.0.0.1":        false,
+	}
+
+	for ip, expect := range cases {
+		if trie.ContainsString(ip) != expect {
+			t.Errorf("%s expect %v", ip, expect)
+		}
+	}
+}
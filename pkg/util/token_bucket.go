@@ -0,0 +1,118 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket token bucket, refill rate tokens per second, up to capacity tokens
+type TokenBucket struct {
+	sync.Mutex
+
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewTokenBucket create a full TokenBucket
+func NewTokenBucket(rate int, capacity int, now time.Time) *TokenBucket {
+	if capacity <= 0 {
+		capacity = rate
+	}
+
+	return &TokenBucket{
+		rate:     float64(rate),
+		capacity: float64(capacity),
+		tokens:   float64(capacity),
+		last:     now,
+	}
+}
+
+// Take take a token from the bucket, returns remaining tokens,
+// and if no token available, returns the duration to wait for next token.
+func (b *TokenBucket) Take(now time.Time) (ok bool, remaining int, wait time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill(now)
+
+	if b.tokens < 1 {
+		return false, 0, b.wait()
+	}
+
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// Refund return a token taken to the bucket, up to capacity
+func (b *TokenBucket) Refund(now time.Time) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill(now)
+
+	b.tokens++
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+}
+
+// Check returns true if a token is available, not take.
+// If no token available, returns the duration to wait for next token.
+func (b *TokenBucket) Check(now time.Time) (ok bool, wait time.Duration) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill(now)
+
+	if b.tokens < 1 {
+		return false, b.wait()
+	}
+
+	return true, 0
+}
+
+// Remaining returns remaining tokens, not take
+func (b *TokenBucket) Remaining(now time.Time) int {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill(now)
+	return int(b.tokens)
+}
+
+// Capacity returns capacity of the bucket
+func (b *TokenBucket) Capacity() int {
+	return int(b.capacity)
+}
+
+// IsFull returns true if the bucket is full, a full bucket is the same as a new one
+func (b *TokenBucket) IsFull(now time.Time) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.capacity
+}
+
+func (b *TokenBucket) wait() time.Duration {
+	if b.rate <= 0 {
+		return time.Second
+	}
+
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens += elapsed.Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+}
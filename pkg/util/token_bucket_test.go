@@ -0,0 +1,64 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(2, 3, now)
+
+	for i := 2; i >= 0; i-- {
+		ok, remaining, _ := b.Take(now)
+		if !ok || remaining != i {
+			t.Fatalf("expect take ok with remaining %d, but %v %d", i, ok, remaining)
+		}
+	}
+
+	ok, _, wait := b.Take(now)
+	if ok || wait != time.Millisecond*500 {
+		t.Errorf("expect rejected and wait 500ms, but %v %s", ok, wait)
+	}
+
+	if ok, _ := b.Check(now); ok {
+		t.Error("expect check failed on empty bucket")
+	}
+
+	now = now.Add(time.Millisecond * 500)
+	if ok, _ := b.Check(now); !ok {
+		t.Error("expect check ok after refill")
+	}
+
+	if b.Remaining(now) != 1 {
+		t.Errorf("expect check not take, but remaining %d", b.Remaining(now))
+	}
+
+	now = now.Add(time.Hour)
+	if !b.IsFull(now) || b.Remaining(now) != b.Capacity() {
+		t.Errorf("expect refill to capacity, but %d", b.Remaining(now))
+	}
+}
+
+func TestTokenBucketDefaultCapacity(t *testing.T) {
+	b := NewTokenBucket(5, 0, time.Now())
+	if b.Capacity() != 5 {
+		t.Errorf("expect capacity same as rate, but %d", b.Capacity())
+	}
+}
+
+func TestTokenBucketRefund(t *testing.T) {
+	now := time.Now()
+	b := NewTokenBucket(1, 2, now)
+
+	b.Take(now)
+	b.Refund(now)
+	if b.Remaining(now) != 2 {
+		t.Errorf("expect the token refunded, but remaining %d", b.Remaining(now))
+	}
+
+	b.Refund(now)
+	if b.Remaining(now) != 2 {
+		t.Errorf("expect refund up to capacity, but remaining %d", b.Remaining(now))
+	}
+}